@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/maintenance"
+	"github.com/qarea/jirams/tracing"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+// AdminContext - administrative request authentication
+type AdminContext struct {
+	Token string
+}
+
+// GetMaintenanceRequest request arguments
+type GetMaintenanceRequest struct {
+	Context AdminContext
+}
+
+// GetMaintenanceResponse response structure
+type GetMaintenanceResponse struct {
+	State maintenance.State
+}
+
+// SetMaintenanceRequest request arguments
+type SetMaintenanceRequest struct {
+	Context AdminContext
+	State   maintenance.State
+}
+
+// SetMaintenanceResponse response structure
+type SetMaintenanceResponse struct{}
+
+// RegisterWebhookRequest request arguments, Webhook.URL defaults to the service webhook endpoint
+type RegisterWebhookRequest struct {
+	Context AdminContext
+	Tracker entities.TrackerConfig
+	Webhook entities.Webhook
+}
+
+// RegisterWebhookResponse response structure
+type RegisterWebhookResponse struct {
+	Webhook entities.Webhook
+}
+
+// GetWebhooksRequest request arguments
+type GetWebhooksRequest struct {
+	Context AdminContext
+	Tracker entities.TrackerConfig
+}
+
+// GetWebhooksResponse response structure
+type GetWebhooksResponse struct {
+	Webhooks []entities.Webhook
+}
+
+// DeleteWebhookRequest request arguments
+type DeleteWebhookRequest struct {
+	Context   AdminContext
+	Tracker   entities.TrackerConfig
+	WebhookID uint64
+}
+
+// DeleteWebhookResponse response structure
+type DeleteWebhookResponse struct{}
+
+// WebhookRegistrar manages webhooks registered in tracker
+type WebhookRegistrar interface {
+	RegisterWebhook(ctx context.Context, tracker entities.TrackerConfig, webhook entities.Webhook, res *entities.Webhook) error
+	GetWebhooks(ctx context.Context, tracker entities.TrackerConfig, res *[]entities.Webhook) error
+	DeleteWebhook(ctx context.Context, tracker entities.TrackerConfig, webhookID uint64) error
+}
+
+// NewAdminAPI creates an instance of Admin, implementing administrative RPC interface
+func NewAdminAPI(token string, mode *maintenance.Mode) *Admin {
+	return &Admin{Token: token, Maintenance: mode}
+}
+
+// Admin implements administrative RPC interface, it is disabled when Token is empty
+type Admin struct {
+	Token       string
+	Maintenance *maintenance.Mode
+	Webhooks    WebhookRegistrar
+	Users       UserMappings
+	// WebhookURL returns address of the service webhook endpoint for tracker
+	WebhookURL func(trackerID entities.TrackerID) string
+}
+
+func (admin *Admin) authorize(ctx AdminContext) error {
+	if admin.Token == "" || subtle.ConstantTimeCompare([]byte(ctx.Token), []byte(admin.Token)) != 1 {
+		return entities.ErrUnauthorized
+	}
+	return nil
+}
+
+// call authorizes request and runs the handler with context carrying new tracing ID
+func (admin *Admin) call(method string, actx AdminContext, handler func(ctx context.Context) error) error {
+	if err := admin.authorize(actx); err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(traceid.New(context.Background()), "Admin."+method)
+	l.DEBUG("[%s] %s", tracing.ID(ctx), method)
+	err := handler(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+// Protect requires admin token sent as bearer token to access HTTP endpoint exposing service state
+func (admin *Admin) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || admin.authorize(AdminContext{Token: strings.TrimPrefix(auth, "Bearer ")}) != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetMaintenance returns current maintenance state
+func (admin *Admin) GetMaintenance(req GetMaintenanceRequest, res *GetMaintenanceResponse) error {
+	return admin.call("GetMaintenance", req.Context, func(ctx context.Context) error {
+		res.State = admin.Maintenance.State()
+		return nil
+	})
+}
+
+// SetMaintenance replaces current maintenance state until maintenance config is changed
+func (admin *Admin) SetMaintenance(req SetMaintenanceRequest, res *SetMaintenanceResponse) error {
+	return admin.call("SetMaintenance", req.Context, func(ctx context.Context) error {
+		l.NOTICE("[%s] Maintenance state set by admin: %+v", tracing.ID(ctx), req.State)
+		admin.Maintenance.Set(req.State)
+		return nil
+	})
+}
+
+// RegisterWebhook registers webhook delivering tracker changes to the service
+func (admin *Admin) RegisterWebhook(req RegisterWebhookRequest, res *RegisterWebhookResponse) error {
+	return admin.call("RegisterWebhook", req.Context, func(ctx context.Context) error {
+		if admin.Webhooks == nil {
+			return entities.NewServerError("Webhooks are not configured")
+		}
+		if req.Webhook.URL == "" && admin.WebhookURL != nil {
+			req.Webhook.URL = admin.WebhookURL(req.Tracker.ID)
+		}
+		if req.Webhook.URL == "" {
+			return entities.ErrInvalidRequest
+		}
+		if req.Webhook.Name == "" {
+			req.Webhook.Name = "jirams"
+		}
+		err := admin.Webhooks.RegisterWebhook(ctx, req.Tracker, req.Webhook, &res.Webhook)
+		if err != nil {
+			return entities.NewLoggedError(l, ctx, err, "Failed to register webhook")
+		}
+		l.NOTICE("[%s] Webhook %d registered for tracker %d", tracing.ID(ctx), res.Webhook.ID, req.Tracker.ID)
+		return nil
+	})
+}
+
+// GetWebhooks returns webhooks registered in tracker
+func (admin *Admin) GetWebhooks(req GetWebhooksRequest, res *GetWebhooksResponse) error {
+	return admin.call("GetWebhooks", req.Context, func(ctx context.Context) error {
+		if admin.Webhooks == nil {
+			return entities.NewServerError("Webhooks are not configured")
+		}
+		err := admin.Webhooks.GetWebhooks(ctx, req.Tracker, &res.Webhooks)
+		if err != nil {
+			return entities.NewLoggedError(l, ctx, err, "Failed to retrieve webhooks")
+		}
+		return nil
+	})
+}
+
+// DeleteWebhook removes webhook from tracker
+func (admin *Admin) DeleteWebhook(req DeleteWebhookRequest, res *DeleteWebhookResponse) error {
+	return admin.call("DeleteWebhook", req.Context, func(ctx context.Context) error {
+		if admin.Webhooks == nil {
+			return entities.NewServerError("Webhooks are not configured")
+		}
+		err := admin.Webhooks.DeleteWebhook(ctx, req.Tracker, req.WebhookID)
+		if err != nil {
+			return entities.NewLoggedError(l, ctx, err, "Failed to delete webhook")
+		}
+		l.NOTICE("[%s] Webhook %d deleted from tracker %d", tracing.ID(ctx), req.WebhookID, req.Tracker.ID)
+		return nil
+	})
+}
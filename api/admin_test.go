@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/qarea/ctxtg"
+	"github.com/qarea/ctxtg/ctxtgtest"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/maintenance"
+	"github.com/qarea/jirams/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminMaintenance(t *testing.T) {
+	a := assert.New(t)
+	mode := &maintenance.Mode{}
+	admin := NewAdminAPI("secret", mode)
+
+	state := maintenance.State{Trackers: []entities.TrackerID{1}, ETA: 1482624000}
+	err := admin.SetMaintenance(SetMaintenanceRequest{Context: AdminContext{Token: "wrong"}, State: state}, &SetMaintenanceResponse{})
+	a.Equal(entities.ErrUnauthorized, err)
+
+	err = admin.SetMaintenance(SetMaintenanceRequest{Context: AdminContext{Token: "secret"}, State: state}, &SetMaintenanceResponse{})
+	a.NoError(err)
+
+	var res GetMaintenanceResponse
+	a.NoError(admin.GetMaintenance(GetMaintenanceRequest{Context: AdminContext{Token: "secret"}}, &res))
+	a.Equal(state, res.State)
+
+	// admin API is disabled without token
+	admin = NewAdminAPI("", mode)
+	a.Equal(entities.ErrUnauthorized, admin.GetMaintenance(GetMaintenanceRequest{}, &res))
+}
+
+func TestMaintenance(t *testing.T) {
+	a := assert.New(t)
+	var token ctxtg.Token = "dsa"
+	p := &ctxtgtest.Parser{TokenExpected: token}
+	st := &TestTrackerClient{
+		getProjects: func(tracker entities.TrackerConfig, res *[]entities.Project) error {
+			a.Fail("tracker should not be called during maintenance")
+			return nil
+		},
+	}
+	mode := &maintenance.Mode{}
+	mode.Set(maintenance.State{Trackers: []entities.TrackerID{1}})
+
+	api := NewRPCAPI(st, p)
+	api.Maintenance = mode
+	var res GetProjectsResponse
+	err := api.GetProjects(GetProjectsRequest{
+		Context: ctxtg.Context{Token: token},
+		Tracker: entities.TrackerConfig{ID: 1},
+	}, &res)
+	a.Equal(entities.ErrMaintenance, err)
+
+	// unauthorized callers don't learn maintenance state
+	p.Err = entities.ErrUnauthorized
+	err = api.GetProjects(GetProjectsRequest{
+		Context: ctxtg.Context{Token: "wrong"},
+		Tracker: entities.TrackerConfig{ID: 1},
+	}, &res)
+	a.Equal(entities.ErrUnauthorized, err)
+}
+
+func TestAdminUsers(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	db, err := bolt.Open(filepath.Join(dir, "store.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	users := store.New(db)
+	_, _ = users.GetID(1, "alice")
+	_, _ = users.GetID(1, "bob")
+
+	admin := NewAdminAPI("secret", &maintenance.Mode{})
+	ctx := AdminContext{Token: "secret"}
+	var mappings GetUserMappingsResponse
+	a.Equal(entities.NewServerError("User store is not configured"), admin.GetUserMappings(GetUserMappingsRequest{Context: ctx}, &mappings))
+	admin.Users = users
+	a.Equal(entities.ErrUnauthorized, admin.GetUserMappings(GetUserMappingsRequest{}, &mappings))
+
+	a.NoError(admin.GetUserMappings(GetUserMappingsRequest{Context: ctx, TrackerID: 1}, &mappings))
+	a.Len(mappings.Mappings, 2)
+
+	var key GetUserKeyResponse
+	a.Equal(entities.ErrNotFound, admin.GetUserKey(GetUserKeyRequest{Context: ctx, TrackerID: 1, UserID: 3}, &key))
+	a.Equal(entities.NewServerError(store.ErrIDTaken.Error()),
+		admin.ReassignUser(ReassignUserRequest{Context: ctx, TrackerID: 1, Key: "alice", UserID: 2}, &ReassignUserResponse{}))
+	a.NoError(admin.MergeUsers(MergeUsersRequest{Context: ctx, TrackerID: 1, FromID: 2, ToID: 1}, &MergeUsersResponse{}))
+	var id GetUserIDResponse
+	a.NoError(admin.GetUserID(GetUserIDRequest{Context: ctx, Key: "bob"}, &id))
+	a.Equal(entities.UserID(1), id.UserID)
+
+	var verify VerifyUsersResponse
+	a.NoError(admin.VerifyUsers(VerifyUsersRequest{Context: ctx, Repair: true}, &verify))
+	a.Empty(verify.Problems)
+}
+
+func TestAdminProtect(t *testing.T) {
+	a := assert.New(t)
+	status := func(admin *Admin, auth string) int {
+		handler := admin.Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest("GET", "/status/breakers", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	admin := NewAdminAPI("secret", &maintenance.Mode{})
+	a.Equal(http.StatusOK, status(admin, "Bearer secret"))
+	a.Equal(http.StatusUnauthorized, status(admin, ""))
+	a.Equal(http.StatusUnauthorized, status(admin, "Bearer wrong"))
+	a.Equal(http.StatusUnauthorized, status(admin, "secret"))
+	a.Equal(http.StatusUnauthorized, status(NewAdminAPI("", &maintenance.Mode{}), "Bearer "), "disabled without token")
+}
@@ -40,11 +40,12 @@ type GetProjectIssuesResponse struct {
 	Issues []entities.Issue
 }
 
-// CreateIssueRequest request arguments
+// CreateIssueRequest request arguments, optional IdempotencyKey makes retries return the originally created issue
 type CreateIssueRequest struct {
-	Context ctxtg.Context
-	Tracker entities.TrackerConfig
-	Issue   entities.NewIssue
+	Context        ctxtg.Context
+	Tracker        entities.TrackerConfig
+	Issue          entities.NewIssue
+	IdempotencyKey string
 }
 
 // CreateIssueResponse response structure
@@ -64,6 +65,19 @@ type GetIssueResponse struct {
 	Issue entities.Issue
 }
 
+// GetIssuesRequest request arguments
+type GetIssuesRequest struct {
+	Context  ctxtg.Context
+	Tracker  entities.TrackerConfig
+	IssueIDs []entities.IssueID
+}
+
+// GetIssuesResponse response structure
+type GetIssuesResponse struct {
+	Issues   []entities.Issue
+	NotFound []entities.IssueID
+}
+
 // UpdateIssueProgressRequest request arguments
 type UpdateIssueProgressRequest struct {
 	Context  ctxtg.Context
@@ -74,15 +88,48 @@ type UpdateIssueProgressRequest struct {
 // UpdateIssueProgressResponse response structure
 type UpdateIssueProgressResponse struct{}
 
-// CreateReportRequest request arguments
+// CreateReportRequest request arguments, optional IdempotencyKey makes retries return the original result
 type CreateReportRequest struct {
+	Context        ctxtg.Context
+	Tracker        entities.TrackerConfig
+	Report         entities.Report
+	IdempotencyKey string
+}
+
+// CreateReportResponse response structure, Queued is set when tracker is unavailable
+// and report will be delivered in background
+type CreateReportResponse struct {
+	Queued        bool
+	PendingReport entities.PendingReport
+}
+
+// GetPendingReportsRequest request arguments
+type GetPendingReportsRequest struct {
 	Context ctxtg.Context
-	Tracker entities.TrackerConfig
-	Report  entities.Report
 }
 
-// CreateReportResponse response structure
-type CreateReportResponse struct{}
+// GetPendingReportsResponse response structure
+type GetPendingReportsResponse struct {
+	Reports []entities.PendingReport
+}
+
+// RetryPendingReportRequest request arguments
+type RetryPendingReportRequest struct {
+	Context ctxtg.Context
+	ID      uint64
+}
+
+// RetryPendingReportResponse response structure
+type RetryPendingReportResponse struct{}
+
+// CancelPendingReportRequest request arguments
+type CancelPendingReportRequest struct {
+	Context ctxtg.Context
+	ID      uint64
+}
+
+// CancelPendingReportResponse response structure
+type CancelPendingReportResponse struct{}
 
 // GetTotalReportsRequest request arguments
 type GetTotalReportsRequest struct {
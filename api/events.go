@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+
+	"github.com/qarea/ctxtg"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/events"
+	"github.com/qarea/jirams/tracing"
+)
+
+// SubscribeRequest request arguments, IssueID is zero to subscribe to all issues of the project
+type SubscribeRequest struct {
+	Context   ctxtg.Context
+	Tracker   entities.TrackerConfig
+	ProjectID entities.ProjectID
+	IssueID   entities.IssueID
+}
+
+// SubscribeResponse response structure
+type SubscribeResponse struct {
+	Topic events.Topic
+}
+
+// UnsubscribeRequest request arguments
+type UnsubscribeRequest struct {
+	Context ctxtg.Context
+	Topic   events.Topic
+}
+
+// UnsubscribeResponse response structure
+type UnsubscribeResponse struct{}
+
+// Events implements subscription RPC interface of a single connection
+type Events struct {
+	api        *API
+	subscriber *events.Subscriber
+}
+
+// NewEventsAPI creates subscription RPC interface delivering events to given subscriber
+func NewEventsAPI(api *API, subscriber *events.Subscriber) *Events {
+	return &Events{api: api, subscriber: subscriber}
+}
+
+// Subscribe starts pushing changes of project or issue to the connection
+func (e *Events) Subscribe(req SubscribeRequest, res *SubscribeResponse) (err error) {
+	err = e.api.call("Subscribe", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		if req.ProjectID == 0 && req.IssueID == 0 {
+			return entities.ErrInvalidRequest
+		}
+		res.Topic = events.Topic{TrackerID: req.Tracker.ID, ProjectID: req.ProjectID, IssueID: req.IssueID}
+		if err := e.subscriber.Subscribe(res.Topic, req.Tracker); err != nil {
+			l.WARN("[%s] Subscribe: %v", tracing.ID(ctx), err)
+			return entities.ErrTooManySubscriptions
+		}
+		return nil
+	})
+	return
+}
+
+// Unsubscribe stops pushing changes of the topic, it is allowed during maintenance
+func (e *Events) Unsubscribe(req UnsubscribeRequest, res *UnsubscribeResponse) (err error) {
+	err = e.api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
+		e.subscriber.Unsubscribe(req.Topic)
+		return nil
+	})
+	return
+}
@@ -2,13 +2,17 @@ package api
 
 import (
 	"context"
+	"fmt"
+	"time"
 
-	"github.com/powerman/narada-go/narada"
 	"github.com/qarea/ctxtg"
 	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/metrics"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing"
 )
 
-var l = narada.NewLog("api: ")
+var l = redact.NewLog("api: ")
 
 // NewRPCAPI creates an instance of API, implementing RPC interface
 func NewRPCAPI(client TrackerClient, parser ctxtg.TokenParser) *API {
@@ -17,26 +21,133 @@ func NewRPCAPI(client TrackerClient, parser ctxtg.TokenParser) *API {
 
 // TrackerClient defines interface for tracker client business logic implementation
 type TrackerClient interface {
-	GetProjects(tracker entities.TrackerConfig, res *[]entities.Project) error
-	GetCurrentUser(tracker entities.TrackerConfig, res *entities.User) error
-	GetProjectIssues(tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error
-	GetIssue(tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error
-	GetIssueByURL(tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error
-	CreateIssue(tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error
-	CreateReport(tracker entities.TrackerConfig, report entities.Report) error
-	GetTotalReports(tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error
+	GetProjects(ctx context.Context, tracker entities.TrackerConfig, res *[]entities.Project) error
+	GetCurrentUser(ctx context.Context, tracker entities.TrackerConfig, res *entities.User) error
+	GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error
+	GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error
+	GetIssues(ctx context.Context, tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error
+	GetIssueByURL(ctx context.Context, tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error
+	CreateIssue(ctx context.Context, tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error
+	CreateReport(ctx context.Context, tracker entities.TrackerConfig, report entities.Report) error
+	GetTotalReports(ctx context.Context, tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error
+}
+
+// MaintenanceChecker reports whether tracker is under maintenance
+type MaintenanceChecker interface {
+	Check(tracker entities.TrackerConfig) error
+}
+
+// RateLimiter takes a token from bucket identified by key, returning time to wait when none left.
+// Refund puts back token of allowed call which did not run.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration)
+	Refund(ctx context.Context, key string)
+}
+
+// TrackerValidator rejects tracker configs which can't be used
+type TrackerValidator interface {
+	ValidateTracker(ctx context.Context, tracker entities.TrackerConfig) error
+}
+
+// ReportQueue keeps reports for delivery while tracker is unavailable
+type ReportQueue interface {
+	Enqueue(userID ctxtg.UserID, tracker entities.TrackerConfig, report entities.Report, cause error) (entities.PendingReport, error)
+	List(userID ctxtg.UserID) ([]entities.PendingReport, error)
+	Retry(userID ctxtg.UserID, id uint64) error
+	Cancel(userID ctxtg.UserID, id uint64) error
+}
+
+// IdempotencyStore runs handler once per scope and key, returning stored result on repeated calls
+type IdempotencyStore interface {
+	Do(ctx context.Context, scope, key string, request, res interface{}, handler func() error) error
 }
 
 // API implements service RPC interface
 type API struct {
-	Client TrackerClient
-	Parser ctxtg.TokenParser
+	Client       TrackerClient
+	Parser       ctxtg.TokenParser
+	Maintenance  MaintenanceChecker
+	UserLimit    RateLimiter
+	TrackerLimit RateLimiter
+	// Trackers validates tracker config of every call before it is handled
+	Trackers TrackerValidator
+	// Outbox enables queueing of reports failed because tracker is unavailable
+	Outbox ReportQueue
+	// Idempotency enables support of idempotency keys in create methods
+	Idempotency IdempotencyStore
+}
+
+// call parses request context and runs the handler unless tracker is under maintenance,
+// its config is invalid or rate limit is exceeded, recording RPC telemetry
+func (api *API) call(method string, reqCtx ctxtg.Context, tracker entities.TrackerConfig, handler func(ctx context.Context, claims ctxtg.Claims) error) error {
+	started := time.Now()
+	err := api.Parser.ParseCtxWithClaims(reqCtx, func(ctx context.Context, claims ctxtg.Claims) error {
+		// maintenance state is reported to authorized callers only
+		if api.Maintenance != nil {
+			if err := api.Maintenance.Check(tracker); err != nil {
+				return err
+			}
+		}
+		ctx, span := tracing.Start(ctx, "API."+method)
+		l.DEBUG("[%s] %s", tracing.ID(ctx), method)
+		if api.Trackers != nil {
+			if err := api.Trackers.ValidateTracker(ctx, tracker); err != nil {
+				tracing.End(span, err)
+				return err
+			}
+		}
+		if err := api.limit(ctx, method, claims.UserID, tracker.ID); err != nil {
+			tracing.End(span, err)
+			return err
+		}
+		err := handler(ctx, claims)
+		tracing.End(span, err)
+		return err
+	})
+	metrics.ObserveRPC(method, started, err)
+	return err
+}
+
+// limit checks per-user and per-tracker rate limits, rejected call does not use tokens of any limit
+func (api *API) limit(ctx context.Context, method string, userID ctxtg.UserID, trackerID entities.TrackerID) error {
+	keys := []struct {
+		limiter RateLimiter
+		key     string
+	}{
+		{api.UserLimit, fmt.Sprintf("user:%d", userID)},
+		{api.TrackerLimit, fmt.Sprintf("tracker:%d", trackerID)},
+	}
+	for i, k := range keys {
+		if k.limiter == nil {
+			continue
+		}
+		if ok, retryAfter := k.limiter.Allow(ctx, k.key); !ok {
+			l.WARN("[%s] %s: rate limit exceeded for %s, retry after %v", tracing.ID(ctx), method, k.key, retryAfter)
+			// call is not made, so it should not count against limits already passed
+			for _, charged := range keys[:i] {
+				if charged.limiter != nil {
+					charged.limiter.Refund(ctx, charged.key)
+				}
+			}
+			return entities.NewRateLimitError(retryAfter)
+		}
+	}
+	return nil
+}
+
+// idempotent runs handler unless the same call was already made with given idempotency key
+func (api *API) idempotent(ctx context.Context, method, key string, userID ctxtg.UserID, tracker entities.TrackerConfig, request, res interface{}, handler func() error) error {
+	if key == "" || api.Idempotency == nil {
+		return handler()
+	}
+	scope := fmt.Sprintf("%s:%d:%d", method, userID, tracker.ID)
+	return api.Idempotency.Do(ctx, scope, key, request, res, handler)
 }
 
 // GetProjects provides corresponding API method
 func (api *API) GetProjects(req GetProjectsRequest, res *GetProjectsResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
-		err = api.Client.GetProjects(req.Tracker, &res.Projects)
+	err = api.call("GetProjects", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.Client.GetProjects(ctx, req.Tracker, &res.Projects)
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to retrieve projects")
 		}
@@ -47,8 +158,8 @@ func (api *API) GetProjects(req GetProjectsRequest, res *GetProjectsResponse) (e
 
 // GetCurrentUser provides corresponding API method
 func (api *API) GetCurrentUser(req GetCurrentUserRequest, res *GetCurrentUserResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
-		err = api.Client.GetCurrentUser(req.Tracker, &res.User)
+	err = api.call("GetCurrentUser", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.Client.GetCurrentUser(ctx, req.Tracker, &res.User)
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to retrieve current user")
 		}
@@ -59,8 +170,8 @@ func (api *API) GetCurrentUser(req GetCurrentUserRequest, res *GetCurrentUserRes
 
 // GetProjectIssues provides corresponding API method
 func (api *API) GetProjectIssues(req GetProjectIssuesRequest, res *GetProjectIssuesResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
-		err = api.Client.GetProjectIssues(req.Tracker, req.ProjectID, req.UserID, &res.Issues)
+	err = api.call("GetProjectIssues", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.Client.GetProjectIssues(ctx, req.Tracker, req.ProjectID, req.UserID, &res.Issues)
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to retrieve project issues")
 		}
@@ -71,9 +182,11 @@ func (api *API) GetProjectIssues(req GetProjectIssuesRequest, res *GetProjectIss
 
 // CreateIssue provides corresponding API method
 func (api *API) CreateIssue(req CreateIssueRequest, res *CreateIssueResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
+	err = api.call("CreateIssue", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
 		req.Issue.Assignee = entities.UserID(claims.UserID)
-		err = api.Client.CreateIssue(req.Tracker, req.Issue, &res.Issue)
+		err = api.idempotent(ctx, "CreateIssue", req.IdempotencyKey, claims.UserID, req.Tracker, req.Issue, res, func() error {
+			return api.Client.CreateIssue(ctx, req.Tracker, req.Issue, &res.Issue)
+		})
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to create issue")
 		}
@@ -84,8 +197,8 @@ func (api *API) CreateIssue(req CreateIssueRequest, res *CreateIssueResponse) (e
 
 // GetIssue provides corresponding API method
 func (api *API) GetIssue(req GetIssueRequest, res *GetIssueResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
-		err = api.Client.GetIssue(req.Tracker, req.IssueID, &res.Issue)
+	err = api.call("GetIssue", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.Client.GetIssue(ctx, req.Tracker, req.IssueID, &res.Issue)
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to retrieve issue")
 		}
@@ -94,10 +207,32 @@ func (api *API) GetIssue(req GetIssueRequest, res *GetIssueResponse) (err error)
 	return
 }
 
+// GetIssues provides corresponding API method
+func (api *API) GetIssues(req GetIssuesRequest, res *GetIssuesResponse) (err error) {
+	err = api.call("GetIssues", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.Client.GetIssues(ctx, req.Tracker, req.IssueIDs, &res.Issues, &res.NotFound)
+		if err != nil {
+			err = entities.NewLoggedError(l, ctx, err, "Failed to retrieve issues")
+		}
+		return err
+	})
+	return
+}
+
 // CreateReport provides corresponding API method
 func (api *API) CreateReport(req CreateReportRequest, res *CreateReportResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
-		err = api.Client.CreateReport(req.Tracker, req.Report)
+	err = api.call("CreateReport", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.idempotent(ctx, "CreateReport", req.IdempotencyKey, claims.UserID, req.Tracker, req.Report, res, func() (err error) {
+			err = api.Client.CreateReport(ctx, req.Tracker, req.Report)
+			if err != nil && api.Outbox != nil && entities.IsUnavailable(err) {
+				res.PendingReport, err = api.Outbox.Enqueue(claims.UserID, req.Tracker, req.Report, err)
+				if err == nil {
+					l.NOTICE("[%s] Report for issue %d queued as %d", tracing.ID(ctx), req.Report.IssueID, res.PendingReport.ID)
+					res.Queued = true
+				}
+			}
+			return
+		})
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to create report")
 		}
@@ -106,10 +241,49 @@ func (api *API) CreateReport(req CreateReportRequest, res *CreateReportResponse)
 	return
 }
 
+// GetPendingReports returns reports of current user waiting for delivery
+func (api *API) GetPendingReports(req GetPendingReportsRequest, res *GetPendingReportsResponse) (err error) {
+	err = api.outbox(req.Context, func(ctx context.Context, claims ctxtg.Claims) (err error) {
+		res.Reports, err = api.Outbox.List(claims.UserID)
+		return
+	})
+	return
+}
+
+// RetryPendingReport schedules immediate delivery of current user's report
+func (api *API) RetryPendingReport(req RetryPendingReportRequest, res *RetryPendingReportResponse) (err error) {
+	err = api.outbox(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
+		return api.Outbox.Retry(claims.UserID, req.ID)
+	})
+	return
+}
+
+// CancelPendingReport removes current user's report from delivery queue
+func (api *API) CancelPendingReport(req CancelPendingReportRequest, res *CancelPendingReportResponse) (err error) {
+	err = api.outbox(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
+		return api.Outbox.Cancel(claims.UserID, req.ID)
+	})
+	return
+}
+
+// outbox runs handler of pending reports method, these methods do not access tracker and work during maintenance
+func (api *API) outbox(reqCtx ctxtg.Context, handler func(ctx context.Context, claims ctxtg.Claims) error) error {
+	if api.Outbox == nil {
+		return entities.NewServerError("Reports queue is disabled")
+	}
+	return api.Parser.ParseCtxWithClaims(reqCtx, func(ctx context.Context, claims ctxtg.Claims) error {
+		err := handler(ctx, claims)
+		if err != nil {
+			err = entities.NewLoggedError(l, ctx, err, "Failed to process pending reports")
+		}
+		return err
+	})
+}
+
 // GetTotalReports provides corresponding API method
 func (api *API) GetTotalReports(req GetTotalReportsRequest, res *GetTotalReportsResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
-		err = api.Client.GetTotalReports(req.Tracker, req.Date, &res.Total)
+	err = api.call("GetTotalReports", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.Client.GetTotalReports(ctx, req.Tracker, req.Date, &res.Total)
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to retrieve reports")
 		}
@@ -120,8 +294,8 @@ func (api *API) GetTotalReports(req GetTotalReportsRequest, res *GetTotalReports
 
 // GetIssueByURL provides corresponding API method
 func (api *API) GetIssueByURL(req GetIssueByURLRequest, res *GetIssueByURLResponse) (err error) {
-	err = api.Parser.ParseCtxWithClaims(req.Context, func(ctx context.Context, claims ctxtg.Claims) error {
-		err = api.Client.GetIssueByURL(req.Tracker, req.IssueURL, &res.Issue, &res.ProjectID)
+	err = api.call("GetIssueByURL", req.Context, req.Tracker, func(ctx context.Context, claims ctxtg.Claims) error {
+		err = api.Client.GetIssueByURL(ctx, req.Tracker, req.IssueURL, &res.Issue, &res.ProjectID)
 		if err != nil {
 			err = entities.NewLoggedError(l, ctx, err, "Failed to retrieve issue")
 		}
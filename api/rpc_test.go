@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"testing"
 
+	"github.com/powerman/rpc-codec/jsonrpc2"
 	"github.com/qarea/ctxtg"
 	"github.com/qarea/ctxtg/ctxtgtest"
 	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/ratelimit"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,40 +19,45 @@ type TestTrackerClient struct {
 	getProjectIssues func(tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error
 	createIssue      func(tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error
 	getIssue         func(tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error
+	getIssues        func(tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error
 	createReport     func(tracker entities.TrackerConfig, report entities.Report) error
 	getTotalReports  func(tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error
 	getIssueByUrl    func(tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error
 }
 
-func (t *TestTrackerClient) GetProjects(tracker entities.TrackerConfig, res *[]entities.Project) error {
+func (t *TestTrackerClient) GetProjects(ctx context.Context, tracker entities.TrackerConfig, res *[]entities.Project) error {
 	return t.getProjects(tracker, res)
 }
 
-func (t *TestTrackerClient) GetCurrentUser(tracker entities.TrackerConfig, res *entities.User) error {
+func (t *TestTrackerClient) GetCurrentUser(ctx context.Context, tracker entities.TrackerConfig, res *entities.User) error {
 	return t.getCurrentUser(tracker, res)
 }
 
-func (t *TestTrackerClient) GetProjectIssues(tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
+func (t *TestTrackerClient) GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
 	return t.getProjectIssues(tracker, projectID, userID, res)
 }
 
-func (t *TestTrackerClient) CreateIssue(tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error {
+func (t *TestTrackerClient) CreateIssue(ctx context.Context, tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error {
 	return t.createIssue(tracker, issue, res)
 }
 
-func (t *TestTrackerClient) GetIssue(tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
+func (t *TestTrackerClient) GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
 	return t.getIssue(tracker, issueID, res)
 }
 
-func (t *TestTrackerClient) CreateReport(tracker entities.TrackerConfig, report entities.Report) error {
+func (t *TestTrackerClient) GetIssues(ctx context.Context, tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error {
+	return t.getIssues(tracker, issueIDs, res, notFound)
+}
+
+func (t *TestTrackerClient) CreateReport(ctx context.Context, tracker entities.TrackerConfig, report entities.Report) error {
 	return t.createReport(tracker, report)
 }
 
-func (t *TestTrackerClient) GetTotalReports(tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error {
+func (t *TestTrackerClient) GetTotalReports(ctx context.Context, tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error {
 	return t.getTotalReports(tracker, date, res)
 }
 
-func (t *TestTrackerClient) GetIssueByURL(tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error {
+func (t *TestTrackerClient) GetIssueByURL(ctx context.Context, tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error {
 	return t.getIssueByUrl(tracker, issueURL, res, res2)
 }
 
@@ -97,7 +105,7 @@ func TestGetProjects(t *testing.T) {
 		},
 	}
 
-	api := API{st, p}
+	api := API{Client: st, Parser: p}
 	var res GetProjectsResponse
 	err := api.GetProjects(req, &res)
 	a.NoError(err)
@@ -140,7 +148,7 @@ func TestGetProjectsWithClientError(t *testing.T) {
 		},
 	}
 
-	api := API{st, p}
+	api := API{Client: st, Parser: p}
 	var res GetProjectsResponse
 	err := api.GetProjects(req, &res)
 	//a.Empty() look here
@@ -182,7 +190,7 @@ func TestGetCurrentUser(t *testing.T) {
 		},
 	}
 
-	api := API{st, p}
+	api := API{Client: st, Parser: p}
 	var res GetCurrentUserResponse
 	err := api.GetCurrentUser(req, &res)
 	a.NoError(err)
@@ -219,7 +227,7 @@ func TestGetCurrentUserWithError(t *testing.T) {
 		},
 	}
 
-	api := API{st, p}
+	api := API{Client: st, Parser: p}
 	var res GetCurrentUserResponse
 	err := api.GetCurrentUser(req, &res)
 	a.NotNil(err)
@@ -307,7 +315,7 @@ func TestGetProjectIssuesWithError(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res GetProjectIssuesResponse
 	err := api.GetProjectIssues(req, &res)
 	a.Error(err)
@@ -347,7 +355,7 @@ func TestCreateIssue(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res CreateIssueResponse
 	err := api.CreateIssue(req, &res)
 	a.NoError(err)
@@ -386,7 +394,7 @@ func TestCreateIssueWithError(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res CreateIssueResponse
 	err := api.CreateIssue(req, &res)
 	a.NotNil(err)
@@ -426,7 +434,7 @@ func TestGetIssue(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res GetIssueResponse
 	err := api.GetIssue(req, &res)
 	a.Equal(iss, res.Issue)
@@ -465,12 +473,83 @@ func TestGetIssueWithError(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res GetIssueResponse
 	err := api.GetIssue(req, &res)
 	a.Error(err)
 }
 
+func TestGetIssues(t *testing.T) {
+	a := assert.New(t)
+	var uid ctxtg.UserID = 1
+	var token ctxtg.Token = "dsa"
+	p := &ctxtgtest.Parser{
+		TokenExpected: token,
+		Claims: ctxtg.Claims{
+			UserID: uid,
+		},
+		Err: nil,
+	}
+
+	req := GetIssuesRequest{
+		Context: ctxtg.Context{Token: token},
+		Tracker: entities.TrackerConfig{
+			ID:  1,
+			URL: "http://tracker.com",
+			Credentials: entities.TrackerCredentials{
+				Login:    "login",
+				Password: "password",
+			},
+		},
+		IssueIDs: []entities.IssueID{1, 2},
+	}
+	issues := []entities.Issue{{ID: 1, URL: "somesite.com", Title: "title"}}
+	st := &TestTrackerClient{
+		getIssues: func(tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error {
+			a.Equal(req.Tracker, tracker)
+			a.Equal(req.IssueIDs, issueIDs)
+			*res = issues
+			*notFound = []entities.IssueID{2}
+			return nil
+		},
+	}
+
+	api := &API{Client: st, Parser: p}
+	var res GetIssuesResponse
+	err := api.GetIssues(req, &res)
+	a.NoError(err)
+	a.Equal(issues, res.Issues)
+	a.Equal([]entities.IssueID{2}, res.NotFound)
+}
+
+func TestGetIssuesWithError(t *testing.T) {
+	a := assert.New(t)
+	var uid ctxtg.UserID = 1
+	var token ctxtg.Token = "dsa"
+	p := &ctxtgtest.Parser{
+		TokenExpected: token,
+		Claims: ctxtg.Claims{
+			UserID: uid,
+		},
+		Err: nil,
+	}
+
+	req := GetIssuesRequest{
+		Context:  ctxtg.Context{Token: token},
+		IssueIDs: []entities.IssueID{1},
+	}
+	st := &TestTrackerClient{
+		getIssues: func(tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error {
+			return errors.New("Error while getting issues")
+		},
+	}
+
+	api := &API{Client: st, Parser: p}
+	var res GetIssuesResponse
+	err := api.GetIssues(req, &res)
+	a.Error(err)
+}
+
 func TestCreateReport(t *testing.T) {
 
 	a := assert.New(t)
@@ -506,7 +585,7 @@ func TestCreateReport(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res CreateReportResponse
 	err := api.CreateReport(req, &res)
 	a.NoError(err)
@@ -547,7 +626,7 @@ func TestCreateReportWithError(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res CreateReportResponse
 	err := api.CreateReport(req, &res)
 	a.NotNil(err)
@@ -586,7 +665,7 @@ func TestGetTotalReports(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res GetTotalReportsResponse
 	err := api.GetTotalReports(req, &res)
 	a.Equal(r, res.Total, "Should be equal")
@@ -624,7 +703,7 @@ func TestGetTotalReportsWithError(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res GetTotalReportsResponse
 	err := api.GetTotalReports(req, &res)
 	a.NotNil(err)
@@ -665,7 +744,7 @@ func TestGetIssueByURL(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res GetIssueByURLResponse
 	err := api.GetIssueByURL(req, &res)
 	a.NoError(err)
@@ -704,8 +783,179 @@ func TestGetIssueByURLWithError(t *testing.T) {
 		},
 	}
 
-	api := &API{st, p}
+	api := &API{Client: st, Parser: p}
 	var res GetIssueByURLResponse
 	err := api.GetIssueByURL(req, &res)
 	a.NotNil(err)
 }
+
+func TestRateLimit(t *testing.T) {
+	a := assert.New(t)
+	var token ctxtg.Token = "dsa"
+	p := &ctxtgtest.Parser{
+		TokenExpected: token,
+		Claims: ctxtg.Claims{
+			UserID: 1,
+		},
+	}
+	calls := 0
+	st := &TestTrackerClient{
+		getProjects: func(tracker entities.TrackerConfig, res *[]entities.Project) error {
+			calls++
+			return nil
+		},
+	}
+	api := &API{Client: st, Parser: p, UserLimit: ratelimit.New(1, 2)}
+	req := GetProjectsRequest{
+		Context: ctxtg.Context{Token: token},
+		Tracker: entities.TrackerConfig{ID: 1},
+	}
+	var res GetProjectsResponse
+	a.NoError(api.GetProjects(req, &res))
+	a.NoError(api.GetProjects(req, &res))
+	err := api.GetProjects(req, &res)
+	if a.IsType(&jsonrpc2.Error{}, err) {
+		a.Equal(entities.ErrRateLimited.Code, err.(*jsonrpc2.Error).Code)
+		a.Equal(entities.RateLimitInfo{RetryAfter: 1}, err.(*jsonrpc2.Error).Data)
+	}
+	a.Equal(2, calls)
+
+	api.UserLimit = nil
+	api.TrackerLimit = ratelimit.New(1, 1)
+	a.NoError(api.GetProjects(req, &res))
+	err = api.GetProjects(req, &res)
+	if a.IsType(&jsonrpc2.Error{}, err) {
+		a.Equal(entities.ErrRateLimited.Code, err.(*jsonrpc2.Error).Code)
+	}
+	a.Equal(3, calls)
+
+	// calls rejected by tracker limit do not use user tokens
+	api.UserLimit = ratelimit.New(1, 1)
+	a.Error(api.GetProjects(req, &res))
+	api.TrackerLimit = nil
+	a.NoError(api.GetProjects(req, &res))
+	a.Equal(4, calls)
+}
+
+type testValidator struct{}
+
+func (testValidator) ValidateTracker(ctx context.Context, tracker entities.TrackerConfig) error {
+	if tracker.URL == "" {
+		return entities.ErrInvalidTrackerURL
+	}
+	return nil
+}
+
+func TestValidateTracker(t *testing.T) {
+	a := assert.New(t)
+	var token ctxtg.Token = "dsa"
+	p := &ctxtgtest.Parser{TokenExpected: token, Claims: ctxtg.Claims{UserID: 1}}
+	calls := 0
+	st := &TestTrackerClient{
+		getProjects: func(tracker entities.TrackerConfig, res *[]entities.Project) error {
+			calls++
+			return nil
+		},
+		getIssue: func(tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
+			calls++
+			return nil
+		},
+	}
+	api := &API{Client: st, Parser: p, Trackers: testValidator{}}
+	ctx := ctxtg.Context{Token: token}
+	a.Equal(entities.ErrInvalidTrackerURL, api.GetProjects(GetProjectsRequest{Context: ctx, Tracker: entities.TrackerConfig{ID: 1}}, &GetProjectsResponse{}))
+	a.Equal(entities.ErrInvalidTrackerURL, api.GetIssue(GetIssueRequest{Context: ctx, Tracker: entities.TrackerConfig{ID: 1}, IssueID: 1}, &GetIssueResponse{}))
+	a.Equal(0, calls)
+	a.NoError(api.GetProjects(GetProjectsRequest{Context: ctx, Tracker: entities.TrackerConfig{ID: 1, URL: "https://tracker.com"}}, &GetProjectsResponse{}))
+	a.Equal(1, calls)
+}
+
+type testQueue struct {
+	queued []entities.Report
+}
+
+func (q *testQueue) Enqueue(userID ctxtg.UserID, tracker entities.TrackerConfig, report entities.Report, cause error) (entities.PendingReport, error) {
+	q.queued = append(q.queued, report)
+	return entities.PendingReport{ID: uint64(len(q.queued)), TrackerID: tracker.ID, Report: report, Status: "pending"}, nil
+}
+
+func (q *testQueue) List(userID ctxtg.UserID) ([]entities.PendingReport, error) { return nil, nil }
+func (q *testQueue) Retry(userID ctxtg.UserID, id uint64) error                 { return nil }
+func (q *testQueue) Cancel(userID ctxtg.UserID, id uint64) error                { return nil }
+
+func TestCreateReportQueued(t *testing.T) {
+	a := assert.New(t)
+	var token ctxtg.Token = "dsa"
+	p := &ctxtgtest.Parser{TokenExpected: token, Claims: ctxtg.Claims{UserID: 1}}
+	clientErr := entities.ErrServerUnavailable
+	st := &TestTrackerClient{
+		createReport: func(tracker entities.TrackerConfig, report entities.Report) error {
+			return clientErr
+		},
+	}
+	queue := &testQueue{}
+	api := &API{Client: st, Parser: p, Outbox: queue}
+	req := CreateReportRequest{
+		Context: ctxtg.Context{Token: token},
+		Tracker: entities.TrackerConfig{ID: 1},
+		Report:  entities.Report{IssueID: 5},
+	}
+
+	var res CreateReportResponse
+	a.NoError(api.CreateReport(req, &res))
+	a.True(res.Queued)
+	a.Equal(uint64(1), res.PendingReport.ID)
+
+	// other errors are not queued
+	clientErr = entities.ErrInvalidCredentials
+	res = CreateReportResponse{}
+	a.Equal(entities.ErrInvalidCredentials, api.CreateReport(req, &res))
+	a.False(res.Queued)
+	a.Len(queue.queued, 1)
+}
+
+type testIdempotency map[string]CreateIssueResponse
+
+func (s testIdempotency) Do(_ context.Context, scope, key string, request, res interface{}, handler func() error) error {
+	if stored, ok := s[scope+key]; ok {
+		*res.(*CreateIssueResponse) = stored
+		return nil
+	}
+	if err := handler(); err != nil {
+		return err
+	}
+	s[scope+key] = *res.(*CreateIssueResponse)
+	return nil
+}
+
+func TestCreateIssueIdempotent(t *testing.T) {
+	a := assert.New(t)
+	var token ctxtg.Token = "dsa"
+	p := &ctxtgtest.Parser{TokenExpected: token, Claims: ctxtg.Claims{UserID: 1}}
+	calls := 0
+	st := &TestTrackerClient{
+		createIssue: func(tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error {
+			calls++
+			*res = entities.Issue{ID: entities.IssueID(calls)}
+			return nil
+		},
+	}
+	api := &API{Client: st, Parser: p, Idempotency: testIdempotency{}}
+	req := CreateIssueRequest{
+		Context:        ctxtg.Context{Token: token},
+		Tracker:        entities.TrackerConfig{ID: 1},
+		IdempotencyKey: "key",
+	}
+	for i := 0; i < 2; i++ {
+		var res CreateIssueResponse
+		a.NoError(api.CreateIssue(req, &res))
+		a.Equal(entities.IssueID(1), res.Issue.ID)
+	}
+	a.Equal(1, calls)
+
+	// calls without key are not deduplicated
+	req.IdempotencyKey = ""
+	var res CreateIssueResponse
+	a.NoError(api.CreateIssue(req, &res))
+	a.Equal(2, calls)
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/store"
+	"github.com/qarea/jirams/tracing"
+)
+
+// UserMappings provides inspection and repair of user key to ID mapping
+type UserMappings interface {
+	List(trackerID entities.TrackerID) ([]store.Mapping, error)
+	GetKey(trackerID entities.TrackerID, userID entities.UserID) (string, error)
+	LookupID(key entities.UserKey) (entities.UserID, error)
+	Reassign(trackerID entities.TrackerID, key entities.UserKey, userID entities.UserID) error
+	Merge(trackerID entities.TrackerID, fromID, toID entities.UserID) error
+	DeleteTracker(trackerID entities.TrackerID) (int, error)
+	Export() (store.Dump, error)
+	Import(dump store.Dump) error
+	Verify() ([]store.Problem, error)
+	Repair() ([]store.Problem, error)
+}
+
+// GetUserMappingsRequest request arguments, zero TrackerID returns mappings of all trackers
+type GetUserMappingsRequest struct {
+	Context   AdminContext
+	TrackerID entities.TrackerID
+}
+
+// GetUserMappingsResponse response structure
+type GetUserMappingsResponse struct {
+	Mappings []store.Mapping
+}
+
+// GetUserKeyRequest request arguments
+type GetUserKeyRequest struct {
+	Context   AdminContext
+	TrackerID entities.TrackerID
+	UserID    entities.UserID
+}
+
+// GetUserKeyResponse response structure
+type GetUserKeyResponse struct {
+	Key string
+}
+
+// GetUserIDRequest request arguments
+type GetUserIDRequest struct {
+	Context AdminContext
+	Key     entities.UserKey
+}
+
+// GetUserIDResponse response structure
+type GetUserIDResponse struct {
+	UserID entities.UserID
+}
+
+// ReassignUserRequest request arguments
+type ReassignUserRequest struct {
+	Context   AdminContext
+	TrackerID entities.TrackerID
+	Key       entities.UserKey
+	UserID    entities.UserID
+}
+
+// ReassignUserResponse response structure
+type ReassignUserResponse struct{}
+
+// MergeUsersRequest request arguments
+type MergeUsersRequest struct {
+	Context   AdminContext
+	TrackerID entities.TrackerID
+	FromID    entities.UserID
+	ToID      entities.UserID
+}
+
+// MergeUsersResponse response structure
+type MergeUsersResponse struct{}
+
+// DeleteTrackerUsersRequest request arguments
+type DeleteTrackerUsersRequest struct {
+	Context   AdminContext
+	TrackerID entities.TrackerID
+}
+
+// DeleteTrackerUsersResponse response structure
+type DeleteTrackerUsersResponse struct {
+	Deleted int
+}
+
+// ExportUsersRequest request arguments
+type ExportUsersRequest struct {
+	Context AdminContext
+}
+
+// ExportUsersResponse response structure
+type ExportUsersResponse struct {
+	Dump store.Dump
+}
+
+// ImportUsersRequest request arguments
+type ImportUsersRequest struct {
+	Context AdminContext
+	Dump    store.Dump
+}
+
+// ImportUsersResponse response structure
+type ImportUsersResponse struct{}
+
+// VerifyUsersRequest request arguments, Repair fixes problems which do not need a decision
+type VerifyUsersRequest struct {
+	Context AdminContext
+	Repair  bool
+}
+
+// VerifyUsersResponse response structure
+type VerifyUsersResponse struct {
+	Problems []store.Problem
+	Repaired []store.Problem
+}
+
+// GetUserMappings returns user mappings of tracker
+func (admin *Admin) GetUserMappings(req GetUserMappingsRequest, res *GetUserMappingsResponse) error {
+	return admin.users("GetUserMappings", req.Context, func(ctx context.Context) (err error) {
+		res.Mappings, err = admin.Users.List(req.TrackerID)
+		return
+	})
+}
+
+// GetUserKey returns user key mapped to ID
+func (admin *Admin) GetUserKey(req GetUserKeyRequest, res *GetUserKeyResponse) error {
+	return admin.users("GetUserKey", req.Context, func(ctx context.Context) (err error) {
+		res.Key, err = admin.Users.GetKey(req.TrackerID, req.UserID)
+		if err == nil && res.Key == "" {
+			err = store.ErrMappingNotFound
+		}
+		return
+	})
+}
+
+// GetUserID returns ID mapped to user key without creating it
+func (admin *Admin) GetUserID(req GetUserIDRequest, res *GetUserIDResponse) error {
+	return admin.users("GetUserID", req.Context, func(ctx context.Context) (err error) {
+		res.UserID, err = admin.Users.LookupID(req.Key)
+		return
+	})
+}
+
+// ReassignUser maps user key to another ID
+func (admin *Admin) ReassignUser(req ReassignUserRequest, res *ReassignUserResponse) error {
+	return admin.users("ReassignUser", req.Context, func(ctx context.Context) error {
+		if err := admin.Users.Reassign(req.TrackerID, req.Key, req.UserID); err != nil {
+			return err
+		}
+		l.NOTICE("[%s] User key %q of tracker %d reassigned to %d by admin", tracing.ID(ctx), req.Key, req.TrackerID, req.UserID)
+		return nil
+	})
+}
+
+// MergeUsers merges duplicate user ID into another one
+func (admin *Admin) MergeUsers(req MergeUsersRequest, res *MergeUsersResponse) error {
+	return admin.users("MergeUsers", req.Context, func(ctx context.Context) error {
+		if err := admin.Users.Merge(req.TrackerID, req.FromID, req.ToID); err != nil {
+			return err
+		}
+		l.NOTICE("[%s] User %d of tracker %d merged into %d by admin", tracing.ID(ctx), req.FromID, req.TrackerID, req.ToID)
+		return nil
+	})
+}
+
+// DeleteTrackerUsers removes all user mappings of tracker
+func (admin *Admin) DeleteTrackerUsers(req DeleteTrackerUsersRequest, res *DeleteTrackerUsersResponse) error {
+	return admin.users("DeleteTrackerUsers", req.Context, func(ctx context.Context) (err error) {
+		if res.Deleted, err = admin.Users.DeleteTracker(req.TrackerID); err != nil {
+			return err
+		}
+		l.NOTICE("[%s] %d user mappings of tracker %d deleted by admin", tracing.ID(ctx), res.Deleted, req.TrackerID)
+		return nil
+	})
+}
+
+// ExportUsers returns all user mappings
+func (admin *Admin) ExportUsers(req ExportUsersRequest, res *ExportUsersResponse) error {
+	return admin.users("ExportUsers", req.Context, func(ctx context.Context) (err error) {
+		res.Dump, err = admin.Users.Export()
+		return
+	})
+}
+
+// ImportUsers replaces all user mappings
+func (admin *Admin) ImportUsers(req ImportUsersRequest, res *ImportUsersResponse) error {
+	return admin.users("ImportUsers", req.Context, func(ctx context.Context) error {
+		if err := admin.Users.Import(req.Dump); err != nil {
+			return err
+		}
+		l.NOTICE("[%s] %d user mappings imported by admin", tracing.ID(ctx), len(req.Dump.Users))
+		return nil
+	})
+}
+
+// VerifyUsers checks consistency of user mappings, optionally repairing them
+func (admin *Admin) VerifyUsers(req VerifyUsersRequest, res *VerifyUsersResponse) error {
+	return admin.users("VerifyUsers", req.Context, func(ctx context.Context) (err error) {
+		if req.Repair {
+			if res.Repaired, err = admin.Users.Repair(); err != nil {
+				return err
+			}
+			if len(res.Repaired) > 0 {
+				l.NOTICE("[%s] %d user mapping problems repaired by admin", tracing.ID(ctx), len(res.Repaired))
+			}
+		}
+		res.Problems, err = admin.Users.Verify()
+		return
+	})
+}
+
+// users authorizes request and converts store errors of handler to API errors
+func (admin *Admin) users(method string, actx AdminContext, handler func(ctx context.Context) error) error {
+	return admin.call(method, actx, func(ctx context.Context) error {
+		if admin.Users == nil {
+			return entities.NewServerError("User store is not configured")
+		}
+		switch err := handler(ctx); err {
+		case nil:
+			return nil
+		case store.ErrMappingNotFound:
+			return entities.ErrNotFound
+		case store.ErrIDTaken, store.ErrMergeSameID:
+			return entities.NewServerError(err.Error())
+		default:
+			return entities.NewLoggedError(l, ctx, err, "User store failure")
+		}
+	})
+}
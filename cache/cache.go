@@ -0,0 +1,233 @@
+// Package cache provides caching decorator for tracker client keeping responses in process memory or Redis
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/qarea/jirams/api"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+var log = redact.NewLog("cache: ")
+
+const (
+	methodProjects      = "GetProjects"
+	methodCurrentUser   = "GetCurrentUser"
+	methodProjectIssues = "GetProjectIssues"
+
+	sweepInterval = time.Minute
+)
+
+// TTL defines how long results of each cached method are kept, zero disables caching of the method
+type TTL struct {
+	Projects      time.Duration
+	CurrentUser   time.Duration
+	ProjectIssues time.Duration
+}
+
+// Stats contains cache usage counters
+type Stats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+	Entries       int
+}
+
+// Client implements api.TrackerClient caching responses of another client
+type Client struct {
+	Next    api.TrackerClient
+	TTL     TTL
+	Storage Storage
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewClient creates caching decorator around given tracker client keeping responses in process memory
+func NewClient(next api.TrackerClient, ttl TTL) *Client {
+	return &Client{
+		Next:    next,
+		TTL:     ttl,
+		Storage: NewMemory(),
+	}
+}
+
+// GetProjects returns cached list of projects with their issue types
+func (c *Client) GetProjects(ctx context.Context, tracker entities.TrackerConfig, res *[]entities.Project) error {
+	k := newKey(methodProjects, tracker, 0)
+	if c.get(ctx, k, res) {
+		return nil
+	}
+	if err := c.Next.GetProjects(ctx, tracker, res); err != nil {
+		return err
+	}
+	c.set(ctx, k, *res, c.TTL.Projects)
+	return nil
+}
+
+// GetCurrentUser returns cached current user information
+func (c *Client) GetCurrentUser(ctx context.Context, tracker entities.TrackerConfig, res *entities.User) error {
+	k := newKey(methodCurrentUser, tracker, 0)
+	if c.get(ctx, k, res) {
+		return nil
+	}
+	if err := c.Next.GetCurrentUser(ctx, tracker, res); err != nil {
+		return err
+	}
+	c.set(ctx, k, *res, c.TTL.CurrentUser)
+	return nil
+}
+
+// GetProjectIssues returns cached list of project issues assigned to current user
+func (c *Client) GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
+	k := newKey(methodProjectIssues, tracker, projectID)
+	if c.get(ctx, k, res) {
+		return nil
+	}
+	if err := c.Next.GetProjectIssues(ctx, tracker, projectID, userID, res); err != nil {
+		return err
+	}
+	c.set(ctx, k, *res, c.TTL.ProjectIssues)
+	return nil
+}
+
+// GetIssue is not cached as issue spent time changes frequently
+func (c *Client) GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
+	return c.Next.GetIssue(ctx, tracker, issueID, res)
+}
+
+// GetIssues is not cached as issue spent time changes frequently
+func (c *Client) GetIssues(ctx context.Context, tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error {
+	return c.Next.GetIssues(ctx, tracker, issueIDs, res, notFound)
+}
+
+// GetIssueByURL is not cached
+func (c *Client) GetIssueByURL(ctx context.Context, tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error {
+	return c.Next.GetIssueByURL(ctx, tracker, issueURL, res, res2)
+}
+
+// CreateIssue creates issue and invalidates cached issue lists of its project
+func (c *Client) CreateIssue(ctx context.Context, tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error {
+	if err := c.Next.CreateIssue(ctx, tracker, issue, res); err != nil {
+		return err
+	}
+	c.InvalidateProject(tracker.ID, issue.ProjectID)
+	return nil
+}
+
+// CreateReport creates report and invalidates cached issue lists of the tracker as spent time has changed
+func (c *Client) CreateReport(ctx context.Context, tracker entities.TrackerConfig, report entities.Report) error {
+	if err := c.Next.CreateReport(ctx, tracker, report); err != nil {
+		return err
+	}
+	c.InvalidateProjectIssues(tracker.ID)
+	return nil
+}
+
+// GetTotalReports is not cached
+func (c *Client) GetTotalReports(ctx context.Context, tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error {
+	return c.Next.GetTotalReports(ctx, tracker, date, res)
+}
+
+// InvalidateProjectIssues drops all cached issue lists of the tracker
+func (c *Client) InvalidateProjectIssues(trackerID entities.TrackerID) {
+	c.invalidate(fmt.Sprintf("%d/%s/", trackerID, methodProjectIssues))
+}
+
+// InvalidateProject drops cached issue lists of the project
+func (c *Client) InvalidateProject(trackerID entities.TrackerID, projectID entities.ProjectID) {
+	c.invalidate(fmt.Sprintf("%d/%s/%d/", trackerID, methodProjectIssues, projectID))
+}
+
+// InvalidateTracker drops all cached data of the tracker
+func (c *Client) InvalidateTracker(trackerID entities.TrackerID) {
+	c.invalidate(fmt.Sprintf("%d/", trackerID))
+}
+
+// Stats returns current cache usage counters, Hits, Misses and Invalidations are counted by this instance only
+func (c *Client) Stats() Stats {
+	entries, err := c.Storage.Len()
+	if err != nil {
+		log.WARN("Failed to count entries: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = entries
+	return stats
+}
+
+// StatsHandler returns HTTP handler reporting cache usage counters as JSON
+func (c *Client) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c.Stats())
+	})
+}
+
+// get decodes cached value into res, storage failures are handled as misses
+func (c *Client) get(ctx context.Context, k string, res interface{}) bool {
+	data, ok, err := c.Storage.Get(k)
+	if err != nil {
+		log.WARN("[%s] Failed to get %s: %v", traceid.FromContext(ctx), k, err)
+	}
+	if ok {
+		if err := json.Unmarshal(data, res); err != nil {
+			log.WARN("[%s] Failed to decode %s: %v", traceid.FromContext(ctx), k, err)
+			ok = false
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !ok {
+		c.stats.Misses++
+		return false
+	}
+	c.stats.Hits++
+	return true
+}
+
+func (c *Client) set(ctx context.Context, k string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = c.Storage.Set(k, data, ttl)
+	}
+	if err != nil {
+		log.WARN("[%s] Failed to set %s: %v", traceid.FromContext(ctx), k, err)
+	}
+}
+
+func (c *Client) invalidate(prefix string) {
+	count, err := c.Storage.DeletePrefix(prefix)
+	if err != nil {
+		// stale entries will be dropped on expiration
+		log.ERR("Failed to invalidate %s: %v", prefix, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Invalidations += uint64(count)
+}
+
+// newKey makes key grouping entries by tracker, method and project to invalidate them by prefix
+func newKey(method string, tracker entities.TrackerConfig, projectID entities.ProjectID) string {
+	return fmt.Sprintf("%d/%s/%d/%s", tracker.ID, method, projectID, fingerprint(tracker))
+}
+
+// fingerprint identifies tracker URL and credentials without keeping password in memory
+func fingerprint(tracker entities.TrackerConfig) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(tracker.URL + "\x00" + tracker.Credentials.Login + "\x00" + tracker.Credentials.Password))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingClient struct {
+	calls map[string]int
+	err   error
+}
+
+func (t *countingClient) call(method string) error {
+	if t.calls == nil {
+		t.calls = make(map[string]int)
+	}
+	t.calls[method]++
+	return t.err
+}
+
+func (t *countingClient) GetProjects(ctx context.Context, tracker entities.TrackerConfig, res *[]entities.Project) error {
+	*res = []entities.Project{{ID: 1, Title: "Project"}}
+	return t.call(methodProjects)
+}
+
+func (t *countingClient) GetCurrentUser(ctx context.Context, tracker entities.TrackerConfig, res *entities.User) error {
+	*res = entities.User{ID: 1, Name: tracker.Credentials.Login}
+	return t.call(methodCurrentUser)
+}
+
+func (t *countingClient) GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
+	*res = []entities.Issue{{ID: 1, Title: "Issue"}}
+	return t.call(methodProjectIssues)
+}
+
+func (t *countingClient) GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
+	return t.call("GetIssue")
+}
+
+func (t *countingClient) GetIssues(ctx context.Context, tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error {
+	return t.call("GetIssues")
+}
+
+func (t *countingClient) GetIssueByURL(ctx context.Context, tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error {
+	return t.call("GetIssueByURL")
+}
+
+func (t *countingClient) CreateIssue(ctx context.Context, tracker entities.TrackerConfig, issue entities.NewIssue, res *entities.Issue) error {
+	return t.call("CreateIssue")
+}
+
+func (t *countingClient) CreateReport(ctx context.Context, tracker entities.TrackerConfig, report entities.Report) error {
+	return t.call("CreateReport")
+}
+
+func (t *countingClient) GetTotalReports(ctx context.Context, tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error {
+	return t.call("GetTotalReports")
+}
+
+var testTracker = entities.TrackerConfig{
+	ID:  1,
+	URL: "https://tracker.com",
+	Credentials: entities.TrackerCredentials{
+		Login:    "tester",
+		Password: "test",
+	},
+}
+
+var testTTL = TTL{Projects: time.Minute, CurrentUser: time.Minute, ProjectIssues: time.Minute}
+
+func TestCacheHit(t *testing.T) {
+	a := assert.New(t)
+	next := &countingClient{}
+	c := NewClient(next, testTTL)
+
+	var projects, projects2 []entities.Project
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects))
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects2))
+	a.Equal(projects, projects2)
+	a.Equal(1, next.calls[methodProjects])
+
+	var user entities.User
+	a.NoError(c.GetCurrentUser(context.Background(), testTracker, &user))
+	a.NoError(c.GetCurrentUser(context.Background(), testTracker, &user))
+	a.Equal(1, next.calls[methodCurrentUser])
+
+	a.Equal(Stats{Hits: 2, Misses: 2, Entries: 2}, c.Stats())
+}
+
+func TestCacheKeyedByCredentials(t *testing.T) {
+	a := assert.New(t)
+	next := &countingClient{}
+	c := NewClient(next, testTTL)
+
+	other := testTracker
+	other.Credentials.Login = "other"
+
+	var user entities.User
+	a.NoError(c.GetCurrentUser(context.Background(), testTracker, &user))
+	a.Equal("tester", user.Name)
+	a.NoError(c.GetCurrentUser(context.Background(), other, &user))
+	a.Equal("other", user.Name)
+	a.Equal(2, next.calls[methodCurrentUser])
+}
+
+func TestCacheExpiration(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	next := &countingClient{}
+	storage := NewMemory()
+	storage.now = func() time.Time { return now }
+	c := NewClient(next, testTTL)
+	c.Storage = storage
+
+	var projects []entities.Project
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects))
+	now = now.Add(2 * time.Minute)
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects))
+	a.Equal(2, next.calls[methodProjects])
+}
+
+func TestCacheDisabled(t *testing.T) {
+	a := assert.New(t)
+	next := &countingClient{}
+	c := NewClient(next, TTL{})
+
+	var projects []entities.Project
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects))
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects))
+	a.Equal(2, next.calls[methodProjects])
+}
+
+func TestCacheErrorNotCached(t *testing.T) {
+	a := assert.New(t)
+	next := &countingClient{err: errors.New("error")}
+	c := NewClient(next, testTTL)
+
+	var projects []entities.Project
+	a.Error(c.GetProjects(context.Background(), testTracker, &projects))
+	a.Error(c.GetProjects(context.Background(), testTracker, &projects))
+	a.Equal(2, next.calls[methodProjects])
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	a := assert.New(t)
+	next := &countingClient{}
+	c := NewClient(next, testTTL)
+
+	var issues []entities.Issue
+	a.NoError(c.GetProjectIssues(context.Background(), testTracker, 1, 0, &issues))
+	a.NoError(c.GetProjectIssues(context.Background(), testTracker, 2, 0, &issues))
+
+	var issue entities.Issue
+	a.NoError(c.CreateIssue(context.Background(), testTracker, entities.NewIssue{ProjectID: 1}, &issue))
+	a.NoError(c.GetProjectIssues(context.Background(), testTracker, 1, 0, &issues))
+	a.NoError(c.GetProjectIssues(context.Background(), testTracker, 2, 0, &issues))
+	a.Equal(3, next.calls[methodProjectIssues])
+
+	a.NoError(c.CreateReport(context.Background(), testTracker, entities.Report{IssueID: 1}))
+	a.NoError(c.GetProjectIssues(context.Background(), testTracker, 2, 0, &issues))
+	a.Equal(4, next.calls[methodProjectIssues])
+	a.Equal(uint64(3), c.Stats().Invalidations)
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// scanCount is a hint how many keys Redis should check per SCAN call
+const scanCount = 1000
+
+// Redis implements Storage shared by several adapter instances
+type Redis struct {
+	Client *redis.Client
+	// Prefix is prepended to all keys, it must not contain glob special characters
+	Prefix string
+}
+
+// NewRedis creates Storage keeping entries in Redis under given key prefix
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{Client: client, Prefix: prefix + "cache:"}
+}
+
+// Get returns value stored under key, false when it's missing or expired
+func (r *Redis) Get(key string) ([]byte, bool, error) {
+	value, err := r.Client.Get(r.Prefix + key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores value under key for ttl
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	return r.Client.Set(r.Prefix+key, value, ttl).Err()
+}
+
+// DeletePrefix removes all entries with keys starting with prefix and returns their amount
+func (r *Redis) DeletePrefix(prefix string) (int, error) {
+	count := 0
+	err := r.scan(r.Prefix+prefix, func(keys []string) error {
+		deleted, err := r.Client.Del(keys...).Result()
+		count += int(deleted)
+		return err
+	})
+	return count, err
+}
+
+// Len returns amount of stored entries
+func (r *Redis) Len() (int, error) {
+	count := 0
+	err := r.scan(r.Prefix, func(keys []string) error {
+		count += len(keys)
+		return nil
+	})
+	return count, err
+}
+
+// scan calls fn with batches of keys starting with prefix
+func (r *Redis) scan(prefix string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.Client.Scan(cursor, prefix+"*", scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+func TestRedisSharedBetweenInstances(t *testing.T) {
+	a := assert.New(t)
+	server, client := newTestRedis(t)
+	next := &countingClient{}
+	c1 := NewClient(next, testTTL)
+	c1.Storage = NewRedis(client, "jirams:")
+	c2 := NewClient(next, testTTL)
+	c2.Storage = NewRedis(client, "jirams:")
+
+	var projects, projects2 []entities.Project
+	a.NoError(c1.GetProjects(context.Background(), testTracker, &projects))
+	a.NoError(c2.GetProjects(context.Background(), testTracker, &projects2))
+	a.Equal(projects, projects2)
+	a.Equal(1, next.calls[methodProjects])
+	a.Equal(Stats{Hits: 1, Entries: 1}, c2.Stats())
+
+	var issues []entities.Issue
+	a.NoError(c1.GetProjectIssues(context.Background(), testTracker, 1, 0, &issues))
+	a.NoError(c1.GetProjectIssues(context.Background(), testTracker, 2, 0, &issues))
+	a.NoError(c2.CreateIssue(context.Background(), testTracker, entities.NewIssue{ProjectID: 1}, nil))
+	a.NoError(c1.GetProjectIssues(context.Background(), testTracker, 1, 0, &issues))
+	a.NoError(c1.GetProjectIssues(context.Background(), testTracker, 2, 0, &issues))
+	a.Equal(3, next.calls[methodProjectIssues])
+	a.Equal([]entities.Issue{{ID: 1, Title: "Issue"}}, issues)
+
+	c2.InvalidateTracker(testTracker.ID)
+	a.Equal(uint64(4), c2.Stats().Invalidations)
+	a.Equal(0, c1.Stats().Entries)
+
+	a.NoError(c1.GetProjects(context.Background(), testTracker, &projects))
+	server.FastForward(2 * time.Minute)
+	a.NoError(c2.GetProjects(context.Background(), testTracker, &projects))
+	a.Equal(3, next.calls[methodProjects])
+}
+
+func TestRedisUnavailable(t *testing.T) {
+	a := assert.New(t)
+	server, client := newTestRedis(t)
+	next := &countingClient{}
+	c := NewClient(next, testTTL)
+	c.Storage = NewRedis(client, "jirams:")
+	server.Close()
+
+	// cache failures do not fail requests
+	var projects []entities.Project
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects))
+	a.NoError(c.GetProjects(context.Background(), testTracker, &projects))
+	a.Equal(2, next.calls[methodProjects])
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage keeps encoded cache entries, it must be safe for concurrent use.
+// Shared Storage makes several adapter instances use the same cache.
+type Storage interface {
+	// Get returns value stored under key, false when it's missing or expired
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key for ttl
+	Set(key string, value []byte, ttl time.Duration) error
+	// DeletePrefix removes all entries with keys starting with prefix and returns their amount
+	DeletePrefix(prefix string) (int, error)
+	// Len returns amount of stored entries
+	Len() (int, error)
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// Memory implements Storage in process memory
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]entry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory creates an empty in-memory Storage
+func NewMemory() *Memory {
+	return &Memory{
+		entries: make(map[string]entry),
+		now:     time.Now,
+	}
+}
+
+// Get returns value stored under key, false when it's missing or expired
+func (m *Memory) Get(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if ok && m.now().After(e.expires) {
+		delete(m.entries, key)
+		ok = false
+	}
+	return e.value, ok, nil
+}
+
+// Set stores value under key for ttl, removing expired entries once per sweepInterval
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	m.entries[key] = entry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// DeletePrefix removes all entries with keys starting with prefix and returns their amount
+func (m *Memory) DeletePrefix(prefix string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for k := range m.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(m.entries, k)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Len returns amount of stored entries including expired ones not swept yet
+func (m *Memory) Len() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries), nil
+}
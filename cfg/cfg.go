@@ -1,6 +1,10 @@
 package cfg
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +18,7 @@ var (
 	Debug        bool
 	LockTimeout  time.Duration
 	RSAPublicKey []byte
+	AdminToken   string
 	MySQL        struct {
 		Host     string
 		Port     int
@@ -21,13 +26,115 @@ var (
 		Login    string
 		Password string
 	}
+	Store struct {
+		// Backend is bolt, mysql or postgres
+		Backend string
+		// DSN of SQL backend, for mysql it defaults to MySQL settings
+		DSN string
+		// EncryptionKeys are lines "ID BASE64KEY" of keys encrypting sensitive data
+		EncryptionKeys []byte
+		// EncryptionKeyID selects key for new data, empty disables encryption
+		EncryptionKeyID string
+	}
 	HTTP struct {
-		Listen       string
-		BasePath     string
-		RealIPHeader string
+		Listen          string
+		BasePath        string
+		RealIPHeader    string
+		ShutdownTimeout time.Duration
+		// ShutdownGrace is delay between failing readiness and closing listeners,
+		// so load balancers stop sending new requests
+		ShutdownGrace time.Duration
+	}
+	Jira struct {
+		HTTPCacheSize int64
+		Breaker       struct {
+			FailureThreshold int
+			OpenTimeout      time.Duration
+			HalfOpenRequests int
+		}
+	}
+	Health struct {
+		Timeout        time.Duration
+		CanaryTrackers []string
+	}
+	Tracing struct {
+		Exporter string
+		Endpoint string
+	}
+	Maintenance struct {
+		PollInterval time.Duration
+	}
+	Webhook struct {
+		Secret string
+		// JWTSecret derives shared secret of Connect app installed in each tracker, see webhook.TrackerSecret
+		JWTSecret string
+		PublicURL string
+	}
+	Idempotency struct {
+		Window time.Duration
+	}
+	Outbox struct {
+		Enabled    bool
+		Interval   time.Duration
+		MinBackoff time.Duration
+		MaxBackoff time.Duration
+	}
+	Events struct {
+		PollInterval time.Duration
+		Buffer       int
+		// AllowedOrigins of browser pages which may open WebSocket connections from other hosts
+		AllowedOrigins []string
+		// MaxSubscriptions limits topics subscribed by a single connection
+		MaxSubscriptions int
+	}
+	RateLimit struct {
+		UserRate     float64
+		UserBurst    int
+		TrackerRate  float64
+		TrackerBurst int
+	}
+	Cache struct {
+		ProjectsTTL      time.Duration
+		CurrentUserTTL   time.Duration
+		ProjectIssuesTTL time.Duration
+	}
+	// Redis keeps cache, rate limits, idempotency results and outbox shared by all instances,
+	// they are kept by each instance itself when Addr is empty
+	Redis struct {
+		Addr     string
+		Password string
+		DB       int
+		Prefix   string
+	}
+	// Tracker restricts hosts of tracker URLs, internal addresses are blocked unless allowed.
+	// Rules are IP addresses, CIDR networks, host names or *.domain patterns.
+	Tracker struct {
+		Allow     []string
+		Deny      []string
+		AllowOnly bool
+		// TLS holds custom TLS settings keyed by tracker host
+		TLS map[string]TrackerTLS
+	}
+	// Proxy is used to reach trackers, URL overrides environment variables.
+	// Proxy resolves tracker host itself, so only IP addresses and hosts allowlisted by config/tracker/allow are proxied.
+	Proxy struct {
+		URL             string
+		NoProxy         []string
+		FromEnvironment bool
+		// Trackers holds proxy URLs or "direct" keyed by tracker host
+		Trackers map[string]string
 	}
 )
 
+// TrackerTLS is TLS settings of tracker read from config/tls/<tracker host>/
+type TrackerTLS struct {
+	CA                 []byte
+	Cert               []byte
+	Key                []byte
+	Pins               []string
+	InsecureSkipVerify bool
+}
+
 func init() {
 	if err := load(); err != nil {
 		log.Fatal(err)
@@ -48,6 +155,8 @@ func load() error {
 	}
 
 	HTTP.RealIPHeader = narada.GetConfigLine("http/real_ip_header")
+	HTTP.ShutdownTimeout = narada.GetConfigDuration("http/shutdown_timeout")
+	HTTP.ShutdownGrace = narada.GetConfigDuration("http/shutdown_grace")
 
 	var err error
 	RSAPublicKey, err = narada.GetConfig("rsa_public_key")
@@ -56,5 +165,229 @@ func load() error {
 	}
 
 	LockTimeout = narada.GetConfigDuration("lock_timeout")
+	if err = loadStore(); err != nil {
+		return err
+	}
+	AdminToken = narada.GetConfigLine("admin_token")
+
+	if Jira.HTTPCacheSize, err = strconv.ParseInt(narada.GetConfigLine("jira/http_cache_size"), 10, 64); err != nil {
+		return err
+	}
+
+	if Jira.Breaker.FailureThreshold, err = strconv.Atoi(narada.GetConfigLine("jira/breaker/failure_threshold")); err != nil {
+		return err
+	}
+	Jira.Breaker.OpenTimeout = narada.GetConfigDuration("jira/breaker/open_timeout")
+	if Jira.Breaker.HalfOpenRequests, err = strconv.Atoi(narada.GetConfigLine("jira/breaker/half_open_requests")); err != nil {
+		return err
+	}
+
+	Health.Timeout = narada.GetConfigDuration("health/timeout")
+	canaryTrackers, err := narada.GetConfig("health/canary_trackers")
+	if err != nil {
+		return err
+	}
+	Health.CanaryTrackers = strings.Fields(string(canaryTrackers))
+
+	Tracing.Exporter = narada.GetConfigLine("tracing/exporter")
+	Tracing.Endpoint = narada.GetConfigLine("tracing/endpoint")
+
+	Maintenance.PollInterval = narada.GetConfigDuration("maintenance/poll_interval")
+	if Maintenance.PollInterval <= 0 {
+		log.Fatal("config/maintenance/poll_interval should be positive")
+	}
+
+	Webhook.Secret = narada.GetConfigLine("webhook/secret")
+	Webhook.JWTSecret = narada.GetConfigLine("webhook/jwt_secret")
+	Webhook.PublicURL = narada.GetConfigLine("webhook/public_url")
+
+	Idempotency.Window = narada.GetConfigDuration("idempotency/window")
+
+	if Outbox.Enabled, err = strconv.ParseBool(narada.GetConfigLine("outbox/enabled")); err != nil {
+		return err
+	}
+	Outbox.Interval = narada.GetConfigDuration("outbox/interval")
+	if Outbox.Interval <= 0 {
+		log.Fatal("config/outbox/interval should be positive")
+	}
+	Outbox.MinBackoff = narada.GetConfigDuration("outbox/min_backoff")
+	Outbox.MaxBackoff = narada.GetConfigDuration("outbox/max_backoff")
+
+	Events.PollInterval = narada.GetConfigDuration("events/poll_interval")
+	if Events.PollInterval <= 0 {
+		log.Fatal("config/events/poll_interval should be positive")
+	}
+	if Events.Buffer, err = strconv.Atoi(narada.GetConfigLine("events/buffer")); err != nil {
+		return err
+	}
+	allowedOrigins, err := narada.GetConfig("events/allowed_origins")
+	if err != nil {
+		return err
+	}
+	Events.AllowedOrigins = strings.Fields(string(allowedOrigins))
+	if Events.MaxSubscriptions, err = strconv.Atoi(narada.GetConfigLine("events/max_subscriptions")); err != nil {
+		return err
+	}
+	if Events.MaxSubscriptions <= 0 {
+		log.Fatal("config/events/max_subscriptions should be positive")
+	}
+
+	if RateLimit.UserRate, err = strconv.ParseFloat(narada.GetConfigLine("rate_limit/user/rate"), 64); err != nil {
+		return err
+	}
+	if RateLimit.UserBurst, err = strconv.Atoi(narada.GetConfigLine("rate_limit/user/burst")); err != nil {
+		return err
+	}
+	if RateLimit.TrackerRate, err = strconv.ParseFloat(narada.GetConfigLine("rate_limit/tracker/rate"), 64); err != nil {
+		return err
+	}
+	if RateLimit.TrackerBurst, err = strconv.Atoi(narada.GetConfigLine("rate_limit/tracker/burst")); err != nil {
+		return err
+	}
+	if RateLimit.UserRate > 0 && RateLimit.UserBurst < 1 {
+		log.Fatal("config/rate_limit/user/burst should be positive")
+	}
+	if RateLimit.TrackerRate > 0 && RateLimit.TrackerBurst < 1 {
+		log.Fatal("config/rate_limit/tracker/burst should be positive")
+	}
+
+	Cache.ProjectsTTL = narada.GetConfigDuration("cache/ttl/projects")
+	Cache.CurrentUserTTL = narada.GetConfigDuration("cache/ttl/current_user")
+	Cache.ProjectIssuesTTL = narada.GetConfigDuration("cache/ttl/project_issues")
+
+	Redis.Addr = narada.GetConfigLine("redis/addr")
+	Redis.Password = narada.GetConfigLine("redis/password")
+	if Redis.DB, err = strconv.Atoi(narada.GetConfigLine("redis/db")); err != nil {
+		return err
+	}
+	Redis.Prefix = narada.GetConfigLine("redis/prefix")
+
+	trackerAllow, err := narada.GetConfig("tracker/allow")
+	if err != nil {
+		return err
+	}
+	Tracker.Allow = strings.Fields(string(trackerAllow))
+	trackerDeny, err := narada.GetConfig("tracker/deny")
+	if err != nil {
+		return err
+	}
+	Tracker.Deny = strings.Fields(string(trackerDeny))
+	if Tracker.AllowOnly, err = strconv.ParseBool(narada.GetConfigLine("tracker/allow_only")); err != nil {
+		return err
+	}
+	if err = loadTrackerTLS(); err != nil {
+		return err
+	}
+	return loadProxy()
+}
+
+// loadTrackerTLS reads TLS settings of trackers listed in config/tls/trackers,
+// each setting is optional
+func loadTrackerTLS() error {
+	trackers, err := narada.GetConfig("tls/trackers")
+	if err != nil {
+		return err
+	}
+	Tracker.TLS = make(map[string]TrackerTLS)
+	for _, key := range strings.Fields(string(trackers)) {
+		if strings.ContainsAny(key, "/\\") || key == "." || key == ".." || key == "trackers" {
+			return fmt.Errorf("invalid tracker %q in config/tls/trackers", key)
+		}
+		var c TrackerTLS
+		dir := "tls/" + key + "/"
+		if c.CA, err = optionalConfig(dir + "ca"); err != nil {
+			return err
+		}
+		if c.Cert, err = optionalConfig(dir + "cert"); err != nil {
+			return err
+		}
+		if c.Key, err = optionalConfig(dir + "key"); err != nil {
+			return err
+		}
+		pins, err := optionalConfig(dir + "pins")
+		if err != nil {
+			return err
+		}
+		c.Pins = strings.Fields(string(pins))
+		insecure, err := optionalConfig(dir + "insecure_skip_verify")
+		if err != nil {
+			return err
+		}
+		if s := strings.TrimSpace(string(insecure)); s != "" {
+			if c.InsecureSkipVerify, err = strconv.ParseBool(s); err != nil {
+				return err
+			}
+		}
+		Tracker.TLS[key] = c
+	}
+	return nil
+}
+
+// loadProxy reads proxy settings, config/proxy/trackers contains lines "HOST PROXY_URL"
+func loadProxy() (err error) {
+	Proxy.URL = narada.GetConfigLine("proxy/url")
+	noProxy, err := narada.GetConfig("proxy/no_proxy")
+	if err != nil {
+		return err
+	}
+	Proxy.NoProxy = strings.Fields(string(noProxy))
+	if Proxy.FromEnvironment, err = strconv.ParseBool(narada.GetConfigLine("proxy/from_environment")); err != nil {
+		return err
+	}
+	trackers, err := narada.GetConfig("proxy/trackers")
+	if err != nil {
+		return err
+	}
+	Proxy.Trackers = make(map[string]string)
+	for _, line := range strings.Split(string(trackers), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case len(fields) == 2:
+			Proxy.Trackers[fields[0]] = fields[1]
+		default:
+			return fmt.Errorf("invalid line in config/proxy/trackers: %q", fields[0])
+		}
+	}
+	return nil
+}
+
+// optionalConfig returns empty value for missing config
+func optionalConfig(path string) ([]byte, error) {
+	data, err := narada.GetConfig(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func loadStore() (err error) {
+	MySQL.Host = narada.GetConfigLine("mysql/host")
+	if MySQL.Port, err = strconv.Atoi(narada.GetConfigLine("mysql/port")); err != nil {
+		return err
+	}
+	MySQL.DB = narada.GetConfigLine("mysql/db")
+	MySQL.Login = narada.GetConfigLine("mysql/login")
+	MySQL.Password = narada.GetConfigLine("mysql/pass")
+
+	Store.Backend = narada.GetConfigLine("store/backend")
+	Store.DSN = narada.GetConfigLine("store/dsn")
+	if Store.EncryptionKeys, err = narada.GetConfig("store/encryption_keys"); err != nil {
+		return err
+	}
+	Store.EncryptionKeyID = narada.GetConfigLine("store/encryption_key_id")
+	switch Store.Backend {
+	case "bolt":
+	case "mysql":
+		if Store.DSN == "" {
+			Store.DSN = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", MySQL.Login, MySQL.Password, MySQL.Host, MySQL.Port, MySQL.DB)
+		}
+	case "postgres":
+		if Store.DSN == "" {
+			return errors.New("config/store/dsn is required for postgres backend")
+		}
+	default:
+		return fmt.Errorf("unsupported config/store/backend %q", Store.Backend)
+	}
 	return nil
 }
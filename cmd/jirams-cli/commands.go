@@ -0,0 +1,327 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qarea/ctxtg"
+	"github.com/qarea/jirams/api"
+	"github.com/qarea/jirams/entities"
+)
+
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+func runProjects(c *cli, method string, args []string) error {
+	if err := newFlagSet(method).Parse(args); err != nil {
+		return err
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	var res api.GetProjectsResponse
+	return c.call(method, api.GetProjectsRequest{Context: ctx, Tracker: tracker}, &res, func(t *table) {
+		t.row("ID", "TITLE", "ISSUE TYPES", "DESCRIPTION")
+		for _, p := range res.Projects {
+			t.row(p.ID, p.Title, namedIDs(p.IssueTypes), p.Description)
+		}
+	})
+}
+
+func runMe(c *cli, method string, args []string) error {
+	if err := newFlagSet(method).Parse(args); err != nil {
+		return err
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	var res api.GetCurrentUserResponse
+	return c.call(method, api.GetCurrentUserRequest{Context: ctx, Tracker: tracker}, &res, func(t *table) {
+		t.row("ID", "NAME", "MAIL")
+		t.row(res.User.ID, res.User.Name, res.User.Mail)
+	})
+}
+
+func runIssues(c *cli, method string, args []string) error {
+	fs := newFlagSet(method)
+	projectID := fs.Uint64("project", 0, "project ID")
+	userID := fs.Uint64("user", 0, "user ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	req := api.GetProjectIssuesRequest{Context: ctx, Tracker: tracker, ProjectID: entities.ProjectID(*projectID), UserID: entities.UserID(*userID)}
+	var res api.GetProjectIssuesResponse
+	return c.call(method, req, &res, func(t *table) { issueRows(t, res.Issues...) })
+}
+
+// runIssue calls GetIssue for single ID and GetIssues for several ones
+func runIssue(c *cli, method string, args []string) error {
+	fs := newFlagSet(method)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, "Usage: jirams-cli issue ID [ID...]") }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("issue ID is required")
+	}
+	var ids []entities.IssueID
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid issue ID %q", arg)
+		}
+		ids = append(ids, entities.IssueID(id))
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 1 {
+		var res api.GetIssueResponse
+		return c.call(method, api.GetIssueRequest{Context: ctx, Tracker: tracker, IssueID: ids[0]}, &res, func(t *table) {
+			issueRows(t, res.Issue)
+		})
+	}
+	var res api.GetIssuesResponse
+	return c.call("API.GetIssues", api.GetIssuesRequest{Context: ctx, Tracker: tracker, IssueIDs: ids}, &res, func(t *table) {
+		issueRows(t, res.Issues...)
+		for _, id := range res.NotFound {
+			t.row(id, "", "not found")
+		}
+	})
+}
+
+func runCreateIssue(c *cli, method string, args []string) error {
+	fs := newFlagSet(method)
+	projectID := fs.Uint64("project", 0, "project ID")
+	issueType := fs.Uint64("type", 0, "issue type ID")
+	title := fs.String("title", "", "issue title")
+	assignee := fs.Uint64("assignee", 0, "assignee user ID")
+	estimate := fs.Duration("estimate", 0, "original estimate")
+	key := fs.String("idempotency-key", "", "idempotency key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	req := api.CreateIssueRequest{
+		Context: ctx,
+		Tracker: tracker,
+		Issue: entities.NewIssue{
+			ProjectID: entities.ProjectID(*projectID),
+			Assignee:  entities.UserID(*assignee),
+			Type:      entities.EntityID(*issueType),
+			Title:     *title,
+			Estimate:  uint64(estimate.Seconds()),
+		},
+		IdempotencyKey: *key,
+	}
+	var res api.CreateIssueResponse
+	return c.call(method, req, &res, func(t *table) { issueRows(t, res.Issue) })
+}
+
+func runReport(c *cli, method string, args []string) error {
+	fs := newFlagSet(method)
+	issueID := fs.Uint64("issue", 0, "issue ID")
+	started := fs.String("started", "", "start time: unix timestamp, RFC3339 or 2006-01-02T15:04 in local time zone, now by default")
+	duration := fs.Duration("duration", 0, "reported time")
+	comment := fs.String("comment", "", "report comment")
+	key := fs.String("idempotency-key", "", "idempotency key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	start := entities.Timestamp(time.Now().Unix())
+	if *started != "" {
+		var err error
+		if start, err = parseTime(*started); err != nil {
+			return err
+		}
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	req := api.CreateReportRequest{
+		Context: ctx,
+		Tracker: tracker,
+		Report: entities.Report{
+			IssueID:  entities.IssueID(*issueID),
+			Started:  start,
+			Duration: entities.Duration(duration.Seconds()),
+			Comments: *comment,
+		},
+		IdempotencyKey: *key,
+	}
+	var res api.CreateReportResponse
+	return c.call(method, req, &res, func(t *table) {
+		if res.Queued {
+			t.row("QUEUED", "ID", "STATUS", "NEXT ATTEMPT", "LAST ERROR")
+			p := res.PendingReport
+			t.row(true, p.ID, p.Status, formatTime(p.NextAttempt), p.LastError)
+			return
+		}
+		t.row("QUEUED")
+		t.row(false)
+	})
+}
+
+func runTotals(c *cli, method string, args []string) error {
+	fs := newFlagSet(method)
+	date := fs.String("date", time.Now().Format("2006-01-02"), "day in local time zone")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	day, err := parseTime(*date)
+	if err != nil {
+		return err
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	var res api.GetTotalReportsResponse
+	return c.call(method, api.GetTotalReportsRequest{Context: ctx, Tracker: tracker, Date: day}, &res, func(t *table) {
+		t.row("DATE", "TOTAL")
+		t.row(*date, formatDuration(entities.Duration(res.Total)))
+	})
+}
+
+func runIssueByURL(c *cli, method string, args []string) error {
+	fs := newFlagSet(method)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, "Usage: jirams-cli issue-by-url URL") }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("issue URL is required")
+	}
+	ctx, tracker, err := c.request()
+	if err != nil {
+		return err
+	}
+	var res api.GetIssueByURLResponse
+	return c.call(method, api.GetIssueByURLRequest{Context: ctx, Tracker: tracker, IssueURL: fs.Arg(0)}, &res, func(t *table) {
+		issueRows(t, res.Issue)
+		t.row()
+		t.row("PROJECT", res.ProjectID)
+	})
+}
+
+func runPending(c *cli, method string, args []string) error {
+	if err := newFlagSet(method).Parse(args); err != nil {
+		return err
+	}
+	ctx, err := c.context()
+	if err != nil {
+		return err
+	}
+	var res api.GetPendingReportsResponse
+	return c.call(method, api.GetPendingReportsRequest{Context: ctx}, &res, func(t *table) {
+		t.row("ID", "TRACKER", "ISSUE", "STARTED", "DURATION", "STATUS", "ATTEMPTS", "NEXT ATTEMPT", "LAST ERROR")
+		for _, p := range res.Reports {
+			t.row(p.ID, p.TrackerID, p.Report.IssueID, formatTime(p.Report.Started), formatDuration(p.Report.Duration),
+				p.Status, p.Attempts, formatTime(p.NextAttempt), p.LastError)
+		}
+	})
+}
+
+func runRetryPending(c *cli, method string, args []string) error {
+	id, ctx, err := c.pendingID(method, args)
+	if err != nil {
+		return err
+	}
+	var res api.RetryPendingReportResponse
+	return c.call(method, api.RetryPendingReportRequest{Context: ctx, ID: id}, &res, func(t *table) { t.row("OK") })
+}
+
+func runCancelPending(c *cli, method string, args []string) error {
+	id, ctx, err := c.pendingID(method, args)
+	if err != nil {
+		return err
+	}
+	var res api.CancelPendingReportResponse
+	return c.call(method, api.CancelPendingReportRequest{Context: ctx, ID: id}, &res, func(t *table) { t.row("OK") })
+}
+
+// request returns context and tracker needed by most methods
+func (c *cli) request() (ctxtg.Context, entities.TrackerConfig, error) {
+	ctx, err := c.context()
+	if err != nil {
+		return ctx, entities.TrackerConfig{}, err
+	}
+	tracker, err := c.trackerConfig()
+	return ctx, tracker, err
+}
+
+func (c *cli) pendingID(method string, args []string) (uint64, ctxtg.Context, error) {
+	fs := newFlagSet(method)
+	if err := fs.Parse(args); err != nil {
+		return 0, ctxtg.Context{}, err
+	}
+	if fs.NArg() != 1 {
+		return 0, ctxtg.Context{}, fmt.Errorf("pending report ID is required")
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return 0, ctxtg.Context{}, fmt.Errorf("invalid pending report ID %q", fs.Arg(0))
+	}
+	ctx, err := c.context()
+	return id, ctx, err
+}
+
+func newFlagSet(method string) *flag.FlagSet {
+	return flag.NewFlagSet(method, flag.ContinueOnError)
+}
+
+func issueRows(t *table, issues ...entities.Issue) {
+	t.row("ID", "TYPE", "TITLE", "ESTIMATE", "SPENT", "DONE", "DUE", "URL")
+	for _, i := range issues {
+		t.row(i.ID, i.Type.Name, i.Title, formatDuration(i.Estimate), formatDuration(i.Spent),
+			fmt.Sprintf("%d%%", i.Done), formatTime(i.DueDate), i.URL)
+	}
+}
+
+func namedIDs(ids []entities.NamedID) string {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = fmt.Sprintf("%d:%s", id.ID, id.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// parseTime parses unix timestamp or time in one of timeLayouts in local time zone
+func parseTime(s string) (entities.Timestamp, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return entities.Timestamp(n), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return entities.Timestamp(t.Unix()), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q", s)
+}
+
+func formatTime(ts entities.Timestamp) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(int64(ts), 0).Format("2006-01-02 15:04")
+}
+
+func formatDuration(d entities.Duration) string {
+	return (time.Duration(d) * time.Second).String()
+}
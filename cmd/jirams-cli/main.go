@@ -0,0 +1,183 @@
+// Package main provides command-line client for calling adapter RPC methods.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+	"github.com/qarea/ctxtg"
+	"github.com/qarea/jirams/entities"
+)
+
+const usageHeader = `Usage: jirams-cli [flags] command [command flags]
+
+Tracker is taken from -tracker file (JSON of entities.TrackerConfig) overridden by
+-tracker-id, -tracker-url, -login and -password flags. Token is taken from -token or
+minted by -key private key for dev setups.
+
+Commands:
+`
+
+// options are global flags shared by all commands
+type options struct {
+	url         string
+	token       string
+	key         string
+	userID      int64
+	tokenTTL    time.Duration
+	trackerFile string
+	tracker     entities.TrackerConfig
+	json        bool
+}
+
+// command describes single subcommand calling RPC method
+type command struct {
+	method string
+	usage  string
+	// run parses command flags, calls method and prints result
+	run func(c *cli, method string, args []string) error
+}
+
+var commands = map[string]command{
+	"projects":       {"API.GetProjects", "list projects", runProjects},
+	"me":             {"API.GetCurrentUser", "show current tracker user", runMe},
+	"issues":         {"API.GetProjectIssues", "list project issues assigned to user", runIssues},
+	"issue":          {"API.GetIssue", "show issue(s) by ID", runIssue},
+	"create-issue":   {"API.CreateIssue", "create issue", runCreateIssue},
+	"report":         {"API.CreateReport", "report work time", runReport},
+	"totals":         {"API.GetTotalReports", "show total reported time for a day", runTotals},
+	"issue-by-url":   {"API.GetIssueByURL", "show issue by its URL", runIssueByURL},
+	"pending":        {"API.GetPendingReports", "list queued reports", runPending},
+	"retry-pending":  {"API.RetryPendingReport", "retry queued report", runRetryPending},
+	"cancel-pending": {"API.CancelPendingReport", "cancel queued report", runCancelPending},
+}
+
+// cli keeps state shared by commands
+type cli struct {
+	options
+	client *jsonrpc2.Client
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.url, "url", envDefault("JIRAMS_URL", "http://127.0.0.1:8001/rpc"), "adapter JSON-RPC endpoint (env JIRAMS_URL)")
+	flag.StringVar(&opts.token, "token", os.Getenv("JIRAMS_TOKEN"), "ctxtg token (env JIRAMS_TOKEN)")
+	flag.StringVar(&opts.key, "key", os.Getenv("JIRAMS_KEY"), "RSA private key PEM file to mint token with (env JIRAMS_KEY)")
+	flag.Int64Var(&opts.userID, "user-id", 1, "user ID of minted token")
+	flag.DurationVar(&opts.tokenTTL, "token-ttl", time.Hour, "lifetime of minted token")
+	flag.StringVar(&opts.trackerFile, "tracker", os.Getenv("JIRAMS_TRACKER"), "tracker config JSON file (env JIRAMS_TRACKER)")
+	trackerID := flag.Uint64("tracker-id", 0, "tracker ID")
+	flag.StringVar(&opts.tracker.URL, "tracker-url", "", "tracker URL")
+	flag.StringVar(&opts.tracker.Credentials.Login, "login", "", "tracker login")
+	flag.StringVar(&opts.tracker.Credentials.Password, "password", os.Getenv("JIRAMS_PASSWORD"), "tracker password (env JIRAMS_PASSWORD)")
+	flag.BoolVar(&opts.json, "json", false, "print JSON instead of tables")
+	flag.Usage = usage
+	flag.Parse()
+	opts.tracker.ID = entities.TrackerID(*trackerID)
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	c := &cli{options: opts, client: jsonrpc2.NewHTTPClient(opts.url)}
+	defer c.client.Close() // nolint: errcheck
+	if err := cmd.run(c, cmd.method, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.method, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, usageHeader)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-15s %s (%s)\n", name, commands[name].usage, commands[name].method)
+	}
+	fmt.Fprint(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func envDefault(name, value string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return value
+}
+
+// context returns RPC context with token given or minted by options
+func (c *cli) context() (ctxtg.Context, error) {
+	token := c.token
+	if token == "" {
+		if c.key == "" {
+			return ctxtg.Context{}, fmt.Errorf("either -token or -key is required")
+		}
+		var err error
+		if token, err = mintToken(c.key, c.userID, c.tokenTTL); err != nil {
+			return ctxtg.Context{}, err
+		}
+	}
+	return ctxtg.Context{Token: ctxtg.Token(token), TracingID: ctxtg.TracingID(fmt.Sprintf("cli-%d", time.Now().UnixNano()))}, nil
+}
+
+// trackerConfig returns tracker from file overridden by flags
+func (c *cli) trackerConfig() (entities.TrackerConfig, error) {
+	var res entities.TrackerConfig
+	if c.trackerFile != "" {
+		data, err := ioutil.ReadFile(c.trackerFile)
+		if err != nil {
+			return res, err
+		}
+		if err := json.Unmarshal(data, &res); err != nil {
+			return res, fmt.Errorf("%s: %v", c.trackerFile, err)
+		}
+	}
+	if c.tracker.ID != 0 {
+		res.ID = c.tracker.ID
+	}
+	if c.tracker.URL != "" {
+		res.URL = strings.TrimSuffix(c.tracker.URL, "/")
+	}
+	if c.tracker.Credentials.Login != "" {
+		res.Credentials.Login = c.tracker.Credentials.Login
+	}
+	if c.tracker.Credentials.Password != "" {
+		res.Credentials.Password = c.tracker.Credentials.Password
+	}
+	if res.URL == "" {
+		return res, fmt.Errorf("tracker URL is required, use -tracker or -tracker-url")
+	}
+	return res, nil
+}
+
+// call sends request to method, print is used to output result as table
+func (c *cli) call(method string, req, res interface{}, print func(*table)) error {
+	if err := c.client.Call(method, req, res); err != nil {
+		return err
+	}
+	if c.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	t := newTable(os.Stdout)
+	print(t)
+	return t.flush()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qarea/ctxtg"
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerConfig(t *testing.T) {
+	a := assert.New(t)
+	file := filepath.Join(t.TempDir(), "tracker.json")
+	a.NoError(ioutil.WriteFile(file, []byte(`{"ID":7,"URL":"https://file.example.com","Credentials":{"Login":"file","Password":"secret"}}`), 0600))
+
+	c := &cli{options: options{trackerFile: file}}
+	tracker, err := c.trackerConfig()
+	a.NoError(err)
+	a.Equal(entities.TrackerConfig{ID: 7, URL: "https://file.example.com", Credentials: entities.TrackerCredentials{Login: "file", Password: "secret"}}, tracker)
+
+	// flags override file field by field
+	c.tracker = entities.TrackerConfig{URL: "https://flag.example.com/", Credentials: entities.TrackerCredentials{Login: "flag"}}
+	tracker, err = c.trackerConfig()
+	a.NoError(err)
+	a.Equal(entities.TrackerConfig{ID: 7, URL: "https://flag.example.com", Credentials: entities.TrackerCredentials{Login: "flag", Password: "secret"}}, tracker)
+
+	c = &cli{options: options{tracker: entities.TrackerConfig{ID: 2, URL: "https://flag.example.com"}}}
+	tracker, err = c.trackerConfig()
+	a.NoError(err)
+	a.Equal(entities.TrackerConfig{ID: 2, URL: "https://flag.example.com"}, tracker)
+
+	_, err = (&cli{}).trackerConfig()
+	a.Error(err, "URL is required")
+	_, err = (&cli{options: options{trackerFile: filepath.Join(t.TempDir(), "missing.json")}}).trackerConfig()
+	a.Error(err)
+	a.NoError(ioutil.WriteFile(file, []byte(`{`), 0600))
+	_, err = (&cli{options: options{trackerFile: file, tracker: entities.TrackerConfig{URL: "https://flag.example.com"}}}).trackerConfig()
+	a.Error(err)
+}
+
+// TestMintToken checks that minted token is accepted by the parser adapter uses
+func TestMintToken(t *testing.T) {
+	a := assert.New(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	a.NoError(err)
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.pem")
+	a.NoError(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	a.NoError(err)
+
+	token, err := mintToken(keyFile, 42, time.Minute)
+	a.NoError(err)
+	parser, err := ctxtg.NewRSATokenParser(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if !a.NoError(err) {
+		return
+	}
+	var userID ctxtg.UserID
+	a.NoError(parser.ParseCtxWithClaims(ctxtg.Context{Token: ctxtg.Token(token)}, func(ctx context.Context, claims ctxtg.Claims) error {
+		userID = claims.UserID
+		return nil
+	}))
+	a.Equal(ctxtg.UserID(42), userID)
+
+	expired, err := mintToken(keyFile, 42, -time.Minute)
+	a.NoError(err)
+	a.Error(parser.ParseCtxWithClaims(ctxtg.Context{Token: ctxtg.Token(expired)}, func(ctx context.Context, claims ctxtg.Claims) error {
+		return nil
+	}))
+
+	_, err = mintToken(filepath.Join(dir, "missing.pem"), 42, time.Minute)
+	a.Error(err)
+}
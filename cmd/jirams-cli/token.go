@@ -0,0 +1,35 @@
+package main
+
+import (
+	"io/ioutil"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// claims match ctxtg.Claims expected by adapter
+type claims struct {
+	UserID int64 `json:"user_id"`
+	jwt.StandardClaims
+}
+
+// mintToken signs token for userID with RSA private key from PEM file
+func mintToken(keyFile string, userID int64, ttl time.Duration) (string, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims{
+		UserID: userID,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	})
+	return token.SignedString(key)
+}
@@ -0,0 +1,318 @@
+// Package main provides tool for inspecting and repairing user mapping in offline copy of BoltDB store.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/go-redis/redis"
+	// SQL drivers for copy-sql
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/outbox"
+	"github.com/qarea/jirams/store"
+)
+
+const usage = `Usage: jirams-store [-db path] command [args]
+
+Commands:
+  list [TRACKER]              list mappings of tracker, all when omitted
+  key TRACKER ID              show key mapped to ID
+  id KEY                      show ID mapped to key
+  reassign TRACKER KEY ID     map key to another ID
+  merge TRACKER FROM_ID TO_ID remove duplicate FROM_ID, its key maps to TO_ID
+  delete-tracker TRACKER      remove all mappings of tracker
+  export [FILE]               write all mappings as JSON, to stdout by default
+  import [FILE]               replace all mappings with JSON, from stdin by default
+  verify [-repair]            check Users and UserKeys buckets agree
+  copy-sql DRIVER DSN         replace mappings in mysql or postgres database with BoltDB ones
+  generate-key ID             print new encryption key line for config/store/encryption_keys
+  rotate-keys                 re-encrypt sensitive data with current key, decrypt it without one,
+                              Redis outbox is rotated too when config/redis/addr is set
+
+Flags:
+`
+
+func main() {
+	dbPath := flag.String("db", "var/bolt/store.db", "path to BoltDB file, better a copy while service is running")
+	flag.StringVar(&keysPath, "keys", "config/store/encryption_keys", "path to encryption keys for rotate-keys")
+	flag.StringVar(&keyID, "key-id", "", "current encryption key ID for rotate-keys (default from config/store/encryption_key_id)")
+	flag.StringVar(&configDir, "config", "config", "service config directory, rotate-keys reads Redis settings from it")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if flag.Arg(0) == "generate-key" && flag.NArg() == 2 {
+		key, err := store.GenerateKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(flag.Arg(1), key)
+		return
+	}
+
+	db, err := bolt.Open(*dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Fatalf("Failed to open %s (is service running?): %v", *dbPath, err)
+	}
+	err = run(store.New(db), flag.Arg(0), flag.Args()[1:])
+	if errClose := db.Close(); err == nil {
+		err = errClose
+	}
+	if err == errUsage {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+var (
+	errUsage  = fmt.Errorf("invalid arguments")
+	keysPath  string
+	keyID     string
+	configDir string
+)
+
+func run(users *store.Store, command string, args []string) error {
+	switch {
+	case command == "list" && len(args) <= 1:
+		var trackerID uint64
+		if len(args) == 1 {
+			trackerID = parseUint(args[0])
+		}
+		mappings, err := users.List(entities.TrackerID(trackerID))
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TRACKER\tID\tKEY")
+		for _, m := range mappings {
+			fmt.Fprintf(w, "%d\t%d\t%s\n", m.TrackerID, m.UserID, m.Key)
+		}
+		return w.Flush()
+	case command == "key" && len(args) == 2:
+		key, err := users.GetKey(entities.TrackerID(parseUint(args[0])), entities.UserID(parseUint(args[1])))
+		if err == nil && key == "" {
+			err = store.ErrMappingNotFound
+		}
+		if err == nil {
+			fmt.Println(key)
+		}
+		return err
+	case command == "id" && len(args) == 1:
+		id, err := users.LookupID(entities.UserKey(args[0]))
+		if err == nil {
+			fmt.Println(id)
+		}
+		return err
+	case command == "reassign" && len(args) == 3:
+		return users.Reassign(entities.TrackerID(parseUint(args[0])), entities.UserKey(args[1]), entities.UserID(parseUint(args[2])))
+	case command == "merge" && len(args) == 3:
+		return users.Merge(entities.TrackerID(parseUint(args[0])), entities.UserID(parseUint(args[1])), entities.UserID(parseUint(args[2])))
+	case command == "delete-tracker" && len(args) == 1:
+		count, err := users.DeleteTracker(entities.TrackerID(parseUint(args[0])))
+		if err == nil {
+			fmt.Printf("%d mappings deleted\n", count)
+		}
+		return err
+	case command == "export" && len(args) <= 1:
+		return export(users, args)
+	case command == "import" && len(args) <= 1:
+		return importDump(users, args)
+	case command == "verify" && (len(args) == 0 || len(args) == 1 && args[0] == "-repair"):
+		return verify(users, len(args) == 1)
+	case command == "copy-sql" && len(args) == 2:
+		return copySQL(users, args[0], args[1])
+	case command == "rotate-keys" && len(args) == 0:
+		return rotateKeys(users.DB)
+	}
+	return errUsage
+}
+
+func export(users *store.Store, args []string) error {
+	dump, err := users.Export()
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if len(args) == 1 {
+		f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close() // nolint: errcheck
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+func importDump(users *store.Store, args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close() // nolint: errcheck
+		r = f
+	}
+	var dump store.Dump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return err
+	}
+	if err := users.Import(dump); err != nil {
+		return err
+	}
+	fmt.Printf("%d mappings imported\n", len(dump.Users))
+	return nil
+}
+
+func verify(users *store.Store, repair bool) error {
+	if repair {
+		fixed, err := users.Repair()
+		if err != nil {
+			return err
+		}
+		for _, p := range fixed {
+			fmt.Printf("repaired %s: tracker %d, ID %d, key %q: %s\n", p.Type, p.TrackerID, p.UserID, p.Key, p.Detail)
+		}
+	}
+	problems, err := users.Verify()
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: tracker %d, ID %d, key %q: %s\n", p.Type, p.TrackerID, p.UserID, p.Key, p.Detail)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+// copySQL copies all mappings into SQL store, applying its migrations first
+func copySQL(users *store.Store, driver, dsn string) error {
+	if driver != store.MySQL && driver != store.Postgres {
+		return fmt.Errorf("unsupported driver %q", driver)
+	}
+	if problems, err := users.Verify(); err != nil {
+		return err
+	} else if len(problems) > 0 {
+		log.Printf("Warning: %d problems found, consider running verify -repair first", len(problems))
+	}
+	dump, err := users.Export()
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close() // nolint: errcheck
+	target := &store.SQLStore{DB: db, Dialect: driver}
+	if err := target.Migrate(); err != nil {
+		return err
+	}
+	if err := target.Import(dump); err != nil {
+		return err
+	}
+	copied, err := target.Export()
+	if err != nil {
+		return err
+	}
+	if len(copied.Users) != len(dump.Users) || len(copied.UserKeys) != len(dump.UserKeys) || copied.Sequence != dump.Sequence {
+		return fmt.Errorf("copy mismatch: %d/%d mappings, %d/%d keys, sequence %d/%d",
+			len(copied.Users), len(dump.Users), len(copied.UserKeys), len(dump.UserKeys), copied.Sequence, dump.Sequence)
+	}
+	fmt.Printf("%d mappings and %d keys copied, sequence %d\n", len(dump.Users), len(dump.UserKeys), dump.Sequence)
+	return nil
+}
+
+// rotateKeys re-encrypts sensitive buckets, service must be stopped as it's done in place.
+// Old key may be removed from config only after all values are rotated.
+func rotateKeys(db *bolt.DB) error {
+	keys, err := os.ReadFile(keysPath)
+	if err != nil {
+		return err
+	}
+	if keyID == "" {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(keysPath), "encryption_key_id"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		keyID = strings.TrimSpace(string(data))
+	}
+	keyring, err := store.ParseKeyring(keys, keyID)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range store.SensitiveBuckets {
+		count, err := keyring.Rotate(db, bucket)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d values rotated\n", bucket, count)
+	}
+	return rotateRedis(keyring)
+}
+
+// rotateRedis re-encrypts reports of Redis outbox, it's safe while service is running
+func rotateRedis(keyring *store.Keyring) error {
+	addr := readConfig("redis/addr")
+	if addr == "" {
+		return nil
+	}
+	db, err := strconv.Atoi(readConfig("redis/db"))
+	if err != nil {
+		return fmt.Errorf("redis/db: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: readConfig("redis/password"), DB: db})
+	defer client.Close() // nolint: errcheck
+	queue := outbox.NewRedis(client, readConfig("redis/prefix"))
+	queue.Keyring = keyring
+	count, err := queue.Rotate()
+	if err != nil {
+		return fmt.Errorf("Redis outbox: %v", err)
+	}
+	fmt.Printf("Redis outbox: %d values rotated\n", count)
+	return nil
+}
+
+// readConfig returns first line of service config file, empty when file is missing
+func readConfig(name string) string {
+	data, err := os.ReadFile(filepath.Join(configDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func parseUint(s string) uint64 {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid number %q", s)
+	}
+	return n
+}
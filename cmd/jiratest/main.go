@@ -0,0 +1,30 @@
+// Package main provides standalone fake JIRA server for local development.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/qarea/jirams/jira/jiratest"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8081", "address to listen on")
+	seed := flag.Bool("seed", true, "add sample user, projects and issues")
+	login := flag.String("login", "", "login of extra user account")
+	password := flag.String("password", "", "password of extra user account")
+	flag.Parse()
+
+	fake := jiratest.NewFake()
+	if *seed {
+		user := fake.Seed()
+		log.Printf("Sample user: %s / %s", user.Login, user.Password)
+	}
+	if *login != "" {
+		fake.AddUser(jiratest.User{Login: *login, Password: *password, DisplayName: *login})
+	}
+
+	log.Printf("Fake JIRA listening on http://%s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, fake))
+}
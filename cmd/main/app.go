@@ -1,19 +1,42 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/rpc"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/powerman/narada-go/narada"
 	"github.com/powerman/narada-go/narada/bootstrap"
 	"github.com/powerman/rpc-codec/jsonrpc2"
 	"github.com/qarea/ctxtg"
 	"github.com/qarea/jirams/api"
+	"github.com/qarea/jirams/cache"
 	"github.com/qarea/jirams/cfg"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/events"
+	"github.com/qarea/jirams/health"
+	"github.com/qarea/jirams/idempotency"
 	"github.com/qarea/jirams/jira"
-	"github.com/qarea/jirams/store"
+	"github.com/qarea/jirams/maintenance"
+	"github.com/qarea/jirams/metrics"
+	"github.com/qarea/jirams/outbox"
+	"github.com/qarea/jirams/ratelimit"
+	"github.com/qarea/jirams/ssrf"
+	"github.com/qarea/jirams/tracing"
+	"github.com/qarea/jirams/tracing/traceid"
+	"github.com/qarea/jirams/webhook"
+	"github.com/qarea/jirams/ws"
 )
 
 type appParams struct {
@@ -21,20 +44,169 @@ type appParams struct {
 	PublicKey []byte
 }
 
-func start(params appParams) {
+// start serves requests until SIGTERM or SIGINT is received,
+// then fails readiness, stops accepting connections and waits for in-flight requests and background jobs to complete.
+// Returned error means service has stopped abnormally.
+func start(params appParams) error {
 	var (
 		httpListener net.Listener
+		draining     int32
 	)
-	userStore := store.New(params.BoltDB)
+	shutdownTracing, err := tracing.Setup(cfg.Tracing.Exporter, cfg.Tracing.Endpoint, "jirams")
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
+
+	trackerPolicy, err := ssrf.NewPolicy(cfg.Tracker.Allow, cfg.Tracker.Deny, cfg.Tracker.AllowOnly)
+	if err != nil {
+		panic(err)
+	}
+
+	trackerTLS, err := openTrackerTLS()
+	if err != nil {
+		panic(err)
+	}
+	proxy, err := openProxy()
+	if err != nil {
+		panic(err)
+	}
+
+	userStore := openUserStore(params.BoltDB)
 	jiraClient := jira.NewClient(userStore)
+	requester := &jira.Requester{
+		Cache:  jira.NewHTTPCache(cfg.Jira.HTTPCacheSize),
+		Dump:   cfg.Debug,
+		Policy: trackerPolicy,
+		TLS:    trackerTLS,
+		Proxy:  proxy,
+	}
+	breaker := jira.NewCircuitBreaker(requester, jira.BreakerConfig{
+		FailureThreshold: cfg.Jira.Breaker.FailureThreshold,
+		OpenTimeout:      cfg.Jira.Breaker.OpenTimeout,
+		HalfOpenRequests: cfg.Jira.Breaker.HalfOpenRequests,
+	})
+	jiraClient.Jira = breaker
 	tokenParser, err := ctxtg.NewRSATokenParser(params.PublicKey)
 	if err != nil {
 		panic(err)
 	}
-	rpcInterface := api.NewRPCAPI(jiraClient, tokenParser)
+	cachedClient := cache.NewClient(jiraClient, cache.TTL{
+		Projects:      cfg.Cache.ProjectsTTL,
+		CurrentUser:   cfg.Cache.CurrentUserTTL,
+		ProjectIssues: cfg.Cache.ProjectIssuesTTL,
+	})
+	redisClient := openRedis()
+	if redisClient != nil {
+		defer redisClient.Close()
+		cachedClient.Storage = cache.NewRedis(redisClient, cfg.Redis.Prefix)
+	}
+	// background jobs are stopped by closing their channels on return,
+	// stores are closed only after jobs finished their current work
+	var background sync.WaitGroup
+	defer background.Wait()
+	goBackground := func(job func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			job()
+		}()
+	}
+	maintenanceMode := &maintenance.Mode{}
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	goBackground(func() {
+		maintenanceMode.Watch(func() ([]byte, error) {
+			return narada.GetConfig("maintenance/state")
+		}, cfg.Maintenance.PollInterval, stopWatch)
+	})
+
+	rpcInterface := api.NewRPCAPI(cachedClient, tokenParser)
+	rpcInterface.Maintenance = maintenanceMode
+	rpcInterface.Trackers = requester
+	if redisClient != nil {
+		rpcInterface.UserLimit = ratelimit.NewRedis(redisClient, cfg.Redis.Prefix, cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst)
+		rpcInterface.TrackerLimit = ratelimit.NewRedis(redisClient, cfg.Redis.Prefix, cfg.RateLimit.TrackerRate, cfg.RateLimit.TrackerBurst)
+	} else {
+		rpcInterface.UserLimit = ratelimit.New(cfg.RateLimit.UserRate, cfg.RateLimit.UserBurst)
+		rpcInterface.TrackerLimit = ratelimit.New(cfg.RateLimit.TrackerRate, cfg.RateLimit.TrackerBurst)
+	}
+	if cfg.Idempotency.Window > 0 && redisClient != nil {
+		rpcInterface.Idempotency = idempotency.NewRedis(redisClient, cfg.Redis.Prefix, cfg.Idempotency.Window)
+	} else if cfg.Idempotency.Window > 0 {
+		rpcInterface.Idempotency = idempotency.New(params.BoltDB, cfg.Idempotency.Window)
+	}
+	if cfg.Outbox.Enabled {
+		keyring := openKeyring()
+		var reports outbox.Queue
+		if redisClient != nil {
+			queue := outbox.NewRedis(redisClient, cfg.Redis.Prefix)
+			queue.Keyring = keyring
+			reports = queue
+		} else {
+			queue := outbox.New(params.BoltDB)
+			queue.Keyring = keyring
+			reports = queue
+		}
+		if err := reports.Recover(traceid.New(context.Background())); err != nil {
+			panic(err)
+		}
+		rpcInterface.Outbox = reports
+		stopOutbox := make(chan struct{})
+		defer close(stopOutbox)
+		worker := outbox.NewWorker(reports, cachedClient, cfg.Outbox.Interval, cfg.Outbox.MinBackoff, cfg.Outbox.MaxBackoff)
+		worker.Maintenance = maintenanceMode
+		goBackground(func() { worker.Run(stopOutbox) })
+	}
 	rpc.Register(rpcInterface)
 
+	hub := events.NewHub()
+	hub.MaxTopics = cfg.Events.MaxSubscriptions
+	adminInterface := api.NewAdminAPI(cfg.AdminToken, maintenanceMode)
+	adminInterface.Webhooks = jiraClient
+	users, ok := userStore.(api.UserMappings)
+	if !ok {
+		return fmt.Errorf("user store %s doesn't support administration", cfg.Store.Backend)
+	}
+	adminInterface.Users = users
+	if cfg.Webhook.PublicURL != "" {
+		adminInterface.WebhookURL = func(trackerID entities.TrackerID) string {
+			return webhook.URL(cfg.Webhook.PublicURL, trackerID, cfg.Webhook.Secret)
+		}
+	}
+	rpc.Register(adminInterface)
+
+	stopPoller := make(chan struct{})
+	defer close(stopPoller)
+	poller := events.NewPoller(hub, cachedClient, cfg.Events.PollInterval)
+	poller.Limiter = rpcInterface.TrackerLimit
+	goBackground(func() { poller.Run(stopPoller) })
+
 	http.Handle(cfg.HTTP.BasePath+"/rpc", jsonrpc2.HTTPHandler(nil))
+	http.Handle(cfg.HTTP.BasePath+"/webhook", webhook.NewHandler(cfg.Webhook.Secret, cfg.Webhook.JWTSecret, cfg.HTTP.BasePath, cachedClient, poller))
+	wsHandler := ws.NewHandler(rpcInterface, hub, cfg.Events.Buffer, cfg.Events.AllowedOrigins)
+	http.Handle(cfg.HTTP.BasePath+"/ws", wsHandler)
+	checker := health.NewChecker(cfg.Health.Timeout)
+	checker.Add("store", userStore.Ping)
+	if redisClient != nil {
+		checker.Add("redis", func() error { return redisClient.Ping().Err() })
+	}
+	checker.Add("rsa_public_key", health.RSAPublicKey(params.PublicKey))
+	checker.Add("shutdown", func() error {
+		if atomic.LoadInt32(&draining) != 0 {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
+	for _, url := range cfg.Health.CanaryTrackers {
+		url := url
+		checker.Add("tracker "+url, func() error { return requester.Ping(url, cfg.Health.Timeout) })
+	}
+	http.Handle(cfg.HTTP.BasePath+"/healthz", health.LivenessHandler())
+	http.Handle(cfg.HTTP.BasePath+"/readyz", checker.ReadinessHandler())
+	http.Handle(cfg.HTTP.BasePath+"/metrics", adminInterface.Protect(metrics.Handler()))
+	http.Handle(cfg.HTTP.BasePath+"/status/cache", adminInterface.Protect(cachedClient.StatsHandler()))
+	http.Handle(cfg.HTTP.BasePath+"/status/breakers", adminInterface.Protect(breaker.StatusHandler()))
 	httpListener, err = net.Listen("tcp", cfg.HTTP.Listen)
 	if err != nil {
 		panic(err)
@@ -45,6 +217,31 @@ func start(params appParams) {
 		log.Fatal(err)
 	}
 
+	server := &http.Server{}
+	// hijacked WebSocket connections are not tracked by Shutdown
+	server.RegisterOnShutdown(wsHandler.Close)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(httpListener) }()
 	l.NOTICE("Listening on %s", httpListener.Addr().String())
-	l.Fatal(http.Serve(httpListener, nil))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to serve: %v", err)
+	case sig := <-signals:
+		l.NOTICE("Received %v, failing readiness for %v", sig, cfg.HTTP.ShutdownGrace)
+	}
+	signal.Stop(signals)
+
+	atomic.StoreInt32(&draining, 1)
+	time.Sleep(cfg.HTTP.ShutdownGrace)
+	l.NOTICE("Draining connections for up to %v", cfg.HTTP.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to drain connections: %v", err)
+	}
+	l.NOTICE("All connections drained")
+	return nil
 }
@@ -5,20 +5,28 @@ import (
 	"github.com/boltdb/bolt"
 	"github.com/qarea/jirams/cfg"
 
-	"github.com/powerman/narada-go/narada"
+	"github.com/qarea/jirams/redact"
 )
 
-var l = narada.NewLog("")
+var l = redact.NewLog("")
 
 func main() {
 	db, err := bolt.Open("var/bolt/store.db", 0666, nil)
 	if err != nil {
 		l.Fatal(err)
 	}
-	defer func() { _ = db.Close() }()
 
-	start(appParams{
+	err = start(appParams{
 		BoltDB:    db,
 		PublicKey: cfg.RSAPublicKey,
 	})
+
+	if err := db.Close(); err != nil {
+		l.ERR("Failed to close store: %v", err)
+	} else {
+		l.NOTICE("Store closed")
+	}
+	if err != nil {
+		l.Fatal(err)
+	}
 }
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/qarea/jirams/cfg"
+	"github.com/qarea/jirams/jira"
+)
+
+// openProxy creates proxy selector for tracker requests from config/proxy/
+func openProxy() (*jira.Proxy, error) {
+	if cfg.Proxy.URL != "" {
+		l.NOTICE("Using proxy for trackers")
+	}
+	return jira.NewProxy(jira.ProxyConfig{
+		URL:             cfg.Proxy.URL,
+		NoProxy:         strings.Join(cfg.Proxy.NoProxy, ","),
+		FromEnvironment: cfg.Proxy.FromEnvironment,
+		Trackers:        cfg.Proxy.Trackers,
+	})
+}
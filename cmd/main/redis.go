@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/qarea/jirams/cfg"
+)
+
+// openRedis returns client of Redis shared by all instances, nil when config/redis/addr is empty
+func openRedis() *redis.Client {
+	if cfg.Redis.Addr == "" {
+		return nil
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+	if err := client.Ping().Err(); err != nil {
+		panic(err)
+	}
+	l.NOTICE("Using Redis at %s for shared state", cfg.Redis.Addr)
+	return client
+}
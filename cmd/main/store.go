@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/boltdb/bolt"
+	// SQL drivers of supported user store backends
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/qarea/jirams/cfg"
+	"github.com/qarea/jirams/store"
+)
+
+// openUserStore returns user store selected by config/store/backend
+func openUserStore(boltDB *bolt.DB) store.Backend {
+	if cfg.Store.Backend == "bolt" {
+		return store.New(boltDB)
+	}
+	db, err := sql.Open(cfg.Store.Backend, cfg.Store.DSN)
+	if err != nil {
+		panic(err)
+	}
+	l.NOTICE("Using %s user store", cfg.Store.Backend)
+	return store.NewSQL(db, cfg.Store.Backend)
+}
+
+// openKeyring returns keys encrypting sensitive data selected by config/store/encryption_key_id
+func openKeyring() *store.Keyring {
+	keyring, err := store.ParseKeyring(cfg.Store.EncryptionKeys, cfg.Store.EncryptionKeyID)
+	if err != nil {
+		panic(err)
+	}
+	if keyring.Current == "" {
+		l.WARN("Sensitive data is stored unencrypted, please setup config/store/encryption_key_id")
+	}
+	return keyring
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/tls"
+
+	"github.com/qarea/jirams/cfg"
+	"github.com/qarea/jirams/jira"
+)
+
+// openTrackerTLS builds TLS configs of trackers from config/tls/
+func openTrackerTLS() (map[string]*tls.Config, error) {
+	configs := make(map[string]jira.TLSConfig, len(cfg.Tracker.TLS))
+	for key, c := range cfg.Tracker.TLS {
+		if c.InsecureSkipVerify {
+			l.WARN("TLS certificate verification is disabled for tracker %s", key)
+		}
+		configs[key] = jira.TLSConfig{
+			CA:                 c.CA,
+			Cert:               c.Cert,
+			Key:                c.Key,
+			Pins:               c.Pins,
+			InsecureSkipVerify: c.InsecureSkipVerify,
+		}
+	}
+	return jira.NewTLSConfigs(configs)
+}
@@ -90,3 +90,25 @@ type Duration uint64
 
 // ReportsTotal - total amount of reported time in seconds
 type ReportsTotal uint64
+
+// Webhook - tracker webhook registration
+type Webhook struct {
+	ID      uint64
+	Name    string
+	URL     string
+	Events  []string
+	JQL     string
+	Enabled bool
+}
+
+// PendingReport - report queued for delivery while tracker is unavailable
+type PendingReport struct {
+	ID          uint64
+	TrackerID   TrackerID
+	Report      Report
+	Status      string
+	Attempts    int
+	NextAttempt Timestamp
+	LastError   string
+	Created     Timestamp
+}
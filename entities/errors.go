@@ -2,44 +2,96 @@ package entities
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"net"
+	"net/url"
+	"time"
 
-	"github.com/powerman/narada-go/narada"
 	"github.com/powerman/rpc-codec/jsonrpc2"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing/traceid"
 )
 
 // Service specific API errors
 var (
-	ErrUnauthorized       = jsonrpc2.NewError(1, "INVALID_TOKEN")
-	ErrMaintenance        = jsonrpc2.NewError(4, "MAINTENANCE")
-	ErrServerUnavailable  = jsonrpc2.NewError(5, "REMOTE_SERVER_UNAVAILABLE")
-	ErrNotFound           = jsonrpc2.NewError(404, "NOT_FOUND")
-	ErrInvalidRequest     = jsonrpc2.NewError(101, "TRACKER_VALIDATION_ERROR")
-	ErrInvalidCredentials = jsonrpc2.NewError(102, "INVALID_CREDENTIALS")
-	ErrInvalidTrackerURL  = jsonrpc2.NewError(104, "INVALID_TRACKER_URL")
-	ErrProjectNotFound    = jsonrpc2.NewError(106, "PROJECT_NOT_FOUND")
-	ErrIssueNotFound      = jsonrpc2.NewError(107, "ISSUE_NOT_FOUND")
+	ErrUnauthorized      = jsonrpc2.NewError(1, "INVALID_TOKEN")
+	ErrMaintenance       = jsonrpc2.NewError(4, "MAINTENANCE")
+	ErrServerUnavailable = jsonrpc2.NewError(5, "REMOTE_SERVER_UNAVAILABLE")
+	ErrNotFound          = jsonrpc2.NewError(404, "NOT_FOUND")
+	ErrRateLimited       = jsonrpc2.NewError(429, "RATE_LIMITED")
+	// ErrIdempotencyKeyReused is returned when idempotency key is repeated with different request
+	ErrIdempotencyKeyReused = jsonrpc2.NewError(409, "IDEMPOTENCY_KEY_REUSED")
+	ErrInvalidRequest       = jsonrpc2.NewError(101, "TRACKER_VALIDATION_ERROR")
+	ErrInvalidCredentials   = jsonrpc2.NewError(102, "INVALID_CREDENTIALS")
+	ErrInvalidTrackerURL    = jsonrpc2.NewError(104, "INVALID_TRACKER_URL")
+	ErrProjectNotFound      = jsonrpc2.NewError(106, "PROJECT_NOT_FOUND")
+	ErrIssueNotFound        = jsonrpc2.NewError(107, "ISSUE_NOT_FOUND")
+	// ErrTooManySubscriptions is returned when connection subscribed to too many topics
+	ErrTooManySubscriptions = jsonrpc2.NewError(108, "TOO_MANY_SUBSCRIPTIONS")
+	// ErrServerFailed is sent to clients as ErrServerUnavailable, but tracker may have processed the request
+	ErrServerFailed = jsonrpc2.NewError(5, "REMOTE_SERVER_UNAVAILABLE")
 )
 
+// IsUnavailable reports whether error means tracker could not serve the request at all
+// and the request was not processed, so it is safe to send it again later:
+// connection was not established or tracker refused the request with 503.
+// Host which does not exist is not unavailable, it will never be reached.
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == ErrServerUnavailable {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial" || opErr.Op == "proxyconnect"
+	}
+	return false
+}
+
+// IsFailure reports whether error means tracker failed to serve the request.
+// Unlike IsUnavailable it includes failures after the request was sent, like timeouts and server errors,
+// so result of the request is unknown.
+func IsFailure(err error) bool {
+	if IsUnavailable(err) || err == ErrServerFailed {
+		return true
+	}
+	switch err.(type) {
+	case *url.Error, net.Error:
+		return true
+	}
+	return false
+}
+
 // NewServerError creates new JSON RPC error with given message
 func NewServerError(msg string) error {
 	return jsonrpc2.NewError(-32000, msg)
 }
 
+// Logger is a log errors are written to
+type Logger interface {
+	ERR(format string, v ...interface{})
+}
+
 // NewLoggedError logs the error and replaces it with an API error
-func NewLoggedError(l *narada.Log, ctx context.Context, err error, msg interface{}) error {
+func NewLoggedError(l Logger, ctx context.Context, err error, msg interface{}) error {
 	var test interface{} = err
 	_, ok := test.(*jsonrpc2.Error)
 	if ok { // error already processed upstream
 		return err
 	}
-	l.ERR(fmt.Sprintf("[%v] %v", ctx.Value("TracingID"), err.Error()))
+	l.ERR("[%s] %s", traceid.FromContext(ctx), redact.String(err.Error()))
 	if e, ok := msg.(error); ok {
 		return e
 	}
 	if s, ok := msg.(string); ok {
 		if s == "" {
-			s = err.Error()
+			s = redact.String(err.Error())
 		}
 		return NewServerError(s)
 	}
@@ -47,8 +99,40 @@ func NewLoggedError(l *narada.Log, ctx context.Context, err error, msg interface
 }
 
 // NewErrorLogger creates a curries version of NewLoggedError with context and message set
-func NewErrorLogger(l *narada.Log, ctx context.Context, msg string) func(error) error {
+func NewErrorLogger(l Logger, ctx context.Context, msg string) func(error) error {
 	return func(err error) error {
 		return NewLoggedError(l, ctx, err, msg)
 	}
 }
+
+// MaintenanceInfo - details of maintenance passed with ErrMaintenance
+type MaintenanceInfo struct {
+	ETA Timestamp
+}
+
+// NewMaintenanceError creates ErrMaintenance with optional expected end of maintenance
+func NewMaintenanceError(eta Timestamp) error {
+	if eta == 0 {
+		return ErrMaintenance
+	}
+	return &jsonrpc2.Error{
+		Code:    ErrMaintenance.Code,
+		Message: ErrMaintenance.Message,
+		Data:    MaintenanceInfo{ETA: eta},
+	}
+}
+
+// RateLimitInfo - details of rate limiting passed with ErrRateLimited
+type RateLimitInfo struct {
+	RetryAfter Duration
+}
+
+// NewRateLimitError creates ErrRateLimited with amount of seconds to wait before retry
+func NewRateLimitError(retryAfter time.Duration) error {
+	seconds := Duration((retryAfter + time.Second - 1) / time.Second)
+	return &jsonrpc2.Error{
+		Code:    ErrRateLimited.Code,
+		Message: ErrRateLimited.Message,
+		Data:    RateLimitInfo{RetryAfter: seconds},
+	}
+}
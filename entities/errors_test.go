@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnavailable(t *testing.T) {
+	cases := []struct {
+		err         error
+		unavailable bool
+		failure     bool
+	}{
+		{nil, false, false},
+		{ErrServerUnavailable, true, true},
+		{ErrServerFailed, false, true},
+		{ErrInvalidRequest, false, false},
+		{&url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true, true},
+		{&url.Error{Op: "Post", Err: &net.OpError{Op: "proxyconnect", Err: errors.New("connection refused")}}, true, true},
+		{&url.Error{Op: "Post", Err: &net.DNSError{Err: "server misbehaving", Name: "jira.example.com", IsTemporary: true}}, true, true},
+		{&url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "jira.example.com", IsNotFound: true}}}, false, true},
+		{&url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}, false, true},
+		{&url.Error{Op: "Post", Err: errors.New("context deadline exceeded (Client.Timeout exceeded while awaiting headers)")}, false, true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.unavailable, IsUnavailable(c.err), "%v", c.err)
+		assert.Equal(t, c.failure, IsFailure(c.err), "%v", c.err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package events delivers tracker change notifications to subscribers
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing"
+)
+
+var log = redact.NewLog("events: ")
+
+// Type of event
+type Type string
+
+// Event types, IssueRemoved means issue no longer belongs to subscribed topic (deleted, resolved or reassigned)
+const (
+	IssueCreated   Type = "issue_created"
+	IssueUpdated   Type = "issue_updated"
+	IssueRemoved   Type = "issue_removed"
+	WorklogCreated Type = "worklog_created"
+	WorklogUpdated Type = "worklog_updated"
+	WorklogDeleted Type = "worklog_deleted"
+)
+
+// Topic identifies project or issue changes, IssueID is zero for the whole project
+type Topic struct {
+	TrackerID entities.TrackerID
+	ProjectID entities.ProjectID
+	IssueID   entities.IssueID
+}
+
+// Event - change notification pushed to subscribers, ProjectID may be zero for worklog events
+type Event struct {
+	Type      Type
+	TrackerID entities.TrackerID
+	ProjectID entities.ProjectID
+	IssueID   entities.IssueID
+	Issue     *entities.Issue  `json:",omitempty"`
+	Report    *entities.Report `json:",omitempty"`
+	// Source is Fingerprint of tracker config the event data was fetched with,
+	// event is delivered only to topics subscribed with the same config
+	Source string `json:"-"`
+}
+
+// Fingerprint identifies tracker config with its credentials, users may see different data in the same topic
+func Fingerprint(tracker entities.TrackerConfig) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s\x00%s", tracker.ID, tracker.URL, tracker.Credentials.Login, tracker.Credentials.Password)))
+	return hex.EncodeToString(sum[:])
+}
+
+// matches reports whether event should be delivered to topic subscribers
+func (topic Topic) matches(event Event) bool {
+	if topic.TrackerID != event.TrackerID {
+		return false
+	}
+	if topic.IssueID != 0 {
+		return topic.IssueID == event.IssueID
+	}
+	return topic.ProjectID == event.ProjectID
+}
+
+// Target is a topic together with tracker config required to poll it
+type Target struct {
+	Topic
+	Tracker entities.TrackerConfig
+}
+
+// ErrTooManyTopics is returned when subscriber reached MaxTopics of the hub
+var ErrTooManyTopics = errors.New("too many subscribed topics")
+
+// Hub fans out published events to subscribers
+type Hub struct {
+	// MaxTopics limits topics of a single subscriber as every topic is polled separately, zero means no limit
+	MaxTopics int
+
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+// NewHub creates empty Hub
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[*Subscriber]struct{})}
+}
+
+// NewSubscriber registers subscriber with given amount of buffered events
+func (hub *Hub) NewSubscriber(buffer int) *Subscriber {
+	sub := &Subscriber{
+		C:       make(chan Event, buffer),
+		hub:     hub,
+		targets: make(map[Topic]entities.TrackerConfig),
+	}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Publish delivers event to all subscribers of matching topics made with tracker config of event Source,
+// dropping it for subscribers which are too slow
+func (hub *Hub) Publish(ctx context.Context, event Event) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	for sub := range hub.subscribers {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.C <- event:
+		default:
+			log.WARN("[%s] Subscriber buffer is full, dropping %s event for issue %d", tracing.ID(ctx), event.Type, event.IssueID)
+		}
+	}
+}
+
+// Targets returns all subscribed topics with tracker configs to poll them
+func (hub *Hub) Targets() []Target {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	seen := make(map[Target]bool)
+	var targets []Target
+	for sub := range hub.subscribers {
+		sub.mu.Lock()
+		for topic, tracker := range sub.targets {
+			target := Target{Topic: topic, Tracker: tracker}
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+		sub.mu.Unlock()
+	}
+	return targets
+}
+
+// Subscriber receives events of subscribed topics from C
+type Subscriber struct {
+	C chan Event
+
+	hub     *Hub
+	mu      sync.Mutex
+	targets map[Topic]entities.TrackerConfig
+}
+
+// Subscribe starts delivery of topic events, tracker config is used to poll changes
+func (sub *Subscriber) Subscribe(topic Topic, tracker entities.TrackerConfig) error {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if _, ok := sub.targets[topic]; !ok && sub.hub.MaxTopics > 0 && len(sub.targets) >= sub.hub.MaxTopics {
+		return ErrTooManyTopics
+	}
+	sub.targets[topic] = tracker
+	return nil
+}
+
+// Unsubscribe stops delivery of topic events
+func (sub *Subscriber) Unsubscribe(topic Topic) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	delete(sub.targets, topic)
+}
+
+// Topics returns currently subscribed topics
+func (sub *Subscriber) Topics() []Topic {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	topics := make([]Topic, 0, len(sub.targets))
+	for topic := range sub.targets {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Close unregisters subscriber, C is not closed to avoid races with Publish
+func (sub *Subscriber) Close() {
+	sub.hub.mu.Lock()
+	defer sub.hub.mu.Unlock()
+	delete(sub.hub.subscribers, sub)
+}
+
+func (sub *Subscriber) wants(event Event) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for topic, tracker := range sub.targets {
+		if topic.matches(event) && event.Source != "" && Fingerprint(tracker) == event.Source {
+			return true
+		}
+	}
+	return false
+}
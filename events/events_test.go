@@ -0,0 +1,277 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testTracker = entities.TrackerConfig{ID: 1, URL: "https://tracker.com"}
+	testSource  = Fingerprint(testTracker)
+)
+
+func TestPublish(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	project := hub.NewSubscriber(10)
+	project.Subscribe(Topic{TrackerID: 1, ProjectID: 2}, testTracker)
+	issue := hub.NewSubscriber(10)
+	issue.Subscribe(Topic{TrackerID: 1, IssueID: 3}, testTracker)
+
+	hub.Publish(context.Background(), Event{Type: IssueUpdated, TrackerID: 1, ProjectID: 2, IssueID: 3, Source: testSource})
+	hub.Publish(context.Background(), Event{Type: IssueUpdated, TrackerID: 1, ProjectID: 2, IssueID: 4, Source: testSource})
+	hub.Publish(context.Background(), Event{Type: IssueUpdated, TrackerID: 2, ProjectID: 2, IssueID: 3, Source: testSource})
+	a.Len(project.C, 2)
+	a.Len(issue.C, 1)
+
+	issue.Unsubscribe(Topic{TrackerID: 1, IssueID: 3})
+	hub.Publish(context.Background(), Event{Type: IssueUpdated, TrackerID: 1, ProjectID: 2, IssueID: 3, Source: testSource})
+	a.Len(issue.C, 1)
+
+	a.Len(project.C, 3)
+
+	project.Close()
+	hub.Publish(context.Background(), Event{Type: IssueUpdated, TrackerID: 1, ProjectID: 2, IssueID: 3, Source: testSource})
+	a.Len(project.C, 3)
+}
+
+func TestPublishOtherCredentials(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	alice := hub.NewSubscriber(10)
+	alice.Subscribe(Topic{TrackerID: 1, ProjectID: 2}, testTracker)
+	bobTracker := testTracker
+	bobTracker.Credentials.Login = "bob"
+	bob := hub.NewSubscriber(10)
+	bob.Subscribe(Topic{TrackerID: 1, ProjectID: 2}, bobTracker)
+
+	hub.Publish(context.Background(), Event{Type: IssueUpdated, TrackerID: 1, ProjectID: 2, IssueID: 3, Source: testSource})
+	hub.Publish(context.Background(), Event{Type: IssueUpdated, TrackerID: 1, ProjectID: 2, IssueID: 4})
+	a.Len(alice.C, 1)
+	a.Len(bob.C, 0)
+}
+
+func TestPublishSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	sub := hub.NewSubscriber(1)
+	sub.Subscribe(Topic{TrackerID: 1, ProjectID: 2}, testTracker)
+	hub.Publish(context.Background(), Event{TrackerID: 1, ProjectID: 2, IssueID: 3, Source: testSource})
+	hub.Publish(context.Background(), Event{TrackerID: 1, ProjectID: 2, IssueID: 4, Source: testSource})
+	assert.Len(t, sub.C, 1)
+}
+
+type testIssues struct {
+	issues []entities.Issue
+}
+
+func (s *testIssues) GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
+	*res = append([]entities.Issue(nil), s.issues...)
+	return nil
+}
+
+func (s *testIssues) GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
+	for _, issue := range s.issues {
+		if issue.ID == issueID {
+			*res = issue
+			return nil
+		}
+	}
+	return entities.ErrIssueNotFound
+}
+
+func TestPoll(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	source := &testIssues{issues: []entities.Issue{{ID: 1, Title: "one"}, {ID: 2, Title: "two"}}}
+	poller := NewPoller(hub, source, 0)
+	sub := hub.NewSubscriber(10)
+	sub.Subscribe(Topic{TrackerID: 1, ProjectID: 5}, testTracker)
+
+	poller.Poll(context.Background())
+	a.Len(sub.C, 0)
+
+	source.issues = []entities.Issue{{ID: 1, Title: "one"}, {ID: 2, Title: "changed"}, {ID: 3, Title: "three"}}
+	poller.Poll(context.Background())
+	got := map[entities.IssueID]Type{}
+	for len(sub.C) > 0 {
+		event := <-sub.C
+		a.Equal(entities.ProjectID(5), event.ProjectID)
+		got[event.IssueID] = event.Type
+	}
+	a.Equal(map[entities.IssueID]Type{2: IssueUpdated, 3: IssueCreated}, got)
+
+	source.issues = source.issues[1:]
+	poller.Poll(context.Background())
+	if a.Len(sub.C, 1) {
+		a.Equal(Event{Type: IssueRemoved, TrackerID: 1, ProjectID: 5, IssueID: 1, Source: testSource}, <-sub.C)
+	}
+
+	sub.Close()
+	poller.Poll(context.Background())
+	a.Empty(poller.snapshots)
+}
+
+type assignedIssues map[string][]entities.Issue
+
+func (s assignedIssues) GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
+	*res = append([]entities.Issue(nil), s[tracker.Credentials.Login]...)
+	return nil
+}
+
+func (s assignedIssues) GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
+	return entities.ErrIssueNotFound
+}
+
+func TestPollPerCredentials(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	source := assignedIssues{"alice": {{ID: 1, Title: "one"}}}
+	poller := NewPoller(hub, source, 0)
+	aliceTracker, bobTracker := testTracker, testTracker
+	aliceTracker.Credentials.Login = "alice"
+	bobTracker.Credentials.Login = "bob"
+	alice := hub.NewSubscriber(10)
+	alice.Subscribe(Topic{TrackerID: 1, ProjectID: 5}, aliceTracker)
+	bob := hub.NewSubscriber(10)
+	bob.Subscribe(Topic{TrackerID: 1, ProjectID: 5}, bobTracker)
+
+	poller.Poll(context.Background())
+	source["alice"] = []entities.Issue{{ID: 1, Title: "changed"}, {ID: 2, Title: "two"}}
+	poller.Poll(context.Background())
+	a.Len(alice.C, 2)
+	a.Len(bob.C, 0, "bob should not see issues assigned to alice")
+}
+
+func TestPollerPublish(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	source := assignedIssues{"alice": {{ID: 1, Title: "one"}}}
+	poller := NewPoller(hub, source, 0)
+	aliceTracker, bobTracker := testTracker, testTracker
+	aliceTracker.Credentials.Login = "alice"
+	bobTracker.Credentials.Login = "bob"
+	alice := hub.NewSubscriber(10)
+	alice.Subscribe(Topic{TrackerID: 1, ProjectID: 5}, aliceTracker)
+	bob := hub.NewSubscriber(10)
+	bob.Subscribe(Topic{TrackerID: 1, ProjectID: 5}, bobTracker)
+	poller.Poll(context.Background())
+
+	issue := entities.Issue{ID: 2, Title: "two"}
+	poller.Publish(context.Background(), Event{Type: IssueCreated, TrackerID: 1, ProjectID: 5, IssueID: 2, Issue: &issue})
+	a.Len(alice.C, 0, "webhook data should not be delivered as is")
+	a.Len(bob.C, 0)
+	a.Equal(entities.TrackerID(1), <-poller.refresh)
+
+	report := entities.Report{IssueID: 1, Duration: 60}
+	poller.Publish(context.Background(), Event{Type: WorklogCreated, TrackerID: 1, IssueID: 1, Report: &report})
+	if a.Len(alice.C, 1) {
+		event := <-alice.C
+		a.Equal(entities.ProjectID(5), event.ProjectID)
+		a.Equal(&report, event.Report)
+	}
+	a.Len(bob.C, 0, "bob has not seen the issue")
+	<-poller.refresh
+
+	source["alice"] = []entities.Issue{{ID: 1, Title: "one"}, issue}
+	poller.poll(context.Background(), 2)
+	a.Len(alice.C, 0, "other tracker should not be polled")
+	poller.poll(context.Background(), 1)
+	a.Len(alice.C, 1)
+	a.Len(bob.C, 0)
+}
+
+func TestSubscribeMaxTopics(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	hub.MaxTopics = 2
+	sub := hub.NewSubscriber(10)
+	a.NoError(sub.Subscribe(Topic{TrackerID: 1, ProjectID: 1}, testTracker))
+	a.NoError(sub.Subscribe(Topic{TrackerID: 1, ProjectID: 2}, testTracker))
+	a.Equal(ErrTooManyTopics, sub.Subscribe(Topic{TrackerID: 1, ProjectID: 3}, testTracker))
+	a.NoError(sub.Subscribe(Topic{TrackerID: 1, ProjectID: 2}, testTracker), "repeated subscription")
+	sub.Unsubscribe(Topic{TrackerID: 1, ProjectID: 1})
+	a.NoError(sub.Subscribe(Topic{TrackerID: 1, ProjectID: 3}, testTracker))
+	a.NoError(hub.NewSubscriber(10).Subscribe(Topic{TrackerID: 1, ProjectID: 1}, testTracker), "limit is per subscriber")
+}
+
+type testLimiter struct {
+	keys  []string
+	allow bool
+}
+
+func (l *testLimiter) Allow(ctx context.Context, key string) (bool, time.Duration) {
+	l.keys = append(l.keys, key)
+	return l.allow, time.Second
+}
+
+func TestPollLimit(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	source := &testIssues{issues: []entities.Issue{{ID: 1, Title: "one"}}}
+	poller := NewPoller(hub, source, 0)
+	limiter := &testLimiter{}
+	poller.Limiter = limiter
+	sub := hub.NewSubscriber(10)
+	sub.Subscribe(Topic{TrackerID: 1, ProjectID: 5}, testTracker)
+	sub.Subscribe(Topic{TrackerID: 1, IssueID: 1}, testTracker)
+
+	poller.Poll(context.Background())
+	a.Equal([]string{"tracker:1", "tracker:1"}, limiter.keys)
+	a.Empty(poller.snapshots, "topics should be skipped when limit is exceeded")
+
+	limiter.allow = true
+	poller.Poll(context.Background())
+	a.Len(poller.snapshots, 2)
+}
+
+// blockingIssues blocks fetches until released
+type blockingIssues struct {
+	testIssues
+	started, release chan struct{}
+}
+
+func (s *blockingIssues) GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
+	s.started <- struct{}{}
+	<-s.release
+	return s.testIssues.GetProjectIssues(ctx, tracker, projectID, userID, res)
+}
+
+func TestPollDoesNotBlockPublish(t *testing.T) {
+	a := assert.New(t)
+	hub := NewHub()
+	source := &blockingIssues{
+		testIssues: testIssues{issues: []entities.Issue{{ID: 1, Title: "one"}}},
+		started:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	poller := NewPoller(hub, source, 0)
+	sub := hub.NewSubscriber(10)
+	sub.Subscribe(Topic{TrackerID: 1, ProjectID: 5}, testTracker)
+	go func() { <-source.started; source.release <- struct{}{} }()
+	poller.Poll(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		poller.Poll(context.Background())
+		close(done)
+	}()
+	<-source.started
+	report := entities.Report{IssueID: 1, Duration: 60}
+	published := make(chan struct{})
+	go func() {
+		poller.Publish(context.Background(), Event{Type: WorklogCreated, TrackerID: 1, IssueID: 1, Report: &report})
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("webhook waits for poll")
+	}
+	a.Len(sub.C, 1)
+	close(source.release)
+	<-done
+}
@@ -0,0 +1,188 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/tracing"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+// IssueSource provides issues for polling
+type IssueSource interface {
+	GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error
+	GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error
+}
+
+// RateLimiter takes a token from bucket identified by key, returning time to wait when none left
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration)
+}
+
+// Poller periodically fetches subscribed topics with subscribers' tracker configs and publishes detected changes
+type Poller struct {
+	Hub      *Hub
+	Source   IssueSource
+	Interval time.Duration
+	// Limiter is charged for every fetch with the same per-tracker key as RPC calls, topics are skipped when exceeded
+	Limiter RateLimiter
+
+	mu        sync.Mutex
+	snapshots map[Target]map[entities.IssueID]entities.Issue
+	refresh   chan entities.TrackerID
+}
+
+// NewPoller creates Poller for subscriptions of given hub
+func NewPoller(hub *Hub, source IssueSource, interval time.Duration) *Poller {
+	return &Poller{
+		Hub:       hub,
+		Source:    source,
+		Interval:  interval,
+		snapshots: make(map[Target]map[entities.IssueID]entities.Issue),
+		refresh:   make(chan entities.TrackerID, 16),
+	}
+}
+
+// Run polls until stop is closed, topics of trackers which received webhooks are polled immediately
+func (poller *Poller) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(poller.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			poller.Poll(traceid.New(context.Background()))
+		case trackerID := <-poller.refresh:
+			poller.poll(traceid.New(context.Background()), trackerID)
+		}
+	}
+}
+
+// Poll fetches every subscribed topic once, the first fetch of a topic only remembers its state
+func (poller *Poller) Poll(ctx context.Context) {
+	poller.poll(ctx, 0)
+}
+
+// Publish handles event received by webhook. Event data is not checked against subscribers' access,
+// so issue changes are detected by polling topics of the tracker again.
+// Worklog events are delivered to topics which contained the issue on the last poll.
+func (poller *Poller) Publish(ctx context.Context, event Event) {
+	if event.Report != nil {
+		poller.publishWorklog(ctx, event)
+	}
+	select {
+	case poller.refresh <- event.TrackerID:
+	default: // refresh of the tracker is already pending or topics will be polled on schedule
+	}
+}
+
+// poll fetches topics of given tracker or all topics when trackerID is zero.
+// Snapshots are locked only to diff them, so webhooks are not delayed by fetches.
+func (poller *Poller) poll(ctx context.Context, trackerID entities.TrackerID) {
+	targets := poller.Hub.Targets()
+	active := make(map[Target]bool, len(targets))
+	for _, target := range targets {
+		active[target] = true
+		if trackerID != 0 && target.TrackerID != trackerID {
+			continue
+		}
+		if poller.Limiter != nil {
+			if ok, retryAfter := poller.Limiter.Allow(ctx, fmt.Sprintf("tracker:%d", target.TrackerID)); !ok {
+				log.WARN("[%s] Skipped poll of tracker %d project %d issue %d: rate limit exceeded, retry after %v", tracing.ID(ctx), target.TrackerID, target.ProjectID, target.IssueID, retryAfter)
+				continue
+			}
+		}
+		issues, err := poller.fetch(ctx, target)
+		if err != nil {
+			log.WARN("[%s] Failed to poll tracker %d project %d issue %d: %v", tracing.ID(ctx), target.TrackerID, target.ProjectID, target.IssueID, err)
+			continue
+		}
+		current := make(map[entities.IssueID]entities.Issue, len(issues))
+		for _, issue := range issues {
+			current[issue.ID] = issue
+		}
+		poller.mu.Lock()
+		previous, ok := poller.snapshots[target]
+		poller.snapshots[target] = current
+		poller.mu.Unlock()
+		if ok {
+			poller.publishChanges(ctx, target, previous, current)
+		}
+	}
+	poller.mu.Lock()
+	defer poller.mu.Unlock()
+	for target := range poller.snapshots {
+		if !active[target] {
+			delete(poller.snapshots, target)
+		}
+	}
+}
+
+func (poller *Poller) fetch(ctx context.Context, target Target) ([]entities.Issue, error) {
+	if target.IssueID == 0 {
+		var issues []entities.Issue
+		err := poller.Source.GetProjectIssues(ctx, target.Tracker, target.ProjectID, 0, &issues)
+		return issues, err
+	}
+	var issue entities.Issue
+	err := poller.Source.GetIssue(ctx, target.Tracker, target.IssueID, &issue)
+	if err == entities.ErrIssueNotFound || err == entities.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []entities.Issue{issue}, nil
+}
+
+func (poller *Poller) publishChanges(ctx context.Context, target Target, previous, current map[entities.IssueID]entities.Issue) {
+	source := Fingerprint(target.Tracker)
+	for id, issue := range current {
+		issue := issue
+		event := Event{TrackerID: target.TrackerID, ProjectID: target.ProjectID, IssueID: id, Issue: &issue, Source: source}
+		old, ok := previous[id]
+		switch {
+		case !ok:
+			event.Type = IssueCreated
+		case old != issue:
+			event.Type = IssueUpdated
+		default:
+			continue
+		}
+		poller.Hub.Publish(ctx, event)
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			poller.Hub.Publish(ctx, Event{Type: IssueRemoved, TrackerID: target.TrackerID, ProjectID: target.ProjectID, IssueID: id, Source: source})
+		}
+	}
+}
+
+// publishWorklog delivers worklog event once for every tracker config which has seen the issue,
+// project is taken from project topic containing the issue
+func (poller *Poller) publishWorklog(ctx context.Context, event Event) {
+	poller.mu.Lock()
+	projects := make(map[string]entities.ProjectID)
+	for target, snapshot := range poller.snapshots {
+		if target.TrackerID != event.TrackerID {
+			continue
+		}
+		if _, ok := snapshot[event.IssueID]; !ok {
+			continue
+		}
+		source := Fingerprint(target.Tracker)
+		if target.IssueID == 0 || projects[source] == 0 {
+			projects[source] = target.ProjectID
+		}
+	}
+	poller.mu.Unlock()
+	for source, projectID := range projects {
+		e := event
+		e.ProjectID, e.Source = projectID, source
+		poller.Hub.Publish(ctx, e)
+	}
+}
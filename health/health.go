@@ -0,0 +1,171 @@
+// Package health provides liveness and readiness HTTP endpoints
+package health
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check returns nil if checked dependency is healthy
+type Check func() error
+
+// Statuses of checks
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckResult - result of a single check
+type CheckResult struct {
+	Name     string
+	Status   string
+	Error    string `json:",omitempty"`
+	Duration string
+}
+
+// Result - overall readiness status with results of all checks
+type Result struct {
+	Status string
+	Checks []CheckResult
+}
+
+// Checker runs named readiness checks
+type Checker struct {
+	// Timeout limits time spent waiting for a single check
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	names  []string
+	checks map[string]Check
+}
+
+// NewChecker creates an instance of Checker
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{Timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Add registers readiness check under given name
+func (checker *Checker) Add(name string, check Check) {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	if _, ok := checker.checks[name]; !ok {
+		checker.names = append(checker.names, name)
+	}
+	checker.checks[name] = check
+}
+
+// Run executes all checks concurrently and returns their results
+func (checker *Checker) Run() Result {
+	checker.mu.Lock()
+	names := append([]string(nil), checker.names...)
+	checks := make(map[string]Check, len(checker.checks))
+	for name, check := range checker.checks {
+		checks[name] = check
+	}
+	checker.mu.Unlock()
+
+	res := Result{Status: StatusOK, Checks: make([]CheckResult, len(names))}
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			res.Checks[i] = checker.run(name, checks[name])
+		}(i, name)
+	}
+	wg.Wait()
+
+	sort.Sort(byName(res.Checks))
+	for _, check := range res.Checks {
+		if check.Status != StatusOK {
+			res.Status = StatusFail
+		}
+	}
+	return res
+}
+
+func (checker *Checker) run(name string, check Check) CheckResult {
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check() }()
+
+	var err error
+	if checker.Timeout > 0 {
+		select {
+		case err = <-done:
+		case <-time.After(checker.Timeout):
+			err = errors.New("timeout")
+		}
+	} else {
+		err = <-done
+	}
+
+	res := CheckResult{Name: name, Status: StatusOK, Duration: time.Since(started).String()}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// ReadinessHandler returns HTTP handler reporting results of all checks,
+// it responds with 503 status if any check fails
+func (checker *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := checker.Run()
+		status := http.StatusOK
+		if res.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, res)
+	})
+}
+
+// LivenessHandler returns HTTP handler reporting that process is able to serve requests
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Result{Status: StatusOK, Checks: []CheckResult{}})
+	})
+}
+
+// RSAPublicKey returns a check verifying that key is a valid PEM encoded RSA public key
+func RSAPublicKey(key []byte) Check {
+	return func() error {
+		block, _ := pem.Decode(key)
+		if block == nil {
+			return errors.New("failed to decode PEM block")
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			cert, certErr := x509.ParseCertificate(block.Bytes)
+			if certErr != nil {
+				return err
+			}
+			pub = cert.PublicKey
+		}
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			return errors.New("not an RSA public key")
+		}
+		return nil
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type byName []CheckResult
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
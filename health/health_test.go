@@ -0,0 +1,72 @@
+package health
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	a := assert.New(t)
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Add("ok", func() error { return nil })
+
+	srv := httptest.NewServer(checker.ReadinessHandler())
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL)
+	a.NoError(err)
+	var res Result
+	a.NoError(json.NewDecoder(response.Body).Decode(&res))
+	response.Body.Close()
+	a.Equal(http.StatusOK, response.StatusCode)
+	a.Equal(StatusOK, res.Status)
+
+	checker.Add("broken", func() error { return errors.New("broken") })
+	checker.Add("slow", func() error { time.Sleep(time.Second); return nil })
+	response, err = http.Get(srv.URL)
+	a.NoError(err)
+	a.NoError(json.NewDecoder(response.Body).Decode(&res))
+	response.Body.Close()
+	a.Equal(http.StatusServiceUnavailable, response.StatusCode)
+	a.Equal(StatusFail, res.Status)
+	if a.Len(res.Checks, 3) {
+		a.Equal(CheckResult{Name: "broken", Status: StatusFail, Error: "broken", Duration: res.Checks[0].Duration}, res.Checks[0])
+		a.Equal(StatusOK, res.Checks[1].Status)
+		a.Equal("timeout", res.Checks[2].Error)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(LivenessHandler())
+	defer srv.Close()
+
+	response, err := http.Get(srv.URL)
+	a.NoError(err)
+	defer response.Body.Close()
+	a.Equal(http.StatusOK, response.StatusCode)
+	a.Equal("application/json", response.Header.Get("Content-Type"))
+}
+
+func TestRSAPublicKey(t *testing.T) {
+	a := assert.New(t)
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	a.NoError(err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	a.NoError(err)
+	valid := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	a.NoError(RSAPublicKey(valid)())
+	a.Error(RSAPublicKey([]byte("1"))())
+	a.Error(RSAPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("junk")}))())
+}
@@ -0,0 +1,211 @@
+// Package idempotency remembers results of non-idempotent calls to answer client retries without repeating them
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+var log = redact.NewLog("idempotency: ")
+
+const (
+	idempotencyBucket = "Idempotency"
+	sweepInterval     = time.Minute
+)
+
+type record struct {
+	Created  int64
+	Request  []byte
+	Response json.RawMessage
+}
+
+// Store implements BoltDB backed storage of call results
+type Store struct {
+	DB *bolt.DB
+	// Window defines how long results are kept
+	Window time.Duration
+
+	mu        sync.Mutex
+	locks     map[string]*keyLock
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// New creates an instance of Store keeping results for given window
+func New(db *bolt.DB, window time.Duration) *Store {
+	res := &Store{
+		DB:     db,
+		Window: window,
+		locks:  make(map[string]*keyLock),
+		now:    time.Now,
+	}
+	res.Init()
+	return res
+}
+
+// Init initializes BoltDB storage if needed
+func (store *Store) Init() {
+	_ = store.DB.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(idempotencyBucket)); err != nil {
+			log.Fatal("Failed to create idempotency store")
+		}
+		return nil
+	})
+}
+
+// Do runs handler once per scope and key within window, storing res on success.
+// Repeated calls get stored result in res, calls with same key but another request are rejected.
+// Concurrent calls with same key wait for the first one to complete.
+func (store *Store) Do(ctx context.Context, scope, key string, request, res interface{}, handler func() error) error {
+	id := scope + "\x00" + key
+	unlock := store.lock(id)
+	defer unlock()
+
+	requestHash, err := hash(request)
+	if err != nil {
+		return err
+	}
+	found, err := store.get(id)
+	if err != nil {
+		return err
+	}
+	if found != nil {
+		return found.replay(ctx, scope, requestHash, res)
+	}
+
+	if err := handler(); err != nil {
+		return err
+	}
+	response, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	err = store.put(id, record{Created: store.now().Unix(), Request: requestHash, Response: response})
+	if err != nil {
+		// call has succeeded, failure to remember it should not make client retry
+		log.ERR("[%s] Failed to store result for %s: %v", traceid.FromContext(ctx), scope, err)
+	}
+	return nil
+}
+
+// replay returns stored result in res unless key was used with another request
+func (r *record) replay(ctx context.Context, scope string, requestHash []byte, res interface{}) error {
+	if !bytes.Equal(r.Request, requestHash) {
+		return entities.ErrIdempotencyKeyReused
+	}
+	log.DEBUG("[%s] Returning stored result for %s", traceid.FromContext(ctx), scope)
+	return json.Unmarshal(r.Response, res)
+}
+
+func (store *Store) lock(id string) func() {
+	store.mu.Lock()
+	l, ok := store.locks[id]
+	if !ok {
+		l = &keyLock{}
+		store.locks[id] = l
+	}
+	l.refs++
+	store.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		store.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(store.locks, id)
+		}
+		store.mu.Unlock()
+	}
+}
+
+func (store *Store) get(id string) (res *record, err error) {
+	err = store.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(idempotencyBucket)).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		if store.expired(r) {
+			return nil
+		}
+		res = &r
+		return nil
+	})
+	return
+}
+
+func (store *Store) put(id string, r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(idempotencyBucket))
+		if err := store.sweep(bucket); err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+}
+
+// sweep removes expired records once per sweepInterval
+func (store *Store) sweep(bucket *bolt.Bucket) error {
+	store.mu.Lock()
+	now := store.now()
+	due := now.Sub(store.lastSweep) >= sweepInterval
+	if due {
+		store.lastSweep = now
+	}
+	store.mu.Unlock()
+	if !due {
+		return nil
+	}
+	var expired [][]byte
+	err := bucket.ForEach(func(k, v []byte) error {
+		var r record
+		if err := json.Unmarshal(v, &r); err != nil || store.expired(r) {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *Store) expired(r record) bool {
+	return store.now().Sub(time.Unix(r.Created, 0)) >= store.Window
+}
+
+func hash(request interface{}) ([]byte, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
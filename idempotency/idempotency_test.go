@@ -0,0 +1,104 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) (*Store, *time.Time) {
+	dir, err := os.MkdirTemp("", "idempotency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "store.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+	now := time.Unix(1482400800, 0)
+	store := New(db, time.Hour)
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestDo(t *testing.T) {
+	a := assert.New(t)
+	store, now := newTestStore(t)
+	calls := 0
+	create := func(res *entities.Issue) func() error {
+		return func() error {
+			calls++
+			*res = entities.Issue{ID: entities.IssueID(calls)}
+			return nil
+		}
+	}
+
+	var res entities.Issue
+	a.NoError(store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, create(&res)))
+	a.Equal(entities.IssueID(1), res.ID)
+
+	// duplicate gets original result
+	res = entities.Issue{}
+	a.NoError(store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, create(&res)))
+	a.Equal(entities.IssueID(1), res.ID)
+	a.Equal(1, calls)
+
+	// same key with another request or in another scope
+	a.Equal(entities.ErrIdempotencyKeyReused, store.Do(context.Background(), "CreateIssue:1:1", "key", "other", &res, create(&res)))
+	a.NoError(store.Do(context.Background(), "CreateIssue:2:1", "key", "request", &res, create(&res)))
+	a.Equal(2, calls)
+
+	// result is forgotten after window
+	*now = now.Add(time.Hour)
+	a.NoError(store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, create(&res)))
+	a.Equal(3, calls)
+}
+
+func TestDoFailed(t *testing.T) {
+	a := assert.New(t)
+	store, _ := newTestStore(t)
+	var res entities.Issue
+	a.Error(store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, func() error { return errors.New("failed") }))
+
+	// failed calls are not remembered
+	called := false
+	a.NoError(store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, func() error { called = true; return nil }))
+	a.True(called)
+}
+
+func TestDoConcurrent(t *testing.T) {
+	store, _ := newTestStore(t)
+	var (
+		mu    sync.Mutex
+		calls int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var res entities.Issue
+			_ = store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, store.locks)
+}
@@ -0,0 +1,147 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+const (
+	defaultLockTTL      = time.Minute
+	defaultPollInterval = 100 * time.Millisecond
+)
+
+// ErrInProgress is returned when call with the same key is still running on another instance
+var ErrInProgress = entities.NewServerError("Request with the same idempotency key is in progress")
+
+// unlock removes lock KEYS[1] only if it's still held by token ARGV[1]
+var unlock = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Redis implements storage of call results shared by several adapter instances
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+	// Window defines how long results are kept
+	Window time.Duration
+	// LockTTL bounds how long a call holds its key, calls waiting for it give up after the same time
+	LockTTL time.Duration
+	// PollInterval defines how often waiting calls check for the result
+	PollInterval time.Duration
+}
+
+// NewRedis creates an instance of Redis keeping results for given window under given key prefix
+func NewRedis(client *redis.Client, prefix string, window time.Duration) *Redis {
+	return &Redis{
+		Client:       client,
+		Prefix:       prefix + "idempotency:",
+		Window:       window,
+		LockTTL:      defaultLockTTL,
+		PollInterval: defaultPollInterval,
+	}
+}
+
+// Do runs handler once per scope and key within window, storing res on success.
+// Repeated calls get stored result in res, calls with same key but another request are rejected.
+// Concurrent calls with same key on any instance wait for the first one to complete.
+func (store *Redis) Do(ctx context.Context, scope, key string, request, res interface{}, handler func() error) error {
+	id := store.Prefix + scope + "\x00" + key
+	requestHash, err := hash(request)
+	if err != nil {
+		return err
+	}
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(store.LockTTL)
+	for {
+		found, err := store.get(id)
+		if err != nil {
+			return err
+		}
+		if found != nil {
+			return found.replay(ctx, scope, requestHash, res)
+		}
+		locked, err := store.Client.SetNX(id+"\x00lock", token, store.LockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			return ErrInProgress
+		}
+		time.Sleep(store.PollInterval)
+	}
+	defer func() {
+		if err := unlock.Run(store.Client, []string{id + "\x00lock"}, token).Err(); err != nil {
+			log.ERR("[%s] Failed to unlock %s: %v", traceid.FromContext(ctx), scope, err)
+		}
+	}()
+
+	// result may have been stored between check and lock
+	found, err := store.get(id)
+	if err != nil {
+		return err
+	}
+	if found != nil {
+		return found.replay(ctx, scope, requestHash, res)
+	}
+
+	if err := handler(); err != nil {
+		return err
+	}
+	response, err := json.Marshal(res)
+	if err == nil {
+		err = store.put(id, record{Created: time.Now().Unix(), Request: requestHash, Response: response})
+	}
+	if err != nil {
+		// call has succeeded, failure to remember it should not make client retry
+		log.ERR("[%s] Failed to store result for %s: %v", traceid.FromContext(ctx), scope, err)
+	}
+	return nil
+}
+
+func (store *Redis) get(id string) (*record, error) {
+	data, err := store.Client.Get(id).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (store *Redis) put(id string, r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return store.Client.Set(id, data, store.Window).Err()
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
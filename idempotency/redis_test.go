@@ -0,0 +1,92 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+func TestRedisDo(t *testing.T) {
+	a := assert.New(t)
+	server, client := newTestRedis(t)
+	store := NewRedis(client, "jirams:", time.Hour)
+	other := NewRedis(client, "jirams:", time.Hour)
+	calls := 0
+	create := func(res *entities.Issue) func() error {
+		return func() error {
+			calls++
+			*res = entities.Issue{ID: entities.IssueID(calls)}
+			return nil
+		}
+	}
+
+	var res entities.Issue
+	a.NoError(store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, create(&res)))
+	a.Equal(entities.IssueID(1), res.ID)
+
+	// duplicate sent to another instance gets original result
+	res = entities.Issue{}
+	a.NoError(other.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, create(&res)))
+	a.Equal(entities.IssueID(1), res.ID)
+	a.Equal(1, calls)
+	a.Equal(entities.ErrIdempotencyKeyReused, other.Do(context.Background(), "CreateIssue:1:1", "key", "other", &res, create(&res)))
+
+	// result is forgotten after window
+	server.FastForward(time.Hour)
+	a.NoError(other.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, create(&res)))
+	a.Equal(2, calls)
+}
+
+func TestRedisDoConcurrent(t *testing.T) {
+	_, client := newTestRedis(t)
+	var (
+		mu    sync.Mutex
+		calls int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store := NewRedis(client, "jirams:", time.Hour)
+			store.PollInterval = time.Millisecond
+			var res entities.Issue
+			_ = store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls)
+}
+
+func TestRedisDoInProgress(t *testing.T) {
+	a := assert.New(t)
+	_, client := newTestRedis(t)
+	store := NewRedis(client, "jirams:", time.Hour)
+	store.LockTTL = 10 * time.Millisecond
+	store.PollInterval = time.Millisecond
+
+	// nested call with the same key emulates duplicate arriving while the first one runs
+	var res entities.Issue
+	err := store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, func() error {
+		return store.Do(context.Background(), "CreateIssue:1:1", "key", "request", &res, func() error { return nil })
+	})
+	a.Equal(ErrInProgress, err)
+}
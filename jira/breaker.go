@@ -0,0 +1,202 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/tracing"
+)
+
+// BreakerState - state of a tracker circuit
+type BreakerState int
+
+// Circuit breaker states
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (state BreakerState) String() string {
+	switch state {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (state BreakerState) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+// BreakerConfig - circuit breaker thresholds
+type BreakerConfig struct {
+	// FailureThreshold is amount of consecutive failures opening the circuit, zero disables breaker
+	FailureThreshold int
+	// OpenTimeout is time circuit stays open before trial requests are allowed
+	OpenTimeout time.Duration
+	// HalfOpenRequests is amount of successful trial requests required to close the circuit
+	HalfOpenRequests int
+}
+
+// BreakerStatus - current state of a tracker circuit
+type BreakerStatus struct {
+	TrackerID entities.TrackerID
+	State     BreakerState
+	Failures  int
+	OpenedAt  time.Time `json:",omitempty"`
+}
+
+type circuit struct {
+	state     BreakerState
+	failures  int
+	successes int
+	probes    int
+	openedAt  time.Time
+}
+
+// CircuitBreaker implements TrackerRequester which fails fast while tracker is unavailable
+type CircuitBreaker struct {
+	Next   TrackerRequester
+	Config BreakerConfig
+
+	mu       sync.Mutex
+	circuits map[entities.TrackerID]*circuit
+	now      func() time.Time
+}
+
+// NewCircuitBreaker creates circuit breaker around given requester
+func NewCircuitBreaker(next TrackerRequester, config BreakerConfig) *CircuitBreaker {
+	if config.HalfOpenRequests < 1 {
+		config.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		Next:     next,
+		Config:   config,
+		circuits: make(map[entities.TrackerID]*circuit),
+		now:      time.Now,
+	}
+}
+
+// Request performs request unless tracker circuit is open
+func (breaker *CircuitBreaker) Request(tracker entities.TrackerConfig, request *http.Request, res interface{}) error {
+	if err := breaker.allow(tracker.ID); err != nil {
+		return err
+	}
+	err := breaker.Next.Request(tracker, request, res)
+	breaker.done(request.Context(), tracker.ID, err)
+	return err
+}
+
+// IterateRequest performs iteration of requests unless tracker circuit is open
+func (breaker *CircuitBreaker) IterateRequest(ctx context.Context, tracker entities.TrackerConfig, url string, dataContainer interface{}, callback func(interface{}) (int, int, error)) error {
+	if err := breaker.allow(tracker.ID); err != nil {
+		return err
+	}
+	err := breaker.Next.IterateRequest(ctx, tracker, url, dataContainer, callback)
+	breaker.done(ctx, tracker.ID, err)
+	return err
+}
+
+// Status returns state of all known tracker circuits
+func (breaker *CircuitBreaker) Status() []BreakerStatus {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	res := make([]BreakerStatus, 0, len(breaker.circuits))
+	for id, c := range breaker.circuits {
+		res = append(res, BreakerStatus{
+			TrackerID: id,
+			State:     c.state,
+			Failures:  c.failures,
+			OpenedAt:  c.openedAt,
+		})
+	}
+	sort.Sort(byTrackerID(res))
+	return res
+}
+
+// StatusHandler returns HTTP handler reporting state of tracker circuits as JSON
+func (breaker *CircuitBreaker) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(breaker.Status())
+	})
+}
+
+func (breaker *CircuitBreaker) allow(trackerID entities.TrackerID) error {
+	if breaker.Config.FailureThreshold <= 0 {
+		return nil
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	c := breaker.circuit(trackerID)
+	if c.state == BreakerOpen {
+		if breaker.now().Sub(c.openedAt) < breaker.Config.OpenTimeout {
+			return entities.ErrServerUnavailable
+		}
+		c.state = BreakerHalfOpen
+		c.successes = 0
+		c.probes = 0
+	}
+	if c.state == BreakerHalfOpen {
+		if c.probes >= breaker.Config.HalfOpenRequests {
+			return entities.ErrServerUnavailable
+		}
+		c.probes++
+	}
+	return nil
+}
+
+func (breaker *CircuitBreaker) done(ctx context.Context, trackerID entities.TrackerID, err error) {
+	if breaker.Config.FailureThreshold <= 0 {
+		return
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	c := breaker.circuit(trackerID)
+	if entities.IsFailure(err) {
+		c.failures++
+		if c.state == BreakerHalfOpen || c.failures >= breaker.Config.FailureThreshold {
+			if c.state != BreakerOpen {
+				l.WARN("[%s] Tracker %d is unavailable, opening circuit", tracing.ID(ctx), trackerID)
+			}
+			c.state = BreakerOpen
+			c.openedAt = breaker.now()
+		}
+		return
+	}
+	c.failures = 0
+	if c.state == BreakerHalfOpen {
+		c.successes++
+		if c.successes >= breaker.Config.HalfOpenRequests {
+			l.NOTICE("[%s] Tracker %d is available again, closing circuit", tracing.ID(ctx), trackerID)
+			c.state = BreakerClosed
+			c.openedAt = time.Time{}
+		}
+	}
+}
+
+func (breaker *CircuitBreaker) circuit(trackerID entities.TrackerID) *circuit {
+	c, ok := breaker.circuits[trackerID]
+	if !ok {
+		c = &circuit{}
+		breaker.circuits[trackerID] = c
+	}
+	return c
+}
+
+type byTrackerID []BreakerStatus
+
+func (s byTrackerID) Len() int           { return len(s) }
+func (s byTrackerID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byTrackerID) Less(i, j int) bool { return s[i].TrackerID < s[j].TrackerID }
@@ -0,0 +1,90 @@
+package jira
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingRequester struct {
+	TestJiraRequesterErr
+	calls int
+}
+
+func (t *countingRequester) Request(tracker entities.TrackerConfig, request *http.Request, res interface{}) error {
+	t.calls++
+	return t.err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	next := &countingRequester{}
+	next.err = entities.ErrServerUnavailable
+	breaker := NewCircuitBreaker(next, BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 1,
+	})
+	breaker.now = func() time.Time { return now }
+	request, _ := http.NewRequest("GET", "https://tracker.com", nil)
+
+	// circuit opens after threshold is reached
+	a.Equal(entities.ErrServerUnavailable, breaker.Request(testTracker, request, nil))
+	a.Equal(entities.ErrServerUnavailable, breaker.Request(testTracker, request, nil))
+	a.Equal(BreakerOpen, breaker.Status()[0].State)
+
+	// open circuit fails fast
+	a.Equal(entities.ErrServerUnavailable, breaker.Request(testTracker, request, nil))
+	a.Equal(2, next.calls)
+
+	// other trackers are not affected
+	other := testTracker
+	other.ID = 2
+	next.err = nil
+	a.NoError(breaker.Request(other, request, nil))
+	a.Equal(3, next.calls)
+
+	// failed trial request opens circuit again
+	now = now.Add(2 * time.Minute)
+	next.err = entities.ErrServerUnavailable
+	a.Equal(entities.ErrServerUnavailable, breaker.Request(testTracker, request, nil))
+	a.Equal(4, next.calls)
+	a.Equal(BreakerOpen, breaker.Status()[0].State)
+
+	// successful trial request closes circuit
+	now = now.Add(2 * time.Minute)
+	next.err = entities.ErrNotFound
+	a.Equal(entities.ErrNotFound, breaker.Request(testTracker, request, nil))
+	a.Equal(BreakerClosed, breaker.Status()[0].State)
+	a.Equal(5, next.calls)
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	a := assert.New(t)
+	next := &countingRequester{}
+	next.err = entities.ErrServerUnavailable
+	breaker := NewCircuitBreaker(next, BreakerConfig{})
+	request, _ := http.NewRequest("GET", "https://tracker.com", nil)
+	for i := 0; i < 10; i++ {
+		a.Equal(entities.ErrServerUnavailable, breaker.Request(testTracker, request, nil))
+	}
+	a.Equal(10, next.calls)
+	a.Len(breaker.Status(), 0)
+}
+
+func TestCircuitBreakerNetworkError(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	breaker := NewCircuitBreaker(&Requester{}, BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute})
+	request, _ := http.NewRequest("GET", srv.URL, nil)
+	a.Error(breaker.Request(testTracker, request, nil))
+	request, _ = http.NewRequest("GET", srv.URL, nil)
+	a.Equal(entities.ErrServerUnavailable, breaker.Request(testTracker, request, nil))
+}
@@ -0,0 +1,262 @@
+// Package cassette records sanitized JIRA HTTP interactions and replays them offline
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// BaseURL replaces recorded JIRA URL, trackers replaying cassettes should use it
+	BaseURL = "https://jira.example.com"
+	// Email replaces all recorded email addresses
+	Email = "user@example.com"
+	// CatalogFile is name of catalog file in cassettes directory
+	CatalogFile = "catalog.json"
+)
+
+var emailRegexp = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// Cassette is a list of HTTP interactions recorded for single scenario
+type Cassette struct {
+	Interactions []Interaction
+	// Result is sanitized result of the scenario, replay should produce the same one
+	Result json.RawMessage `json:",omitempty"`
+}
+
+// Interaction is a recorded request with its response
+type Interaction struct {
+	Method string
+	// URL is request URI without scheme and host
+	URL         string
+	RequestBody string `json:",omitempty"`
+	Status      int
+	ContentType string `json:",omitempty"`
+	Body        string
+}
+
+// Load reads cassette from file
+func Load(path string) (*Cassette, error) {
+	var res Cassette
+	if err := readJSON(path, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Save writes cassette to file creating its directory if needed
+func (cassette *Cassette) Save(path string) error {
+	return writeJSON(path, cassette)
+}
+
+// Entry describes cassettes recorded against single JIRA version
+type Entry struct {
+	// Version is name of JIRA version, e.g. "Server 7.13"
+	Version string
+	// Deployment is one of Server, Data Center, Cloud or Fake
+	Deployment string
+	// Dir is cassettes directory relative to catalog
+	Dir string
+	// Params are scenario parameters matching recorded data
+	Params json.RawMessage `json:",omitempty"`
+}
+
+// Catalog lists cassettes of all recorded JIRA versions
+type Catalog []Entry
+
+// LoadCatalog reads catalog from file, missing file means empty catalog
+func LoadCatalog(path string) (Catalog, error) {
+	var res Catalog
+	err := readJSON(path, &res)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return res, err
+}
+
+// Save writes catalog to file
+func (catalog Catalog) Save(path string) error {
+	return writeJSON(path, catalog)
+}
+
+// Put adds entry replacing one with the same Dir
+func (catalog Catalog) Put(entry Entry) Catalog {
+	for i := range catalog {
+		if catalog[i].Dir == entry.Dir {
+			catalog[i] = entry
+			return catalog
+		}
+	}
+	return append(catalog, entry)
+}
+
+// Sanitizer scrubs JIRA URL, credentials and emails from recorded data
+type Sanitizer struct {
+	// BaseURL of recorded JIRA is replaced by cassette.BaseURL
+	BaseURL string
+	// Secrets maps sensitive values (login, password, user key) to their replacements
+	Secrets map[string]string
+}
+
+// Sanitize returns s with all sensitive values replaced
+func (sanitizer Sanitizer) Sanitize(s string) string {
+	if sanitizer.BaseURL != "" {
+		s = strings.Replace(s, strings.TrimSuffix(sanitizer.BaseURL, "/"), BaseURL, -1)
+	}
+	secrets := make([]string, 0, len(sanitizer.Secrets))
+	for secret := range sanitizer.Secrets {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	// longer secrets first, so ones containing others are replaced completely
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, sanitizer.Secrets[secret], -1)
+	}
+	return emailRegexp.ReplaceAllString(s, Email)
+}
+
+// Recorder is http.RoundTripper recording sanitized interactions into Cassette
+type Recorder struct {
+	// Next makes actual requests, http.DefaultTransport is used when nil
+	Next      http.RoundTripper
+	Cassette  *Cassette
+	Sanitizer Sanitizer
+
+	mu sync.Mutex
+}
+
+// NewRecorder creates Recorder writing to empty cassette
+func NewRecorder(next http.RoundTripper, sanitizer Sanitizer) *Recorder {
+	return &Recorder{Next: next, Cassette: &Cassette{}, Sanitizer: sanitizer}
+}
+
+// RoundTrip performs request and records it, authorization headers are never recorded
+func (recorder *Recorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if request.Body != nil {
+		var err error
+		requestBody, err = ioutil.ReadAll(request.Body)
+		_ = request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+	next := recorder.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	response, err := next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	sanitize := recorder.Sanitizer.Sanitize
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.Cassette.Interactions = append(recorder.Cassette.Interactions, Interaction{
+		Method:      request.Method,
+		URL:         sanitize(request.URL.RequestURI()),
+		RequestBody: sanitize(string(requestBody)),
+		Status:      response.StatusCode,
+		ContentType: response.Header.Get("Content-Type"),
+		Body:        sanitize(string(body)),
+	})
+	return response, nil
+}
+
+// Player is http.RoundTripper answering requests with recorded interactions.
+// Requests are matched by method and URL, each interaction is used once in recorded order.
+type Player struct {
+	Cassette *Cassette
+
+	mu   sync.Mutex
+	used []bool
+}
+
+// NewPlayer creates Player of given cassette
+func NewPlayer(cassette *Cassette) *Player {
+	return &Player{Cassette: cassette, used: make([]bool, len(cassette.Interactions))}
+}
+
+// RoundTrip returns first unused interaction matching the request
+func (player *Player) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		_ = request.Body.Close()
+	}
+	uri := request.URL.RequestURI()
+	player.mu.Lock()
+	defer player.mu.Unlock()
+	for i, interaction := range player.Cassette.Interactions {
+		if player.used[i] || interaction.Method != request.Method || interaction.URL != uri {
+			continue
+		}
+		player.used[i] = true
+		header := make(http.Header)
+		if interaction.ContentType != "" {
+			header.Set("Content-Type", interaction.ContentType)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+			StatusCode:    interaction.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Body)),
+			ContentLength: int64(len(interaction.Body)),
+			Request:       request,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette: no recorded interaction for %s %s", request.Method, uri)
+}
+
+// Unused returns interactions which were not replayed
+func (player *Player) Unused() []Interaction {
+	player.mu.Lock()
+	defer player.mu.Unlock()
+	var res []Interaction
+	for i, interaction := range player.Cassette.Interactions {
+		if !player.used[i] {
+			res = append(res, interaction)
+		}
+	}
+	return res
+}
+
+func readJSON(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+	return json.NewDecoder(f).Decode(v)
+}
+
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
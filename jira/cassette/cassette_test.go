@@ -0,0 +1,87 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitize(t *testing.T) {
+	a := assert.New(t)
+	sanitizer := Sanitizer{
+		BaseURL: "https://jira.corp.local/",
+		Secrets: map[string]string{"jdoe": "tester", "jdoe-secret": "********"},
+	}
+	a.Equal(`{"self":"https://jira.example.com/rest/api/2/user?username=tester","email":"user@example.com","password":"********"}`,
+		sanitizer.Sanitize(`{"self":"https://jira.corp.local/rest/api/2/user?username=jdoe","email":"John.Doe@corp.local.com","password":"jdoe-secret"}`))
+}
+
+func TestRecordReplay(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Equal("Basic dGVzdDp0ZXN0", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"self":"http://` + r.Host + r.URL.Path + `","body":` + string(body) + `}`))
+	}))
+	defer srv.Close()
+
+	recorder := NewRecorder(nil, Sanitizer{BaseURL: srv.URL})
+	client := &http.Client{Transport: recorder}
+	request, _ := http.NewRequest("POST", srv.URL+"/rest/api/2/issue?x=1", strings.NewReader(`"data"`))
+	request.SetBasicAuth("test", "test")
+	response, err := client.Do(request)
+	if a.NoError(err) {
+		body, _ := ioutil.ReadAll(response.Body)
+		a.Equal(`{"self":"`+srv.URL+`/rest/api/2/issue","body":"data"}`, string(body))
+	}
+
+	path := filepath.Join(t.TempDir(), "scenario", "cassette.json")
+	a.NoError(recorder.Cassette.Save(path))
+	cassette, err := Load(path)
+	a.NoError(err)
+	a.Equal([]Interaction{{
+		Method:      "POST",
+		URL:         "/rest/api/2/issue?x=1",
+		RequestBody: `"data"`,
+		Status:      200,
+		ContentType: "application/json",
+		Body:        `{"self":"https://jira.example.com/rest/api/2/issue","body":"data"}`,
+	}}, cassette.Interactions)
+
+	player := NewPlayer(cassette)
+	client = &http.Client{Transport: player}
+	_, err = client.Get(BaseURL + "/rest/api/2/issue?x=1")
+	a.Error(err, "method should match")
+	a.Len(player.Unused(), 1)
+	response, err = client.Post(BaseURL+"/rest/api/2/issue?x=1", "application/json", nil)
+	if a.NoError(err) {
+		body, _ := ioutil.ReadAll(response.Body)
+		a.Equal(`{"self":"https://jira.example.com/rest/api/2/issue","body":"data"}`, string(body))
+		a.Equal("application/json", response.Header.Get("Content-Type"))
+	}
+	a.Empty(player.Unused())
+	_, err = client.Post(BaseURL+"/rest/api/2/issue?x=1", "application/json", nil)
+	a.Error(err, "interaction should be used once")
+}
+
+func TestCatalog(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), CatalogFile)
+	catalog, err := LoadCatalog(path)
+	a.NoError(err)
+	a.Empty(catalog)
+
+	catalog = catalog.Put(Entry{Version: "Server 7", Dir: "server-7"})
+	catalog = catalog.Put(Entry{Version: "Cloud", Dir: "cloud"})
+	catalog = catalog.Put(Entry{Version: "Server 7.13", Dir: "server-7"})
+	a.NoError(catalog.Save(path))
+	catalog, err = LoadCatalog(path)
+	a.NoError(err)
+	a.Equal(Catalog{{Version: "Server 7.13", Dir: "server-7"}, {Version: "Cloud", Dir: "cloud"}}, catalog)
+}
@@ -2,29 +2,33 @@ package jira
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 	"regexp"
+	"strings"
 	"time"
 
-	"github.com/powerman/narada-go/narada"
 	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/redact"
 	"github.com/qarea/jirams/store"
 )
 
-var l = narada.NewLog("jira client: ")
+var l = redact.NewLog("jira client: ")
 
 const (
 	basePath            = "/rest/api/2/"
 	projectResource     = "project"
 	currentUserResource = "myself"
+	serverInfoResource  = "serverInfo"
 	searchResource      = "search?jql="
 	issueResource       = "issue"
 	jiraTimestampLayout = "2006-01-02T15:04:05.000-0700"
 	jiraDateLayout      = "2006/01/02"
+	// issuesChunkSize limits amount of IDs passed in a single JQL query to keep URL length reasonable
+	issuesChunkSize = 50
 )
 
 // Client implements TrackerClient interface for JIRA tracker
@@ -39,7 +43,7 @@ func NewClient(store store.UserKeyMapper) *Client {
 }
 
 // GetProjects fetches and returns a list of projects for current user
-func (client *Client) GetProjects(tracker entities.TrackerConfig, res *[]entities.Project) (err error) {
+func (client *Client) GetProjects(ctx context.Context, tracker entities.TrackerConfig, res *[]entities.Project) (err error) {
 	var (
 		projects []Project
 		baseURL  = tracker.URL + basePath
@@ -49,13 +53,13 @@ func (client *Client) GetProjects(tracker entities.TrackerConfig, res *[]entitie
 		return
 	}
 
-	request, _ := http.NewRequest("GET", baseURL+projectResource, nil)
+	request, _ := newRequest(ctx, "GET", baseURL+projectResource, nil)
 	if err = client.Jira.Request(tracker, request, &projects); err != nil {
 		return
 	}
 
 	for i, project := range projects {
-		request, _ := http.NewRequest("GET", baseURL+projectResource+"/"+project.ID, nil)
+		request, _ := newRequest(ctx, "GET", baseURL+projectResource+"/"+project.ID, nil)
 		err = client.Jira.Request(tracker, request, &project)
 		if err != nil {
 			continue
@@ -72,10 +76,10 @@ func (client *Client) GetProjects(tracker entities.TrackerConfig, res *[]entitie
 }
 
 // GetCurrentUser retrieves current user information from tracker
-func (client *Client) GetCurrentUser(tracker entities.TrackerConfig, res *entities.User) (err error) {
+func (client *Client) GetCurrentUser(ctx context.Context, tracker entities.TrackerConfig, res *entities.User) (err error) {
 	baseURL := tracker.URL + basePath
 	var user User
-	request, _ := http.NewRequest("GET", baseURL+currentUserResource, nil)
+	request, _ := newRequest(ctx, "GET", baseURL+currentUserResource, nil)
 	err = client.Jira.Request(tracker, request, &user)
 	if err != nil {
 		return
@@ -85,7 +89,7 @@ func (client *Client) GetCurrentUser(tracker entities.TrackerConfig, res *entiti
 }
 
 // GetProjectIssues retrieves list of issues from specified project assigned to current user
-func (client *Client) GetProjectIssues(tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
+func (client *Client) GetProjectIssues(ctx context.Context, tracker entities.TrackerConfig, projectID entities.ProjectID, userID entities.UserID, res *[]entities.Issue) error {
 	baseURL := tracker.URL + basePath
 
 	var (
@@ -97,7 +101,7 @@ func (client *Client) GetProjectIssues(tracker entities.TrackerConfig, projectID
 
 	for !finished {
 		limit := fmt.Sprintf("&startAt=%d", startAt)
-		request, err := http.NewRequest("GET", baseURL+searchResource+url.QueryEscape(query)+limit, nil)
+		request, err := newRequest(ctx, "GET", baseURL+searchResource+url.QueryEscape(query)+limit, nil)
 		if err != nil {
 			return err
 		}
@@ -119,9 +123,9 @@ func (client *Client) GetProjectIssues(tracker entities.TrackerConfig, projectID
 }
 
 // GetIssue retrieves issue information by issue ID
-func (client *Client) GetIssue(tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
+func (client *Client) GetIssue(ctx context.Context, tracker entities.TrackerConfig, issueID entities.IssueID, res *entities.Issue) error {
 	baseURL := tracker.URL + basePath
-	request, _ := http.NewRequest("GET", baseURL+issueResource+"/"+fmt.Sprintf("%d", issueID), nil)
+	request, _ := newRequest(ctx, "GET", baseURL+issueResource+"/"+fmt.Sprintf("%d", issueID), nil)
 	var issue Issue
 	err := client.Jira.Request(tracker, request, &issue)
 	if err != nil {
@@ -134,17 +138,76 @@ func (client *Client) GetIssue(tracker entities.TrackerConfig, issueID entities.
 	return nil
 }
 
+// GetIssues retrieves issues by list of IDs using JQL search, issues not found in tracker are returned in notFound
+func (client *Client) GetIssues(ctx context.Context, tracker entities.TrackerConfig, issueIDs []entities.IssueID, res *[]entities.Issue, notFound *[]entities.IssueID) error {
+	baseURL := tracker.URL + basePath
+
+	var (
+		ids   []entities.IssueID
+		seen  = make(map[entities.IssueID]bool, len(issueIDs))
+		found = make(map[entities.IssueID]entities.Issue, len(issueIDs))
+	)
+	for _, id := range issueIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for start := 0; start < len(ids); start += issuesChunkSize {
+		end := start + issuesChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunkIDs := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			chunkIDs = append(chunkIDs, fmt.Sprintf("%d", id))
+		}
+		// validateQuery=warn makes JIRA skip unknown IDs instead of failing the whole query
+		query := fmt.Sprintf("id in (%s)", strings.Join(chunkIDs, ","))
+		url := baseURL + searchResource + url.QueryEscape(query) + "&validateQuery=warn"
+		var issues Issues
+		err := client.Jira.IterateRequest(ctx, tracker, url, &issues, func(data interface{}) (loaded int, total int, err error) {
+			if data, ok := data.(*Issues); ok {
+				loaded = len(data.Issues)
+				total = data.Total
+				for _, issue := range data.Issues {
+					issue := issue.toIssue()
+					found[issue.ID] = issue
+				}
+			} else {
+				err = errors.New("Expected data to be of type *Issues")
+			}
+			return
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	*res = make([]entities.Issue, 0, len(found))
+	*notFound = make([]entities.IssueID, 0)
+	for _, id := range ids {
+		if issue, ok := found[id]; ok {
+			*res = append(*res, issue)
+		} else {
+			*notFound = append(*notFound, id)
+		}
+	}
+	return nil
+}
+
 var re = regexp.MustCompile("(issues|browse)\\/([0-9A-Z-]+)")
 
 // GetIssueByURL attempts to parse provided URL and retrieve corresponding issue
-func (client *Client) GetIssueByURL(tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error {
+func (client *Client) GetIssueByURL(ctx context.Context, tracker entities.TrackerConfig, issueURL string, res *entities.Issue, res2 *entities.ProjectID) error {
 	matches := re.FindStringSubmatch(issueURL)
 	if matches == nil {
 		return errors.New("Failed to parse Issue URL")
 	}
 
 	baseURL := tracker.URL + basePath
-	request, _ := http.NewRequest("GET", baseURL+issueResource+"/"+url.QueryEscape(matches[2]), nil)
+	request, _ := newRequest(ctx, "GET", baseURL+issueResource+"/"+url.QueryEscape(matches[2]), nil)
 	var issue Issue
 	err := client.Jira.Request(tracker, request, &issue)
 	if err != nil {
@@ -160,7 +223,7 @@ func (client *Client) GetIssueByURL(tracker entities.TrackerConfig, issueURL str
 }
 
 // CreateIssue creates new issue with provided parameters
-func (client *Client) CreateIssue(tracker entities.TrackerConfig, newIssue entities.NewIssue, res *entities.Issue) error {
+func (client *Client) CreateIssue(ctx context.Context, tracker entities.TrackerConfig, newIssue entities.NewIssue, res *entities.Issue) error {
 	baseURL := tracker.URL + basePath
 	userKey, err := client.Store.GetKey(tracker.ID, newIssue.Assignee)
 	if err != nil || userKey == "" {
@@ -177,7 +240,7 @@ func (client *Client) CreateIssue(tracker entities.TrackerConfig, newIssue entit
 				OriginalEstimate:  estimateHours,
 				RemainingEstimate: estimateHours}}}
 	payloadBytes, _ := json.Marshal(payload)
-	request, _ := http.NewRequest("POST", baseURL+issueResource, bytes.NewBuffer(payloadBytes))
+	request, _ := newRequest(ctx, "POST", baseURL+issueResource, bytes.NewBuffer(payloadBytes))
 	request.Header.Set("Content-Type", "application/json")
 	var newIssueID EntityID
 	err = client.Jira.Request(tracker, request, &newIssueID)
@@ -186,11 +249,11 @@ func (client *Client) CreateIssue(tracker entities.TrackerConfig, newIssue entit
 	}
 	issueID := newIssueID.toIssueID()
 
-	return client.GetIssue(tracker, issueID, res)
+	return client.GetIssue(ctx, tracker, issueID, res)
 }
 
 // CreateReport creates a work time report for specified issue
-func (client *Client) CreateReport(tracker entities.TrackerConfig, report entities.Report) error {
+func (client *Client) CreateReport(ctx context.Context, tracker entities.TrackerConfig, report entities.Report) error {
 	baseURL := tracker.URL + basePath
 	started := time.Unix(int64(report.Started), 0).Format(jiraTimestampLayout)
 	payload := Worklog{
@@ -198,14 +261,14 @@ func (client *Client) CreateReport(tracker entities.TrackerConfig, report entiti
 		Spent:   uint64(report.Duration),
 		Comment: report.Comments}
 	payloadBytes, _ := json.Marshal(payload)
-	request, _ := http.NewRequest("POST", baseURL+issueResource+"/"+fmt.Sprintf("%d", report.IssueID)+"/worklog", bytes.NewBuffer(payloadBytes))
+	request, _ := newRequest(ctx, "POST", baseURL+issueResource+"/"+fmt.Sprintf("%d", report.IssueID)+"/worklog", bytes.NewBuffer(payloadBytes))
 	request.Header.Set("Content-Type", "application/json")
 
 	return client.Jira.Request(tracker, request, nil)
 }
 
 // GetTotalReports returns total time worked on specified date
-func (client *Client) GetTotalReports(tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error {
+func (client *Client) GetTotalReports(ctx context.Context, tracker entities.TrackerConfig, date entities.Timestamp, res *entities.ReportsTotal) error {
 	baseURL := tracker.URL + basePath
 	jiraDate := time.Unix(int64(date), 0).Format(jiraDateLayout)
 	query := fmt.Sprintf("worklogAuthor=currentUser() AND worklogDate=\"%s\"", jiraDate)
@@ -215,7 +278,7 @@ func (client *Client) GetTotalReports(tracker entities.TrackerConfig, date entit
 		issues   IssueIDPage
 		issueIDs []entities.IssueID
 	)
-	err := client.Jira.IterateRequest(tracker, url, &issues, func(data interface{}) (loaded int, total int, err error) {
+	err := client.Jira.IterateRequest(ctx, tracker, url, &issues, func(data interface{}) (loaded int, total int, err error) {
 		if data, ok := data.(*IssueIDPage); ok {
 			loaded = len(data.IssueIDs)
 			total = data.Total
@@ -238,7 +301,7 @@ func (client *Client) GetTotalReports(tracker entities.TrackerConfig, date entit
 	var worklogs WorklogPage
 	for _, id := range issueIDs {
 		url := baseURL + issueResource + "/" + fmt.Sprintf("%d", id) + "/worklog"
-		err := client.Jira.IterateRequest(tracker, url, &worklogs, func(data interface{}) (loaded int, total int, err error) {
+		err := client.Jira.IterateRequest(ctx, tracker, url, &worklogs, func(data interface{}) (loaded int, total int, err error) {
 			if data, ok := data.(*WorklogPage); ok {
 				loaded = len(data.Worklogs)
 				total = data.Total
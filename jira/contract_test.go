@@ -0,0 +1,277 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/jira/cassette"
+	"github.com/qarea/jirams/jira/jiratest"
+	"github.com/stretchr/testify/assert"
+)
+
+// Contract tests replay cassettes listed in catalog.
+// Only cassettes recorded against jiratest fake are committed for now, so they guard the client
+// against regressions but don't prove compatibility with any real JIRA Server, Data Center or Cloud version.
+// To record cassettes of real JIRA version run:
+//
+//	JIRA_RECORD_VERSION="Server 8.20" JIRA_RECORD_DEPLOYMENT=Server \
+//	JIRA_RECORD_URL=https://jira.local JIRA_RECORD_LOGIN=... JIRA_RECORD_PASSWORD=... \
+//	JIRA_RECORD_PROJECT=10000 JIRA_RECORD_ISSUE=10001 JIRA_RECORD_ISSUE_KEY=DEMO-1 \
+//	JIRA_RECORD_ISSUE_TYPE=10002 JIRA_RECORD_DATE=2016-12-22 go test ./jira -run TestContract
+//
+// JIRA_RECORD_ACCOUNT and JIRA_RECORD_DISPLAY_NAME are scrubbed from cassettes when set.
+// Issue should be assigned to the user, CreateReport scenario adds worklog to it
+// and CreateIssue scenario creates issue of given type in the project.
+// JIRA_RECORD_VERSION=jiratest without JIRA_RECORD_URL records against in-memory fake.
+const cassettesDir = "testdata/cassettes"
+
+var contractDirRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// contractDeployments are JIRA deployment types cassettes should be recorded against
+var contractDeployments = []string{"Server", "Data Center", "Cloud"}
+
+type contractParams struct {
+	ProjectID entities.ProjectID
+	IssueID   entities.IssueID
+	IssueKey  string
+	IssueType entities.EntityID `json:",omitempty"`
+	// Date is a day to report to, in UTC
+	Date entities.Timestamp
+}
+
+type contractResult struct {
+	Result interface{}
+	Error  string `json:",omitempty"`
+}
+
+type contractScenario struct {
+	name string
+	run  func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error)
+}
+
+// contractScenarios are recorded in this order, so reports are created before they are counted
+// and created issue doesn't change results of other scenarios
+var contractScenarios = []contractScenario{
+	{"GetCurrentUser", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res entities.User
+		err := client.GetCurrentUser(ctx, tracker, &res)
+		return res, err
+	}},
+	{"GetProjects", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res []entities.Project
+		err := client.GetProjects(ctx, tracker, &res)
+		return res, err
+	}},
+	{"GetProjectIssues", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res []entities.Issue
+		err := client.GetProjectIssues(ctx, tracker, params.ProjectID, 1, &res)
+		return res, err
+	}},
+	{"GetIssue", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res entities.Issue
+		err := client.GetIssue(ctx, tracker, params.IssueID, &res)
+		return res, err
+	}},
+	{"GetIssueNotFound", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res entities.Issue
+		err := client.GetIssue(ctx, tracker, 1, &res)
+		return res, err
+	}},
+	{"GetIssues", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res []entities.Issue
+		var notFound []entities.IssueID
+		err := client.GetIssues(ctx, tracker, []entities.IssueID{params.IssueID, 1}, &res, &notFound)
+		return map[string]interface{}{"Issues": res, "NotFound": notFound}, err
+	}},
+	{"GetIssueByURL", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res entities.Issue
+		var projectID entities.ProjectID
+		err := client.GetIssueByURL(ctx, tracker, tracker.URL+"/browse/"+params.IssueKey, &res, &projectID)
+		return map[string]interface{}{"Issue": res, "ProjectID": projectID}, err
+	}},
+	{"CreateReport", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		report := entities.Report{IssueID: params.IssueID, Started: params.Date + 10*3600, Duration: 60, Comments: "contract test"}
+		return nil, client.CreateReport(ctx, tracker, report)
+	}},
+	{"GetTotalReports", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res entities.ReportsTotal
+		err := client.GetTotalReports(ctx, tracker, params.Date, &res)
+		return res, err
+	}},
+	{"CreateIssue", func(ctx context.Context, client *Client, tracker entities.TrackerConfig, params contractParams) (interface{}, error) {
+		var res entities.Issue
+		newIssue := entities.NewIssue{ProjectID: params.ProjectID, Assignee: 1, Type: params.IssueType, Title: "contract test", Estimate: 3600}
+		err := client.CreateIssue(ctx, tracker, newIssue, &res)
+		return res, err
+	}},
+}
+
+func TestContract(t *testing.T) {
+	// dates in requests are formatted in local time zone
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	if version := os.Getenv("JIRA_RECORD_VERSION"); version != "" {
+		recordContract(t, version)
+	}
+
+	catalog, err := cassette.LoadCatalog(filepath.Join(cassettesDir, cassette.CatalogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) == 0 {
+		t.Fatal("cassettes catalog is empty")
+	}
+	recorded := make(map[string]bool)
+	for _, entry := range catalog {
+		recorded[entry.Deployment] = true
+	}
+	for _, deployment := range contractDeployments {
+		if !recorded[deployment] {
+			t.Logf("No cassettes recorded against JIRA %s", deployment)
+		}
+	}
+	for _, entry := range catalog {
+		entry := entry
+		t.Run(entry.Dir, func(t *testing.T) {
+			var params contractParams
+			if err := json.Unmarshal(entry.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			for _, scenario := range contractScenarios {
+				replayContract(t, entry, scenario, params)
+			}
+		})
+	}
+}
+
+func replayContract(t *testing.T, entry cassette.Entry, scenario contractScenario, params contractParams) {
+	a := assert.New(t)
+	path := filepath.Join(cassettesDir, entry.Dir, scenario.name+".json")
+	recorded, err := cassette.Load(path)
+	if os.IsNotExist(err) {
+		t.Logf("%s: %s is not recorded", entry.Version, scenario.name)
+		return
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	player := cassette.NewPlayer(recorded)
+	client := &Client{Store: fakeStore{}, Jira: &Requester{Transport: player}}
+	tracker := entities.TrackerConfig{
+		ID:          1,
+		URL:         cassette.BaseURL,
+		Credentials: entities.TrackerCredentials{Login: "tester", Password: "********"},
+	}
+
+	res, err := scenario.run(context.Background(), client, tracker, params)
+	actual, _ := json.Marshal(newContractResult(res, err))
+	a.JSONEq(string(recorded.Result), string(actual), "%s: %s", entry.Version, scenario.name)
+	a.Empty(player.Unused(), "%s: %s", entry.Version, scenario.name)
+}
+
+func recordContract(t *testing.T, version string) {
+	entry := cassette.Entry{
+		Version:    version,
+		Deployment: os.Getenv("JIRA_RECORD_DEPLOYMENT"),
+		Dir:        strings.Trim(contractDirRegexp.ReplaceAllString(strings.ToLower(version), "-"), "-"),
+	}
+	tracker := entities.TrackerConfig{
+		ID:  1,
+		URL: strings.TrimSuffix(os.Getenv("JIRA_RECORD_URL"), "/"),
+		Credentials: entities.TrackerCredentials{
+			Login:    os.Getenv("JIRA_RECORD_LOGIN"),
+			Password: os.Getenv("JIRA_RECORD_PASSWORD"),
+		},
+	}
+	sanitizer := cassette.Sanitizer{
+		BaseURL: tracker.URL,
+		Secrets: map[string]string{
+			tracker.Credentials.Login:    "tester",
+			tracker.Credentials.Password: "********",
+			// Cloud identifies users by account ID, user name is personal data as well
+			os.Getenv("JIRA_RECORD_ACCOUNT"):      "tester",
+			os.Getenv("JIRA_RECORD_DISPLAY_NAME"): "Test User",
+		},
+	}
+	var params contractParams
+	if tracker.URL == "" {
+		entry.Deployment = "Fake"
+		params = recordFakeParams(t, &tracker)
+		sanitizer.BaseURL = tracker.URL
+		sanitizer.Secrets = nil
+	} else {
+		projectID, _ := strconv.ParseUint(os.Getenv("JIRA_RECORD_PROJECT"), 10, 64)
+		issueID, _ := strconv.ParseUint(os.Getenv("JIRA_RECORD_ISSUE"), 10, 64)
+		issueType, _ := strconv.ParseUint(os.Getenv("JIRA_RECORD_ISSUE_TYPE"), 10, 64)
+		date, err := time.Parse("2006-01-02", os.Getenv("JIRA_RECORD_DATE"))
+		if err != nil {
+			t.Fatal("JIRA_RECORD_DATE:", err)
+		}
+		params = contractParams{
+			ProjectID: entities.ProjectID(projectID),
+			IssueID:   entities.IssueID(issueID),
+			IssueKey:  os.Getenv("JIRA_RECORD_ISSUE_KEY"),
+			IssueType: entities.EntityID(issueType),
+			Date:      entities.Timestamp(date.Unix()),
+		}
+	}
+	entry.Params, _ = json.Marshal(params)
+
+	for _, scenario := range contractScenarios {
+		recorder := cassette.NewRecorder(nil, sanitizer)
+		client := &Client{Store: fakeStore{}, Jira: &Requester{Transport: recorder}}
+		res, err := scenario.run(context.Background(), client, tracker, params)
+		data, _ := json.Marshal(newContractResult(res, err))
+		recorder.Cassette.Result = json.RawMessage(sanitizer.Sanitize(string(data)))
+		if err := recorder.Cassette.Save(filepath.Join(cassettesDir, entry.Dir, scenario.name+".json")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	catalogPath := filepath.Join(cassettesDir, cassette.CatalogFile)
+	catalog, err := cassette.LoadCatalog(catalogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Put(entry).Save(catalogPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// recordFakeParams starts seeded jiratest fake and points tracker to it
+func recordFakeParams(t *testing.T, tracker *entities.TrackerConfig) contractParams {
+	fake := jiratest.NewFake()
+	user := fake.Seed()
+	srv := jiratest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	tracker.URL = srv.URL
+	tracker.Credentials = entities.TrackerCredentials{Login: user.Login, Password: user.Password}
+
+	issue, _ := fake.Issue("DEMO-1")
+	issueID, _ := strconv.ParseUint(issue.ID, 10, 64)
+	projectID, _ := strconv.ParseUint(issue.ProjectID, 10, 64)
+	return contractParams{
+		ProjectID: entities.ProjectID(projectID),
+		IssueID:   entities.IssueID(issueID),
+		IssueKey:  issue.Key,
+		IssueType: 3,
+		Date:      entities.Timestamp(time.Date(2016, 12, 22, 0, 0, 0, 0, time.UTC).Unix()),
+	}
+}
+
+func newContractResult(res interface{}, err error) contractResult {
+	result := contractResult{Result: res}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
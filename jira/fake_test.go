@@ -0,0 +1,136 @@
+package jira
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/jira/jiratest"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct{}
+
+func (fakeStore) Init() {}
+func (fakeStore) GetID(trackerID entities.TrackerID, key entities.UserKey) (entities.UserID, error) {
+	return 1, nil
+}
+func (fakeStore) GetKey(trackerID entities.TrackerID, userID entities.UserID) (string, error) {
+	return "tester", nil
+}
+
+func newFakeJira(t *testing.T) (*jiratest.Fake, *Client, entities.TrackerConfig) {
+	fake := jiratest.NewFake()
+	user := fake.Seed()
+	srv := jiratest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	tracker := entities.TrackerConfig{
+		ID:          1,
+		URL:         srv.URL,
+		Credentials: entities.TrackerCredentials{Login: user.Login, Password: user.Password},
+	}
+	return fake, &Client{Store: fakeStore{}, Jira: &Requester{}}, tracker
+}
+
+func TestFakeProjects(t *testing.T) {
+	a := assert.New(t)
+	_, client, tracker := newFakeJira(t)
+	ctx := context.Background()
+
+	var projects []entities.Project
+	a.NoError(client.GetProjects(ctx, tracker, &projects))
+	if a.Len(projects, 2) {
+		a.Equal("Demo", projects[0].Title)
+		a.Equal([]entities.NamedID{{ID: 1, Name: "Bug"}, {ID: 3, Name: "Task"}}, projects[0].IssueTypes)
+	}
+
+	var user entities.User
+	a.NoError(client.GetCurrentUser(ctx, tracker, &user))
+	a.Equal(entities.User{ID: 1, Name: "Test User", Mail: "tester@example.com"}, user)
+
+	tracker.Credentials.Password = "wrong"
+	a.Equal(entities.ErrInvalidCredentials, client.GetCurrentUser(ctx, tracker, &user))
+}
+
+func TestFakeIssues(t *testing.T) {
+	a := assert.New(t)
+	fake, client, tracker := newFakeJira(t)
+	fake.PageSize = 2
+	ctx := context.Background()
+	var projects []entities.Project
+	a.NoError(client.GetProjects(ctx, tracker, &projects))
+
+	// paging over assigned issues
+	var issues []entities.Issue
+	a.NoError(client.GetProjectIssues(ctx, tracker, projects[0].ID, 1, &issues))
+	if a.Len(issues, 3) {
+		a.Equal("Demo task 3", issues[2].Title)
+		a.Contains(issues[0].URL, "/browse/DEMO-1")
+	}
+
+	var found, notFound []entities.IssueID
+	var byID []entities.Issue
+	a.NoError(client.GetIssues(ctx, tracker, []entities.IssueID{issues[1].ID, 1, issues[0].ID}, &byID, &notFound))
+	for _, issue := range byID {
+		found = append(found, issue.ID)
+	}
+	a.Equal([]entities.IssueID{issues[1].ID, issues[0].ID}, found)
+	a.Equal([]entities.IssueID{1}, notFound)
+
+	var issue entities.Issue
+	a.Equal(entities.ErrIssueNotFound, client.GetIssue(ctx, tracker, 1, &issue))
+
+	var projectID entities.ProjectID
+	a.NoError(client.GetIssueByURL(ctx, tracker, tracker.URL+"/browse/DEMO-2", &issue, &projectID))
+	a.Equal(issues[1], issue)
+	a.Equal(projects[0].ID, projectID)
+
+	a.NoError(client.CreateIssue(ctx, tracker, entities.NewIssue{ProjectID: projects[0].ID, Type: 3, Title: "New", Estimate: 7200}, &issue))
+	a.Equal("New", issue.Title)
+	a.Equal(entities.Duration(7200), issue.Estimate)
+}
+
+func TestFakeReports(t *testing.T) {
+	a := assert.New(t)
+	fake, client, tracker := newFakeJira(t)
+	ctx := context.Background()
+	issue, _ := fake.Issue("DEMO-1")
+	var id entities.IssueID
+	n, _ := strconv.ParseUint(issue.ID, 10, 64)
+	id = entities.IssueID(n)
+
+	day := time.Date(2016, 12, 22, 0, 0, 0, 0, time.UTC)
+	for _, duration := range []entities.Duration{1800, 3600} {
+		a.NoError(client.CreateReport(ctx, tracker, entities.Report{IssueID: id, Started: entities.Timestamp(day.Add(10 * time.Hour).Unix()), Duration: duration}))
+	}
+	a.NoError(client.CreateReport(ctx, tracker, entities.Report{IssueID: id, Started: entities.Timestamp(day.Add(34 * time.Hour).Unix()), Duration: 60}))
+
+	var total entities.ReportsTotal
+	a.NoError(client.GetTotalReports(ctx, tracker, entities.Timestamp(day.Unix()), &total))
+	a.Equal(entities.ReportsTotal(5400), total)
+}
+
+func TestFakeFailures(t *testing.T) {
+	a := assert.New(t)
+	fake, client, tracker := newFakeJira(t)
+	ctx := context.Background()
+	var user entities.User
+
+	fake.Fail(jiratest.Failure{Path: "/rest/api/2/myself", Status: http.StatusServiceUnavailable, Times: 1})
+	a.Equal(entities.ErrServerUnavailable, client.GetCurrentUser(ctx, tracker, &user))
+	a.NoError(client.GetCurrentUser(ctx, tracker, &user))
+
+	fake.Fail(jiratest.Failure{Method: "GET", Status: http.StatusBadGateway, Times: 1})
+	a.Equal(entities.ErrServerFailed, client.GetCurrentUser(ctx, tracker, &user))
+	a.NoError(client.GetCurrentUser(ctx, tracker, &user))
+
+	fake.Fail(jiratest.Failure{Path: "/rest/api/2/myself"})
+	err := client.GetCurrentUser(ctx, tracker, &user)
+	a.Error(err)
+	// connection is dropped after request was sent, so it may be processed
+	a.False(entities.IsUnavailable(err))
+	a.True(entities.IsFailure(err))
+}
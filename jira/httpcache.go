@@ -0,0 +1,93 @@
+package jira
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"github.com/qarea/jirams/entities"
+)
+
+// HTTPCache keeps validators and bodies of JIRA responses to make conditional requests.
+// Cache size is bounded by total size of stored bodies, least recently used entries are evicted first.
+type HTTPCache struct {
+	MaxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type httpCacheEntry struct {
+	key          string
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// NewHTTPCache creates an instance of HTTPCache limited to maxSize bytes of response bodies
+func NewHTTPCache(maxSize int64) *HTTPCache {
+	return &HTTPCache{
+		MaxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Len returns amount of cached responses
+func (cache *HTTPCache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.lru.Len()
+}
+
+// Size returns total size of cached response bodies
+func (cache *HTTPCache) Size() int64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.size
+}
+
+func (cache *HTTPCache) get(key string) (httpCacheEntry, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	el, ok := cache.entries[key]
+	if !ok {
+		return httpCacheEntry{}, false
+	}
+	cache.lru.MoveToFront(el)
+	return *el.Value.(*httpCacheEntry), true
+}
+
+func (cache *HTTPCache) put(entry httpCacheEntry) {
+	size := int64(len(entry.body))
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if el, ok := cache.entries[entry.key]; ok {
+		cache.remove(el)
+	}
+	if size > cache.MaxSize {
+		return
+	}
+	cache.entries[entry.key] = cache.lru.PushFront(&entry)
+	cache.size += size
+	for cache.size > cache.MaxSize {
+		cache.remove(cache.lru.Back())
+	}
+}
+
+func (cache *HTTPCache) remove(el *list.Element) {
+	entry := cache.lru.Remove(el).(*httpCacheEntry)
+	delete(cache.entries, entry.key)
+	cache.size -= int64(len(entry.body))
+}
+
+// httpCacheKey identifies response by request URL and credentials used to retrieve it
+func httpCacheKey(tracker entities.TrackerConfig, request *http.Request) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(tracker.Credentials.Login + "\x00" + tracker.Credentials.Password))
+	return request.URL.String() + "\x00" + hex.EncodeToString(h.Sum(nil))
+}
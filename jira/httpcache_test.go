@@ -0,0 +1,93 @@
+package jira
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPCacheEviction(t *testing.T) {
+	a := assert.New(t)
+	cache := NewHTTPCache(10)
+
+	cache.put(httpCacheEntry{key: "a", etag: "1", body: []byte("12345")})
+	cache.put(httpCacheEntry{key: "b", etag: "2", body: []byte("12345")})
+	a.Equal(2, cache.Len())
+
+	// touch "a" so "b" becomes least recently used
+	_, ok := cache.get("a")
+	a.True(ok)
+	cache.put(httpCacheEntry{key: "c", etag: "3", body: []byte("1")})
+	a.Equal(2, cache.Len())
+	a.Equal(int64(6), cache.Size())
+	_, ok = cache.get("b")
+	a.False(ok)
+
+	// replacing entry updates size
+	cache.put(httpCacheEntry{key: "a", etag: "4", body: []byte("12")})
+	a.Equal(int64(3), cache.Size())
+	entry, ok := cache.get("a")
+	a.True(ok)
+	a.Equal("4", entry.etag)
+
+	// entries larger than cache are not stored
+	cache.put(httpCacheEntry{key: "d", etag: "5", body: make([]byte, 11)})
+	_, ok = cache.get("d")
+	a.False(ok)
+}
+
+func TestRequestConditional(t *testing.T) {
+	a := assert.New(t)
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		res.Header().Set("ETag", `"v1"`)
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte(`{"Foo":"bar"}`))
+	}))
+	defer srv.Close()
+
+	requester := Requester{Cache: NewHTTPCache(1024)}
+	for i := 0; i < 3; i++ {
+		var result TestEntity
+		request, _ := http.NewRequest("GET", srv.URL, nil)
+		a.NoError(requester.Request(testTrackerConfig, request, &result))
+		a.Equal(TestEntity{Foo: "bar"}, result)
+	}
+	a.Equal(1, full)
+	a.Equal(2, notModified)
+
+	// other credentials do not share cached responses
+	other := testTrackerConfig
+	other.Credentials.Login = "other"
+	var result TestEntity
+	request, _ := http.NewRequest("GET", srv.URL, nil)
+	a.NoError(requester.Request(other, request, &result))
+	a.Equal(2, full)
+}
+
+func TestHTTPCacheConcurrent(t *testing.T) {
+	cache := NewHTTPCache(100)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := string(rune('a' + i))
+			for j := 0; j < 100; j++ {
+				cache.put(httpCacheEntry{key: key, body: make([]byte, j%20)})
+				_, _ = cache.get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.True(t, cache.Size() <= 100)
+}
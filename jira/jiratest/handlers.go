@@ -0,0 +1,440 @@
+package jiratest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiPath = "/rest/api/2/"
+
+type jsonNamedID struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+type jsonUser struct {
+	Key          string `json:"key"`
+	Name         string `json:"name"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+type jsonProject struct {
+	ID          string        `json:"id"`
+	Key         string        `json:"key"`
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	IssueTypes  []jsonNamedID `json:"issueTypes,omitempty"`
+}
+
+type jsonProgress struct {
+	Progress int64 `json:"progress"`
+	Total    int64 `json:"total"`
+	Percent  int64 `json:"percent,omitempty"`
+}
+
+type jsonIssueFields struct {
+	Summary     string       `json:"summary"`
+	Description string       `json:"description,omitempty"`
+	IssueType   jsonNamedID  `json:"issuetype"`
+	Project     jsonNamedID  `json:"project"`
+	Assignee    *jsonUser    `json:"assignee"`
+	Status      jsonNamedID  `json:"status"`
+	Resolution  *jsonNamedID `json:"resolution"`
+	Estimate    int64        `json:"timeoriginalestimate,omitempty"`
+	Spent       int64        `json:"timespent,omitempty"`
+	DueDate     string       `json:"duedate,omitempty"`
+	Progress    jsonProgress `json:"progress"`
+}
+
+type jsonIssue struct {
+	ID     string           `json:"id"`
+	Key    string           `json:"key"`
+	Self   string           `json:"self"`
+	Fields *jsonIssueFields `json:"fields,omitempty"`
+}
+
+type jsonWorklog struct {
+	ID               string    `json:"id,omitempty"`
+	IssueID          string    `json:"issueId,omitempty"`
+	Author           *jsonUser `json:"author,omitempty"`
+	Started          string    `json:"started"`
+	TimeSpentSeconds int64     `json:"timeSpentSeconds"`
+	Comment          string    `json:"comment,omitempty"`
+}
+
+type jsonComment struct {
+	ID      string    `json:"id,omitempty"`
+	Author  *jsonUser `json:"author,omitempty"`
+	Body    string    `json:"body"`
+	Created string    `json:"created,omitempty"`
+}
+
+type jsonTransition struct {
+	ID   string      `json:"id"`
+	Name string      `json:"name"`
+	To   jsonNamedID `json:"to"`
+}
+
+type jsonNewIssue struct {
+	Fields struct {
+		Summary      string      `json:"summary"`
+		Description  string      `json:"description"`
+		Project      jsonNamedID `json:"project"`
+		IssueType    jsonNamedID `json:"issuetype"`
+		Assignee     *jsonUser   `json:"assignee"`
+		DueDate      string      `json:"duedate"`
+		TimeTracking struct {
+			OriginalEstimate float64 `json:"originalEstimate"`
+		} `json:"timetracking"`
+	} `json:"fields"`
+}
+
+type jsonErrors struct {
+	ErrorMessages []string          `json:"errorMessages"`
+	Errors        map[string]string `json:"errors"`
+}
+
+// ServeHTTP serves JIRA REST API request
+func (fake *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	fake.requests++
+	failure := fake.failure(r)
+	fake.mu.Unlock()
+	if failure != nil {
+		fail(w, *failure)
+		return
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if !strings.HasPrefix(r.URL.Path, apiPath) {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPath), "/"), "/")
+	if path[0] == "serverInfo" {
+		writeJSON(w, http.StatusOK, map[string]string{"baseUrl": baseURL(r), "version": "7.0.0-fake"})
+		return
+	}
+	login, password, _ := r.BasicAuth()
+	user := fake.user(login, password)
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="protected-area"`)
+		writeError(w, http.StatusUnauthorized, "You are not authenticated")
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && len(path) == 1 && path[0] == "myself":
+		writeJSON(w, http.StatusOK, toJSONUser(user))
+	case r.Method == "GET" && len(path) == 1 && path[0] == "project":
+		projects := make([]jsonProject, len(fake.projects))
+		for i, project := range fake.projects {
+			projects[i] = jsonProject{ID: project.ID, Key: project.Key, Name: project.Name}
+		}
+		writeJSON(w, http.StatusOK, projects)
+	case r.Method == "GET" && len(path) == 2 && path[0] == "project":
+		fake.getProject(w, path[1])
+	case r.Method == "GET" && len(path) == 1 && path[0] == "search":
+		fake.search(w, r, user)
+	case r.Method == "POST" && len(path) == 1 && path[0] == "issue":
+		fake.createIssue(w, r)
+	case len(path) >= 2 && path[0] == "issue":
+		issue := fake.issue(path[1])
+		if issue == nil {
+			writeError(w, http.StatusNotFound, "Issue Does Not Exist")
+			return
+		}
+		fake.serveIssue(w, r, user, issue, path[2:])
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (fake *Fake) serveIssue(w http.ResponseWriter, r *http.Request, user *User, issue *Issue, path []string) {
+	resource := strings.Join(path, "/")
+	switch {
+	case r.Method == "GET" && resource == "":
+		writeJSON(w, http.StatusOK, fake.toJSONIssue(r, issue))
+	case r.Method == "DELETE" && resource == "":
+		fake.deleteIssue(issue.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && resource == "worklog":
+		startAt, maxResults := fake.page(r)
+		worklogs := make([]jsonWorklog, 0)
+		for i := startAt; i < len(issue.Worklogs) && len(worklogs) < maxResults; i++ {
+			worklogs = append(worklogs, fake.toJSONWorklog(issue, issue.Worklogs[i]))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"startAt": startAt, "maxResults": maxResults, "total": len(issue.Worklogs), "worklogs": worklogs,
+		})
+	case r.Method == "POST" && resource == "worklog":
+		var req jsonWorklog
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := time.Parse(TimestampLayout, req.Started); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid started date")
+			return
+		}
+		if req.TimeSpentSeconds <= 0 {
+			writeError(w, http.StatusBadRequest, "Time spent must be positive")
+			return
+		}
+		worklog := Worklog{ID: fake.newID(), Author: user.Key, Started: req.Started, TimeSpentSeconds: req.TimeSpentSeconds, Comment: req.Comment}
+		issue.Worklogs = append(issue.Worklogs, worklog)
+		writeJSON(w, http.StatusCreated, fake.toJSONWorklog(issue, worklog))
+	case r.Method == "GET" && resource == "comment":
+		comments := make([]jsonComment, len(issue.Comments))
+		for i, comment := range issue.Comments {
+			comments[i] = fake.toJSONComment(comment)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"startAt": 0, "maxResults": len(comments), "total": len(comments), "comments": comments,
+		})
+	case r.Method == "POST" && resource == "comment":
+		var req jsonComment
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Body == "" {
+			writeError(w, http.StatusBadRequest, "Comment body can not be empty")
+			return
+		}
+		comment := Comment{ID: fake.newID(), Author: user.Key, Body: req.Body, Created: time.Now().Format(TimestampLayout)}
+		issue.Comments = append(issue.Comments, comment)
+		writeJSON(w, http.StatusCreated, fake.toJSONComment(comment))
+	case r.Method == "GET" && resource == "transitions":
+		transitions := make([]jsonTransition, len(fake.Transitions))
+		for i, t := range fake.Transitions {
+			transitions[i] = jsonTransition{ID: t.ID, Name: t.Name, To: jsonNamedID{ID: t.ID, Name: t.To}}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"transitions": transitions})
+	case r.Method == "POST" && resource == "transitions":
+		var req struct {
+			Transition jsonNamedID `json:"transition"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, t := range fake.Transitions {
+			if t.ID == req.Transition.ID {
+				issue.Status = t.To
+				issue.Resolved = t.Resolves
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		writeError(w, http.StatusBadRequest, "Transition id '"+req.Transition.ID+"' is not valid for this issue")
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (fake *Fake) getProject(w http.ResponseWriter, idOrKey string) {
+	project := fake.project(idOrKey)
+	if project == nil {
+		writeError(w, http.StatusNotFound, "No project could be found with id '"+idOrKey+"'.")
+		return
+	}
+	res := jsonProject{ID: project.ID, Key: project.Key, Name: project.Name, Description: project.Description}
+	for _, t := range project.IssueTypes {
+		res.IssueTypes = append(res.IssueTypes, jsonNamedID{ID: t.ID, Name: t.Name})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (fake *Fake) search(w http.ResponseWriter, r *http.Request, user *User) {
+	query, err := parseJQL(r.URL.Query().Get("jql"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var found []*Issue
+	for _, issue := range fake.issues {
+		if query.matches(fake, issue, user) {
+			found = append(found, issue)
+		}
+	}
+	idsOnly := r.URL.Query().Get("fields") == "id"
+	startAt, maxResults := fake.page(r)
+	issues := make([]jsonIssue, 0)
+	for i := startAt; i < len(found) && len(issues) < maxResults; i++ {
+		issue := fake.toJSONIssue(r, found[i])
+		if idsOnly {
+			issue.Fields = nil
+		}
+		issues = append(issues, issue)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"startAt": startAt, "maxResults": maxResults, "total": len(found), "issues": issues,
+	})
+}
+
+func (fake *Fake) createIssue(w http.ResponseWriter, r *http.Request) {
+	var req jsonNewIssue
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	errs := map[string]string{}
+	project := fake.project(req.Fields.Project.ID)
+	if project == nil {
+		project = fake.project(req.Fields.Project.Key)
+	}
+	if project == nil {
+		errs["project"] = "valid project is required"
+	} else if !hasIssueType(project, req.Fields.IssueType.ID) {
+		errs["issuetype"] = "valid issue type is required"
+	}
+	if req.Fields.Summary == "" {
+		errs["summary"] = "You must specify a summary of the issue."
+	}
+	var assignee string
+	if req.Fields.Assignee != nil && req.Fields.Assignee.Name != "" {
+		user := fake.userByKey(req.Fields.Assignee.Name)
+		if user == nil {
+			errs["assignee"] = "User '" + req.Fields.Assignee.Name + "' does not exist."
+		} else {
+			assignee = user.Key
+		}
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, jsonErrors{ErrorMessages: []string{}, Errors: errs})
+		return
+	}
+	issue := fake.addIssue(Issue{
+		ProjectID:   project.ID,
+		TypeID:      req.Fields.IssueType.ID,
+		Summary:     req.Fields.Summary,
+		Description: req.Fields.Description,
+		Assignee:    assignee,
+		DueDate:     req.Fields.DueDate,
+		Estimate:    int64(req.Fields.TimeTracking.OriginalEstimate * 60),
+	})
+	writeJSON(w, http.StatusCreated, jsonIssue{ID: issue.ID, Key: issue.Key, Self: issueURL(r, issue.ID)})
+}
+
+func (fake *Fake) page(r *http.Request) (startAt, maxResults int) {
+	startAt, _ = strconv.Atoi(r.URL.Query().Get("startAt"))
+	if startAt < 0 {
+		startAt = 0
+	}
+	maxResults, _ = strconv.Atoi(r.URL.Query().Get("maxResults"))
+	if maxResults <= 0 || maxResults > fake.PageSize {
+		maxResults = fake.PageSize
+	}
+	return
+}
+
+func (fake *Fake) toJSONIssue(r *http.Request, issue *Issue) jsonIssue {
+	fields := &jsonIssueFields{
+		Summary:     issue.Summary,
+		Description: issue.Description,
+		Status:      jsonNamedID{ID: issue.Status, Name: issue.Status},
+		Estimate:    issue.Estimate,
+		DueDate:     issue.DueDate,
+	}
+	if project := fake.project(issue.ProjectID); project != nil {
+		fields.Project = jsonNamedID{ID: project.ID, Key: project.Key, Name: project.Name}
+		for _, t := range project.IssueTypes {
+			if t.ID == issue.TypeID {
+				fields.IssueType = jsonNamedID{ID: t.ID, Name: t.Name}
+			}
+		}
+	}
+	if user := fake.userByKey(issue.Assignee); user != nil {
+		fields.Assignee = toJSONUser(user)
+	}
+	if issue.Resolved {
+		fields.Resolution = &jsonNamedID{ID: "1", Name: "Done"}
+	}
+	for _, worklog := range issue.Worklogs {
+		fields.Spent += worklog.TimeSpentSeconds
+	}
+	remaining := issue.Estimate - fields.Spent
+	if remaining < 0 {
+		remaining = 0
+	}
+	fields.Progress = jsonProgress{Progress: fields.Spent, Total: fields.Spent + remaining}
+	if fields.Progress.Total > 0 {
+		fields.Progress.Percent = fields.Spent * 100 / fields.Progress.Total
+	}
+	return jsonIssue{ID: issue.ID, Key: issue.Key, Self: issueURL(r, issue.ID), Fields: fields}
+}
+
+func (fake *Fake) toJSONWorklog(issue *Issue, worklog Worklog) jsonWorklog {
+	return jsonWorklog{
+		ID:               worklog.ID,
+		IssueID:          issue.ID,
+		Author:           toJSONUser(fake.userByKey(worklog.Author)),
+		Started:          worklog.Started,
+		TimeSpentSeconds: worklog.TimeSpentSeconds,
+		Comment:          worklog.Comment,
+	}
+}
+
+func (fake *Fake) toJSONComment(comment Comment) jsonComment {
+	return jsonComment{ID: comment.ID, Author: toJSONUser(fake.userByKey(comment.Author)), Body: comment.Body, Created: comment.Created}
+}
+
+func toJSONUser(user *User) *jsonUser {
+	if user == nil {
+		return nil
+	}
+	return &jsonUser{Key: user.Key, Name: user.Login, DisplayName: user.DisplayName, EmailAddress: user.Email}
+}
+
+func hasIssueType(project *Project, id string) bool {
+	for _, t := range project.IssueTypes {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func issueURL(r *http.Request, id string) string {
+	return fmt.Sprintf("%s%sissue/%s", baseURL(r), apiPath, id)
+}
+
+func fail(w http.ResponseWriter, failure Failure) {
+	if failure.Delay > 0 {
+		time.Sleep(failure.Delay)
+	}
+	if failure.Status != 0 {
+		writeError(w, failure.Status, "Injected failure")
+		return
+	}
+	if hijacker, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, jsonErrors{ErrorMessages: []string{message}, Errors: map[string]string{}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
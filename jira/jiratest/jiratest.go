@@ -0,0 +1,309 @@
+// Package jiratest provides in-memory fake of JIRA REST API for tests and local development
+package jiratest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TimestampLayout is format of worklog and comment timestamps
+	TimestampLayout = "2006-01-02T15:04:05.000-0700"
+	// DefaultPageSize is maximum amount of search results and worklogs returned at once
+	DefaultPageSize = 50
+)
+
+// User - JIRA user account
+type User struct {
+	Key         string
+	Login       string
+	Password    string
+	DisplayName string
+	Email       string
+}
+
+// IssueType - JIRA issue type
+type IssueType struct {
+	ID   string
+	Name string
+}
+
+// Project - JIRA project
+type Project struct {
+	ID          string
+	Key         string
+	Name        string
+	Description string
+	IssueTypes  []IssueType
+}
+
+// Worklog - work time reported for issue
+type Worklog struct {
+	ID               string
+	Author           string
+	Started          string
+	TimeSpentSeconds int64
+	Comment          string
+}
+
+// Comment - issue comment
+type Comment struct {
+	ID      string
+	Author  string
+	Body    string
+	Created string
+}
+
+// Transition - workflow transition available for every issue
+type Transition struct {
+	ID   string
+	Name string
+	// To is name of the resulting status
+	To string
+	// Resolves marks issue resolved, other transitions make it unresolved
+	Resolves bool
+}
+
+// Issue - JIRA issue
+type Issue struct {
+	ID          string
+	Key         string
+	ProjectID   string
+	TypeID      string
+	Summary     string
+	Description string
+	// Assignee is key of assigned user
+	Assignee string
+	// DueDate in 2006-01-02 format
+	DueDate  string
+	Estimate int64
+	Status   string
+	Resolved bool
+	Worklogs []Worklog
+	Comments []Comment
+}
+
+// Failure describes injected failure of requests matching Method and Path prefix, empty values match all requests
+type Failure struct {
+	Method string
+	Path   string
+	// Status is returned instead of handling request, zero status drops connection
+	Status int
+	// Delay is applied before failing the request
+	Delay time.Duration
+	// Times limits amount of failed requests, zero fails all of them
+	Times int
+}
+
+// Fake implements http.Handler serving JIRA REST API backed by in-memory state
+type Fake struct {
+	// PageSize limits amount of results returned at once
+	PageSize int
+	// Transitions available for all issues
+	Transitions []Transition
+
+	mu       sync.Mutex
+	users    []*User
+	projects []*Project
+	issues   []*Issue
+	failures []*Failure
+	requests int
+	nextID   int
+}
+
+// NewFake creates Fake without any data
+func NewFake() *Fake {
+	return &Fake{
+		PageSize: DefaultPageSize,
+		Transitions: []Transition{
+			{ID: "11", Name: "Start Progress", To: "In Progress"},
+			{ID: "21", Name: "Resolve Issue", To: "Resolved", Resolves: true},
+			{ID: "31", Name: "Reopen Issue", To: "Open"},
+		},
+		nextID: 10000,
+	}
+}
+
+// NewServer starts test HTTP server serving the fake, it should be closed by caller
+func NewServer(fake *Fake) *httptest.Server {
+	return httptest.NewServer(fake)
+}
+
+// Seed adds sample user, projects and issues, returns the user
+func (fake *Fake) Seed() User {
+	user := fake.AddUser(User{Key: "tester", Login: "tester", Password: "test", DisplayName: "Test User", Email: "tester@example.com"})
+	types := []IssueType{{ID: "1", Name: "Bug"}, {ID: "3", Name: "Task"}}
+	demo := fake.AddProject(Project{Key: "DEMO", Name: "Demo", Description: "Demo project", IssueTypes: types})
+	fake.AddProject(Project{Key: "OPS", Name: "Operations", IssueTypes: types})
+	for i := 1; i <= 3; i++ {
+		fake.AddIssue(Issue{ProjectID: demo.ID, TypeID: "3", Summary: fmt.Sprintf("Demo task %d", i), Assignee: user.Key, Estimate: 3600 * int64(i)})
+	}
+	fake.AddIssue(Issue{ProjectID: demo.ID, TypeID: "1", Summary: "Unassigned bug"})
+	return user
+}
+
+// AddUser registers user account
+func (fake *Fake) AddUser(user User) User {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if user.Key == "" {
+		user.Key = user.Login
+	}
+	fake.users = append(fake.users, &user)
+	return user
+}
+
+// AddProject adds project generating its ID if empty
+func (fake *Fake) AddProject(project Project) Project {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if project.ID == "" {
+		project.ID = fake.newID()
+	}
+	fake.projects = append(fake.projects, &project)
+	return project
+}
+
+// AddIssue adds issue to existing project generating its ID and key if empty
+func (fake *Fake) AddIssue(issue Issue) Issue {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.addIssue(issue)
+}
+
+// Issue returns current state of issue by ID or key
+func (fake *Fake) Issue(idOrKey string) (Issue, bool) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	issue := fake.issue(idOrKey)
+	if issue == nil {
+		return Issue{}, false
+	}
+	return *issue, true
+}
+
+// DeleteIssue removes issue by ID or key
+func (fake *Fake) DeleteIssue(idOrKey string) bool {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	issue := fake.issue(idOrKey)
+	if issue == nil {
+		return false
+	}
+	fake.deleteIssue(issue.ID)
+	return true
+}
+
+// Fail injects failure of matching requests
+func (fake *Fake) Fail(failure Failure) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.failures = append(fake.failures, &failure)
+}
+
+// ClearFailures removes all injected failures
+func (fake *Fake) ClearFailures() {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.failures = nil
+}
+
+// Requests returns amount of handled requests
+func (fake *Fake) Requests() int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return fake.requests
+}
+
+func (fake *Fake) newID() string {
+	fake.nextID++
+	return fmt.Sprintf("%d", fake.nextID)
+}
+
+func (fake *Fake) addIssue(issue Issue) Issue {
+	if issue.ID == "" {
+		issue.ID = fake.newID()
+	}
+	if issue.Key == "" {
+		if project := fake.project(issue.ProjectID); project != nil {
+			count := 0
+			for _, other := range fake.issues {
+				if other.ProjectID == project.ID {
+					count++
+				}
+			}
+			issue.Key = fmt.Sprintf("%s-%d", project.Key, count+1)
+		}
+	}
+	if issue.Status == "" {
+		issue.Status = "Open"
+	}
+	fake.issues = append(fake.issues, &issue)
+	return issue
+}
+
+func (fake *Fake) deleteIssue(id string) {
+	for i, issue := range fake.issues {
+		if issue.ID == id {
+			fake.issues = append(fake.issues[:i], fake.issues[i+1:]...)
+			return
+		}
+	}
+}
+
+func (fake *Fake) user(login, password string) *User {
+	for _, user := range fake.users {
+		if user.Login == login && user.Password == password {
+			return user
+		}
+	}
+	return nil
+}
+
+func (fake *Fake) userByKey(key string) *User {
+	for _, user := range fake.users {
+		if user.Key == key || user.Login == key {
+			return user
+		}
+	}
+	return nil
+}
+
+func (fake *Fake) project(idOrKey string) *Project {
+	for _, project := range fake.projects {
+		if project.ID == idOrKey || strings.EqualFold(project.Key, idOrKey) {
+			return project
+		}
+	}
+	return nil
+}
+
+func (fake *Fake) issue(idOrKey string) *Issue {
+	for _, issue := range fake.issues {
+		if issue.ID == idOrKey || issue.Key == idOrKey {
+			return issue
+		}
+	}
+	return nil
+}
+
+// failure returns injected failure matching the request, consuming one of its times
+func (fake *Fake) failure(r *http.Request) *Failure {
+	for i, f := range fake.failures {
+		if (f.Method == "" || f.Method == r.Method) && strings.HasPrefix(r.URL.Path, f.Path) {
+			res := *f
+			if f.Times > 0 {
+				f.Times--
+				if f.Times == 0 {
+					fake.failures = append(fake.failures[:i], fake.failures[i+1:]...)
+				}
+			}
+			return &res
+		}
+	}
+	return nil
+}
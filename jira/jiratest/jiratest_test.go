@@ -0,0 +1,81 @@
+package jiratest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJQL(t *testing.T) {
+	a := assert.New(t)
+	query, err := parseJQL(`project=10001 AND assignee=currentUser() and id in (1, 2)`)
+	a.NoError(err)
+	a.Equal(jql{
+		{field: "project", values: []string{"10001"}},
+		{field: "assignee", values: []string{"currentUser()"}},
+		{field: "id", values: []string{"1", "2"}},
+	}, query)
+
+	_, err = parseJQL(`labels=foo`)
+	a.Error(err)
+	_, err = parseJQL(`project ~ foo`)
+	a.Error(err)
+}
+
+func TestServe(t *testing.T) {
+	a := assert.New(t)
+	fake := NewFake()
+	user := fake.Seed()
+	get := func(path string) int {
+		r := httptest.NewRequest("GET", path, nil)
+		r.SetBasicAuth(user.Login, user.Password)
+		w := httptest.NewRecorder()
+		fake.ServeHTTP(w, r)
+		return w.Code
+	}
+	a.Equal(http.StatusOK, get("/rest/api/2/issue/DEMO-1"))
+	a.Equal(http.StatusOK, get("/rest/api/2/issue/DEMO-1/transitions"))
+	a.Equal(http.StatusNotFound, get("/rest/api/2/issue/DEMO-100"))
+	a.Equal(http.StatusBadRequest, get("/rest/api/2/search?jql=labels%3Dx"))
+
+	fake.Fail(Failure{Method: "GET", Path: "/rest/api/2/issue", Status: http.StatusInternalServerError, Times: 2})
+	a.Equal(http.StatusOK, get("/rest/api/2/myself"))
+	a.Equal(http.StatusInternalServerError, get("/rest/api/2/issue/DEMO-1"))
+	a.Equal(http.StatusInternalServerError, get("/rest/api/2/issue/DEMO-1"))
+	a.Equal(http.StatusOK, get("/rest/api/2/issue/DEMO-1"))
+	a.Equal(5+3, fake.Requests())
+}
+
+func TestTransitionsAndComments(t *testing.T) {
+	a := assert.New(t)
+	fake := NewFake()
+	user := fake.Seed()
+	srv := NewServer(fake)
+	defer srv.Close()
+
+	post := func(path, body string) int {
+		r, _ := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+		r.SetBasicAuth(user.Login, user.Password)
+		res, err := http.DefaultClient.Do(r)
+		if !a.NoError(err) {
+			return 0
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	a.Equal(http.StatusNoContent, post("/rest/api/2/issue/DEMO-1/transitions", `{"transition":{"id":"21"}}`))
+	a.Equal(http.StatusBadRequest, post("/rest/api/2/issue/DEMO-1/transitions", `{"transition":{"id":"99"}}`))
+	a.Equal(http.StatusCreated, post("/rest/api/2/issue/DEMO-1/comment", `{"body":"done"}`))
+
+	issue, ok := fake.Issue("DEMO-1")
+	a.True(ok)
+	a.True(issue.Resolved)
+	a.Equal("Resolved", issue.Status)
+	if a.Len(issue.Comments, 1) {
+		a.Equal("done", issue.Comments[0].Body)
+		a.Equal(user.Key, issue.Comments[0].Author)
+	}
+}
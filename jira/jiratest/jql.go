@@ -0,0 +1,112 @@
+package jiratest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// jqlDateLayout is format of dates in JQL queries
+const jqlDateLayout = "2006/01/02"
+
+var (
+	jqlAnd    = regexp.MustCompile(`(?i)\s+AND\s+`)
+	jqlClause = regexp.MustCompile(`(?i)^(\w+)\s*(=|\s+in\s+)\s*(.+)$`)
+)
+
+// clause is single JQL condition supported by fake: project, assignee, resolution, id,
+// worklogAuthor and worklogDate
+type clause struct {
+	field  string
+	values []string
+}
+
+type jql []clause
+
+// parseJQL parses conjunction of supported clauses
+func parseJQL(query string) (jql, error) {
+	var res jql
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return res, nil
+	}
+	for _, part := range jqlAnd.Split(query, -1) {
+		m := jqlClause.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("Error in the JQL Query: unsupported clause '%s'", part)
+		}
+		c := clause{field: strings.ToLower(m[1])}
+		value := strings.TrimSpace(m[3])
+		if strings.TrimSpace(m[2]) != "=" {
+			value = strings.TrimSuffix(strings.TrimPrefix(value, "("), ")")
+		}
+		for _, v := range strings.Split(value, ",") {
+			c.values = append(c.values, strings.Trim(strings.TrimSpace(v), `"'`))
+		}
+		switch c.field {
+		case "project", "assignee", "resolution", "id", "worklogauthor", "worklogdate":
+		default:
+			return nil, fmt.Errorf("Field '%s' does not exist or you do not have permission to view it.", m[1])
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func (query jql) matches(fake *Fake, issue *Issue, user *User) bool {
+	for _, c := range query {
+		if !c.matches(fake, issue, user) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c clause) matches(fake *Fake, issue *Issue, user *User) bool {
+	for _, value := range c.values {
+		if c.matchesValue(fake, issue, user, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c clause) matchesValue(fake *Fake, issue *Issue, user *User, value string) bool {
+	switch c.field {
+	case "project":
+		project := fake.project(value)
+		return project != nil && project.ID == issue.ProjectID
+	case "assignee":
+		return issue.Assignee == userKey(fake, user, value)
+	case "resolution":
+		return strings.EqualFold(value, "Unresolved") != issue.Resolved
+	case "id":
+		return issue.ID == value || issue.Key == value
+	case "worklogauthor":
+		key := userKey(fake, user, value)
+		for _, worklog := range issue.Worklogs {
+			if worklog.Author == key {
+				return true
+			}
+		}
+	case "worklogdate":
+		for _, worklog := range issue.Worklogs {
+			started, err := time.Parse(TimestampLayout, worklog.Started)
+			if err == nil && started.UTC().Format(jqlDateLayout) == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func userKey(fake *Fake, user *User, value string) string {
+	if strings.EqualFold(value, "currentUser()") {
+		return user.Key
+	}
+	if other := fake.userByKey(value); other != nil {
+		return other.Key
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+package jira
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Direct is used instead of proxy URL to connect to tracker host without proxy
+const Direct = "direct"
+
+// ProxyConfig describes proxies used to reach trackers.
+// Proxy URLs are http, https or socks5 ones and may include credentials.
+type ProxyConfig struct {
+	// URL of proxy used for all trackers, overrides environment variables when set
+	URL string
+	// NoProxy is comma separated list of hosts, domains and networks reached without proxy set by URL,
+	// in the same format as NO_PROXY environment variable
+	NoProxy string
+	// FromEnvironment enables HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables when URL is empty
+	FromEnvironment bool
+	// Trackers holds proxy URLs or Direct keyed by tracker host, they take precedence over other settings
+	Trackers map[string]string
+}
+
+// Proxy selects proxy for every tracker request
+type Proxy struct {
+	hosts    map[string]*url.URL
+	fallback func(*url.URL) (*url.URL, error)
+	// addrs holds host:port of all proxies
+	addrs map[string]bool
+}
+
+// NewProxy validates proxy URLs and creates Proxy
+func NewProxy(config ProxyConfig) (*Proxy, error) {
+	env := &httpproxy.Config{}
+	switch {
+	case config.URL != "":
+		env = &httpproxy.Config{HTTPProxy: config.URL, HTTPSProxy: config.URL, NoProxy: config.NoProxy}
+	case config.FromEnvironment:
+		env = httpproxy.FromEnvironment()
+	}
+	proxy := &Proxy{
+		hosts:    make(map[string]*url.URL, len(config.Trackers)),
+		fallback: env.ProxyFunc(),
+		addrs:    make(map[string]bool),
+	}
+	for _, raw := range []string{env.HTTPProxy, env.HTTPSProxy} {
+		if raw == "" {
+			continue
+		}
+		u, err := parseProxyURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		proxy.addrs[proxyAddr(u)] = true
+	}
+	for host, raw := range config.Trackers {
+		host = strings.ToLower(host)
+		if raw == Direct {
+			proxy.hosts[host] = nil
+			continue
+		}
+		u, err := parseProxyURL(raw)
+		if err != nil {
+			return nil, fmt.Errorf("proxy of tracker %s: %v", host, err)
+		}
+		proxy.hosts[host] = u
+		proxy.addrs[proxyAddr(u)] = true
+	}
+	return proxy, nil
+}
+
+// URL returns proxy for request or nil if request should be sent directly, it is suitable for http.Transport
+func (proxy *Proxy) URL(request *http.Request) (*url.URL, error) {
+	if proxy == nil {
+		return nil, nil
+	}
+	host := strings.ToLower(request.URL.Host)
+	if u, ok := proxy.hosts[host]; ok {
+		return u, nil
+	}
+	if u, ok := proxy.hosts[strings.ToLower(request.URL.Hostname())]; ok {
+		return u, nil
+	}
+	return proxy.fallback(request.URL)
+}
+
+// isProxy reports whether addr is host:port of configured proxy
+func (proxy *Proxy) isProxy(addr string) bool {
+	return proxy != nil && proxy.addrs[strings.ToLower(addr)]
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		// same as http.ProxyFromEnvironment, proxy may be given without scheme
+		if u, err = url.Parse("http://" + raw); err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy URL: host is empty")
+	}
+	return u, nil
+}
+
+func proxyAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080"}[u.Scheme]
+	}
+	return strings.ToLower(net.JoinHostPort(u.Hostname(), port))
+}
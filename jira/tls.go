@@ -0,0 +1,133 @@
+package jira
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/qarea/jirams/entities"
+)
+
+// TLSConfig describes TLS settings of tracker using internal CA or mutual TLS
+type TLSConfig struct {
+	// CA is PEM bundle of certificates trusted in addition to system ones
+	CA []byte
+	// Cert and Key are PEM encoded client certificate and its private key
+	Cert []byte
+	Key  []byte
+	// Pins are base64 encoded SHA-256 hashes of SubjectPublicKeyInfo, one of them must match
+	// a certificate presented by tracker when set
+	Pins []string
+	// InsecureSkipVerify disables verification of tracker certificate, for development only
+	InsecureSkipVerify bool
+}
+
+// NewTLSConfigs builds TLS configs for trackers keyed by host with optional port,
+// trackers with the same settings share a config and so a pooled transport.
+// Tracker IDs are not accepted as keys: they are supplied by clients along with tracker URL,
+// so client certificate or relaxed verification of one tracker could be used for any host.
+func NewTLSConfigs(configs map[string]TLSConfig) (map[string]*tls.Config, error) {
+	var (
+		res    = make(map[string]*tls.Config, len(configs))
+		shared = make(map[string]*tls.Config)
+	)
+	for key, config := range configs {
+		if _, err := strconv.ParseUint(key, 10, 64); err == nil {
+			return nil, fmt.Errorf("TLS config of tracker %s: settings should be keyed by tracker host, not ID", key)
+		}
+		key = strings.ToLower(key)
+		fingerprint := config.fingerprint()
+		if c, ok := shared[fingerprint]; ok {
+			res[key] = c
+			continue
+		}
+		c, err := config.build()
+		if err != nil {
+			return nil, fmt.Errorf("TLS config of tracker %s: %v", key, err)
+		}
+		shared[fingerprint] = c
+		res[key] = c
+	}
+	return res, nil
+}
+
+func (config TLSConfig) fingerprint() string {
+	h := sha256.New()
+	for _, data := range [][]byte{config.CA, config.Cert, config.Key} {
+		fmt.Fprintf(h, "%d:%s", len(data), data)
+	}
+	for _, pin := range config.Pins {
+		fmt.Fprintf(h, "%d:%s", len(pin), pin)
+	}
+	fmt.Fprint(h, config.InsecureSkipVerify)
+	return string(h.Sum(nil))
+}
+
+func (config TLSConfig) build() (*tls.Config, error) {
+	c := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: config.InsecureSkipVerify, // nolint: gosec
+	}
+	if len(config.CA) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(config.CA) {
+			return nil, errors.New("no certificates found in CA bundle")
+		}
+		c.RootCAs = pool
+	}
+	if len(config.Cert) > 0 || len(config.Key) > 0 {
+		cert, err := tls.X509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	if len(config.Pins) > 0 {
+		pins := make(map[string]bool, len(config.Pins))
+		for _, pin := range config.Pins {
+			if hash, err := base64.StdEncoding.DecodeString(pin); err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid pin %q", pin)
+			}
+			pins[pin] = true
+		}
+		c.VerifyConnection = func(state tls.ConnectionState) error {
+			for _, cert := range state.PeerCertificates {
+				if pins[SPKIPin(cert)] {
+					return nil
+				}
+			}
+			return errors.New("certificate doesn't match pinned public keys")
+		}
+	}
+	return c, nil
+}
+
+// SPKIPin returns base64 encoded SHA-256 hash of certificate's SubjectPublicKeyInfo
+func SPKIPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// tlsConfig returns TLS config of tracker looking it up by host with port and then by host
+func (requester *Requester) tlsConfig(tracker entities.TrackerConfig) *tls.Config {
+	if len(requester.TLS) == 0 {
+		return nil
+	}
+	u, err := url.Parse(tracker.URL)
+	if err != nil {
+		return nil
+	}
+	if c, ok := requester.TLS[strings.ToLower(u.Host)]; ok {
+		return c
+	}
+	return requester.TLS[strings.ToLower(u.Hostname())]
+}
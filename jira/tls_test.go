@@ -0,0 +1,127 @@
+package jira
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestTLS(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte(`{"Foo":"bar"}`))
+	}))
+	defer srv.Close()
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	tracker := testTrackerConfig
+	tracker.URL = srv.URL
+	addr := srv.Listener.Addr().String()
+	request := func(configs map[string]TLSConfig) error {
+		c, err := NewTLSConfigs(configs)
+		a.NoError(err)
+		requester := Requester{TLS: c}
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		var result TestEntity
+		return requester.Request(tracker, req, &result)
+	}
+
+	a.Error(request(nil), "unknown CA")
+	a.NoError(request(map[string]TLSConfig{addr: {CA: serverCA}}))
+	a.NoError(request(map[string]TLSConfig{"127.0.0.1": {InsecureSkipVerify: true}}))
+	a.Error(request(map[string]TLSConfig{"jira.example.com": {CA: serverCA}}), "other tracker")
+
+	pin := SPKIPin(srv.Certificate())
+	a.NoError(request(map[string]TLSConfig{addr: {CA: serverCA, Pins: []string{pin}}}))
+	a.Error(request(map[string]TLSConfig{addr: {CA: serverCA, Pins: []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}}}))
+
+	// tracker ID is supplied by client, so it can't select settings
+	_, err := NewTLSConfigs(map[string]TLSConfig{"7": {CA: serverCA}})
+	a.Error(err)
+}
+
+func TestPingTLS(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		a.Equal(basePath+serverInfoResource, req.URL.Path)
+		_, _ = res.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	requester := &Requester{}
+	a.Error(requester.Ping(srv.URL, time.Second), "unknown CA")
+	configs, err := NewTLSConfigs(map[string]TLSConfig{srv.Listener.Addr().String(): {
+		CA: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+	}})
+	a.NoError(err)
+	requester.TLS = configs
+	a.NoError(requester.Ping(srv.URL, time.Second))
+}
+
+func TestRequestClientCert(t *testing.T) {
+	a := assert.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a.NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jirams"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	a.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	a.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	a.NoError(err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte(`{"Foo":"bar"}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	config := TLSConfig{
+		CA:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	addr := srv.Listener.Addr().String()
+	configs, err := NewTLSConfigs(map[string]TLSConfig{addr: config, "Jira.Example.com": config})
+	a.NoError(err)
+	a.True(configs[addr] == configs["jira.example.com"], "same settings should share config")
+
+	tracker := testTrackerConfig
+	tracker.URL = srv.URL
+	requester := Requester{TLS: configs}
+	var result TestEntity
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	a.NoError(requester.Request(tracker, req, &result))
+	a.Equal(TestEntity{Foo: "bar"}, result)
+
+	tracker.URL = "https://JIRA.example.com"
+	a.True(requester.tlsConfig(tracker) == configs[addr], "host should be case insensitive")
+	req, _ = http.NewRequest("GET", srv.URL, nil)
+	a.NoError(requester.Request(tracker, req, &result))
+	a.Len(requester.transports, 1)
+
+	_, err = NewTLSConfigs(map[string]TLSConfig{"jira.local": {Cert: config.Cert}})
+	a.Error(err)
+	_, err = NewTLSConfigs(map[string]TLSConfig{"jira.local": {CA: []byte("garbage")}})
+	a.Error(err)
+}
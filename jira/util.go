@@ -1,56 +1,230 @@
 package jira
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/metrics"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/ssrf"
+	"github.com/qarea/jirams/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// maxRedirects is the same as default limit of http.Client
+const maxRedirects = 10
+
 // TrackerRequester interface defines capability to make one or iteration of requests to the tracker
 type TrackerRequester interface {
 	Request(entities.TrackerConfig, *http.Request, interface{}) error
-	IterateRequest(entities.TrackerConfig, string, interface{}, func(interface{}) (int, int, error)) error
+	IterateRequest(context.Context, entities.TrackerConfig, string, interface{}, func(interface{}) (int, int, error)) error
 }
 
 // Requester implements TrackerRequester for JIRA tracker
-type Requester struct{}
+type Requester struct {
+	// Cache enables conditional GET requests when set
+	Cache *HTTPCache
+	// Transport is used to make requests instead of http.DefaultTransport when set
+	Transport http.RoundTripper
+	// Dump logs redacted requests and responses with DEBUG level
+	Dump bool
+	// Policy restricts tracker hosts, host names reached through proxy must be allowlisted.
+	// Any host is permitted when nil.
+	Policy *ssrf.Policy
+	// TLS holds TLS configs of trackers keyed by host, see NewTLSConfigs
+	TLS map[string]*tls.Config
+	// Proxy selects proxy for tracker requests, environment variables are used when nil
+	Proxy *Proxy
+
+	mu         sync.Mutex
+	transports map[*tls.Config]*http.Transport
+}
 
 // Request performs a request to specified JIRA API URL and unmarshals the response to data structure
-func (requester *Requester) Request(tracker entities.TrackerConfig, request *http.Request, res interface{}) error {
-	httpClient := &http.Client{}
+func (requester *Requester) Request(tracker entities.TrackerConfig, request *http.Request, res interface{}) (err error) {
+	ctx, span := tracing.Start(request.Context(), "JIRA "+request.Method+" "+metrics.Endpoint(request.URL.Path),
+		attribute.String("http.method", request.Method),
+		attribute.String("http.url", redact.String(request.URL.String())),
+		attribute.Int64("tracker.id", int64(tracker.ID)))
+	defer func() { tracing.End(span, err) }()
+	request = request.WithContext(ctx)
+	tracing.Inject(ctx, request.Header)
+
+	if err := requester.Policy.CheckURL(ctx, request.URL); err != nil {
+		return forbidden(ctx, err)
+	}
+	httpClient := &http.Client{
+		Transport:     requester.transport(tracker),
+		CheckRedirect: requester.checkRedirect,
+	}
 	request.SetBasicAuth(tracker.Credentials.Login, tracker.Credentials.Password)
 
-	response, err := httpClient.Do(request)
+	var (
+		cacheKey string
+		cached   httpCacheEntry
+		isCached bool
+	)
+	if requester.Cache != nil && request.Method == "GET" {
+		cacheKey = httpCacheKey(tracker, request)
+		cached, isCached = requester.Cache.get(cacheKey)
+		if isCached {
+			if cached.etag != "" {
+				request.Header.Set("If-None-Match", cached.etag)
+			}
+			if cached.lastModified != "" {
+				request.Header.Set("If-Modified-Since", cached.lastModified)
+			}
+		}
+	}
+
+	response, err := requester.do(httpClient, request)
 	if err != nil {
-		return err
+		return forbidden(ctx, err)
 	}
 	defer response.Body.Close()
+	span.SetAttributes(attribute.Int("http.status_code", response.StatusCode))
+	if response.StatusCode == http.StatusNotModified && isCached {
+		return decodeBody(cached.body, res)
+	}
 	if response.StatusCode >= 400 {
 		switch response.StatusCode {
 		case 401:
 			return entities.ErrInvalidCredentials
 		case 404:
 			return entities.ErrNotFound
+		case 503:
+			// tracker refused to process the request, unlike 502 and 504 of gateway which may have forwarded it
+			return entities.ErrServerUnavailable
 		default:
 			if response.StatusCode >= 500 {
-				return entities.ErrServerUnavailable
+				return entities.ErrServerFailed
 			}
-			l.ERR(response.Status)
+			l.ERR("[%s] %s %s: %s", tracing.ID(ctx), request.Method, metrics.Endpoint(request.URL.Path), response.Status)
 			return entities.ErrInvalidRequest
 		}
 	}
+	etag, lastModified := response.Header.Get("ETag"), response.Header.Get("Last-Modified")
+	if cacheKey != "" && (etag != "" || lastModified != "") {
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		requester.Cache.put(httpCacheEntry{key: cacheKey, etag: etag, lastModified: lastModified, body: body})
+		return decodeBody(body, res)
+	}
 	if res == nil {
 		return nil
 	}
 	return json.NewDecoder(response.Body).Decode(res)
 }
 
+// transport returns Transport if set, otherwise pooled transport for TLS config of tracker
+// using Proxy and checking addresses with Policy when connecting
+func (requester *Requester) transport(tracker entities.TrackerConfig) http.RoundTripper {
+	if requester.Transport != nil {
+		return requester.Transport
+	}
+	tlsConfig := requester.tlsConfig(tracker)
+	if tlsConfig == nil && requester.Policy == nil && requester.Proxy == nil {
+		return nil
+	}
+	requester.mu.Lock()
+	defer requester.mu.Unlock()
+	transport, ok := requester.transports[tlsConfig]
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		if requester.Proxy != nil {
+			transport.Proxy = requester.Proxy.URL
+		}
+		if requester.Policy != nil {
+			proxy := transport.Proxy
+			// proxy connects to tracker host, so only hosts which can't be rebound are sent through it
+			transport.Proxy = func(request *http.Request) (*url.URL, error) {
+				u, err := proxy(request)
+				if u == nil || err != nil {
+					return u, err
+				}
+				if err := requester.Policy.CheckProxied(request.Context(), request.URL.Hostname()); err != nil {
+					return nil, err
+				}
+				return u, nil
+			}
+		}
+		if requester.Policy != nil {
+			dial := (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+			guarded := requester.Policy.DialContext(dial)
+			// configured proxies may be internal hosts, proxied tracker hosts are checked by transport.Proxy
+			transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if requester.Proxy.isProxy(addr) {
+					return dial(ctx, network, addr)
+				}
+				return guarded(ctx, network, addr)
+			}
+		}
+		if tlsConfig != nil {
+			transport.TLSClientConfig = tlsConfig
+		}
+		if requester.transports == nil {
+			requester.transports = make(map[*tls.Config]*http.Transport)
+		}
+		requester.transports[tlsConfig] = transport
+	}
+	return transport
+}
+
+// forbidden replaces error caused by Policy with API error, other errors are returned as is
+func forbidden(ctx context.Context, err error) error {
+	var forbidden *ssrf.ForbiddenError
+	if !errors.As(err, &forbidden) {
+		return err
+	}
+	l.WARN("[%s] Tracker URL rejected: %v", tracing.ID(ctx), forbidden)
+	return entities.ErrInvalidTrackerURL
+}
+
+// do sends the request, recording telemetry and dumping it when enabled
+func (requester *Requester) do(httpClient *http.Client, request *http.Request) (*http.Response, error) {
+	if requester.Dump {
+		l.DEBUG("[%s] request:\n%s", tracing.ID(request.Context()), redact.DumpRequest(request))
+	}
+	url := request.URL.String()
+	started := time.Now()
+	response, err := httpClient.Do(request)
+	status := 0
+	if err == nil {
+		status = response.StatusCode
+	}
+	metrics.ObserveJira(request.Method, url, status, started)
+	l.DEBUG("[%s] %s %s: %d", tracing.ID(request.Context()), request.Method, metrics.Endpoint(url), status)
+	if requester.Dump && err == nil {
+		l.DEBUG("[%s] response:\n%s", tracing.ID(request.Context()), redact.DumpResponse(response))
+	}
+	return response, err
+}
+
+func decodeBody(body []byte, res interface{}) error {
+	if res == nil {
+		return nil
+	}
+	return json.NewDecoder(bytes.NewReader(body)).Decode(res)
+}
+
 // IterateRequest performs requests to specified URL until all items are retrieved
 // Each chunk of entities in passed to the callback function
-func (requester *Requester) IterateRequest(tracker entities.TrackerConfig, url string, dataContainer interface{}, callback func(interface{}) (int, int, error)) error {
+func (requester *Requester) IterateRequest(ctx context.Context, tracker entities.TrackerConfig, url string, dataContainer interface{}, callback func(interface{}) (int, int, error)) error {
 	var (
 		startAt  = 0
 		finished = false
@@ -61,7 +235,7 @@ func (requester *Requester) IterateRequest(tracker entities.TrackerConfig, url s
 		if strings.Contains(url, "?") {
 			glue = "&"
 		}
-		request, _ := http.NewRequest("GET", url+glue+paginationParams, nil)
+		request, _ := newRequest(ctx, "GET", url+glue+paginationParams, nil)
 		err := requester.Request(tracker, request, dataContainer)
 		if err != nil {
 			return err
@@ -77,9 +251,64 @@ func (requester *Requester) IterateRequest(tracker entities.TrackerConfig, url s
 	return nil
 }
 
+// newRequest creates HTTP request bound to the context
+func newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return request.WithContext(ctx), nil
+}
+
+// Ping checks that JIRA at given URL is reachable by anonymous request for server information,
+// request is sent with TLS config, proxy and policy of trackers at this URL
+func (requester *Requester) Ping(trackerURL string, timeout time.Duration) error {
+	request, err := http.NewRequest("GET", trackerURL+basePath+serverInfoResource, nil)
+	if err != nil {
+		return err
+	}
+	if err := requester.Policy.CheckURL(request.Context(), request.URL); err != nil {
+		return err
+	}
+	httpClient := &http.Client{
+		Transport:     requester.transport(entities.TrackerConfig{URL: trackerURL}),
+		CheckRedirect: requester.checkRedirect,
+		Timeout:       timeout,
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("unexpected response status: %s", response.Status)
+	}
+	return nil
+}
+
+func (requester *Requester) checkRedirect(redirect *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	return requester.Policy.CheckURL(redirect.Context(), redirect.URL)
+}
+
+// ValidateTracker rejects tracker config before any request is made:
+// URL must be absolute http(s) URL permitted by Policy and credentials must be set
+func (requester *Requester) ValidateTracker(ctx context.Context, tracker entities.TrackerConfig) error {
+	if err := validateTrackerConfig(tracker); err != nil {
+		return err
+	}
+	u, _ := url.Parse(tracker.URL)
+	if err := requester.Policy.CheckURL(ctx, u); err != nil {
+		return forbidden(ctx, err)
+	}
+	return nil
+}
+
 func validateTrackerConfig(cfg entities.TrackerConfig) (err error) {
 	switch {
-	case cfg.URL == "":
+	case cfg.URL == "" || !validTrackerURL(cfg.URL):
 		err = entities.ErrInvalidTrackerURL
 	case cfg.Credentials.Login == "":
 		err = entities.ErrInvalidCredentials
@@ -88,3 +317,11 @@ func validateTrackerConfig(cfg entities.TrackerConfig) (err error) {
 	}
 	return
 }
+
+// validTrackerURL checks tracker URL is absolute http(s) URL without credentials, query or fragment,
+// its addresses are checked by Requester
+func validTrackerURL(trackerURL string) bool {
+	u, err := url.Parse(trackerURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != "" &&
+		u.User == nil && u.RawQuery == "" && u.Fragment == "" && !u.ForceQuery
+}
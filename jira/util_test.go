@@ -2,12 +2,15 @@ package jira
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/ssrf"
+	"github.com/qarea/jirams/tracing"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -78,6 +81,24 @@ func TestRequest(t *testing.T) {
 			method:       "GET",
 			responseCode: http.StatusInternalServerError,
 			expectError:  true,
+			error:        entities.ErrServerFailed,
+		},
+		"502": {
+			method:       "GET",
+			responseCode: http.StatusBadGateway,
+			expectError:  true,
+			error:        entities.ErrServerFailed,
+		},
+		"504": {
+			method:       "POST",
+			responseCode: http.StatusGatewayTimeout,
+			expectError:  true,
+			error:        entities.ErrServerFailed,
+		},
+		"503": {
+			method:       "GET",
+			responseCode: http.StatusServiceUnavailable,
+			expectError:  true,
 			error:        entities.ErrServerUnavailable,
 		},
 	}
@@ -136,7 +157,7 @@ func TestIterateRequest(t *testing.T) {
 		result []TestEntity
 	)
 
-	err := requester.IterateRequest(testTrackerConfig, url, &tpl, func(data interface{}) (loaded int, total int, err error) {
+	err := requester.IterateRequest(context.Background(), testTrackerConfig, url, &tpl, func(data interface{}) (loaded int, total int, err error) {
 		if data, ok := data.(*TestEntityPage); ok {
 			loaded = len(data.Entities)
 			total = data.Total
@@ -153,3 +174,63 @@ func TestIterateRequest(t *testing.T) {
 		{Foo: "baz"},
 	}, result)
 }
+
+func TestRequestTracingID(t *testing.T) {
+	a := assert.New(t)
+	var header string
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		header = req.Header.Get(tracing.Header)
+		_, _ = res.Write([]byte(`{"Foo":"bar"}`))
+	}))
+	defer srv.Close()
+
+	var result TestEntity
+	requester := Requester{}
+	ctx := context.WithValue(context.Background(), "TracingID", "trace-1")
+	request, _ := newRequest(ctx, "GET", srv.URL, nil)
+	a.NoError(requester.Request(testTrackerConfig, request, &result))
+	a.Equal("trace-1", header)
+}
+
+func TestValidateTracker(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	tracker := entities.TrackerConfig{URL: "http://127.0.0.1:8080", Credentials: entities.TrackerCredentials{Login: "test", Password: "test"}}
+	requester := &Requester{}
+	a.NoError(requester.ValidateTracker(ctx, tracker))
+	requester.Policy = &ssrf.Policy{}
+	a.Equal(entities.ErrInvalidTrackerURL, requester.ValidateTracker(ctx, tracker), "internal address")
+	tracker.URL = "ftp://tracker.com"
+	a.Equal(entities.ErrInvalidTrackerURL, requester.ValidateTracker(ctx, tracker))
+	tracker.URL, tracker.Credentials.Password = "http://203.0.113.10", ""
+	a.Equal(entities.ErrInvalidCredentials, requester.ValidateTracker(ctx, tracker))
+}
+
+func TestRequestPolicy(t *testing.T) {
+	a := assert.New(t)
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		if req.URL.Path == "/redirect" {
+			http.Redirect(res, req, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+			return
+		}
+		_, _ = res.Write([]byte(`{"Foo":"bar"}`))
+	}))
+	defer srv.Close()
+
+	var result TestEntity
+	requester := Requester{Policy: &ssrf.Policy{}}
+	request, _ := http.NewRequest("GET", srv.URL, nil)
+	a.Equal(entities.ErrInvalidTrackerURL, requester.Request(testTrackerConfig, request, &result))
+	a.Equal(0, calls)
+
+	policy, err := ssrf.NewPolicy([]string{"127.0.0.1"}, nil, false)
+	a.NoError(err)
+	requester = Requester{Policy: policy}
+	request, _ = http.NewRequest("GET", srv.URL, nil)
+	a.NoError(requester.Request(testTrackerConfig, request, &result))
+	request, _ = http.NewRequest("GET", srv.URL+"/redirect", nil)
+	a.Equal(entities.ErrInvalidTrackerURL, requester.Request(testTrackerConfig, request, &result))
+	a.Equal(2, calls)
+}
@@ -0,0 +1,175 @@
+package jira
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/events"
+)
+
+const (
+	webhookPath     = "/rest/webhooks/1.0/"
+	webhookResource = "webhook"
+	webhookJQLKey   = "issue-related-events-section"
+)
+
+// WebhookEvents lists webhook events handled by the service
+var WebhookEvents = []string{
+	"jira:issue_created",
+	"jira:issue_updated",
+	"jira:issue_deleted",
+	"worklog_created",
+	"worklog_updated",
+	"worklog_deleted",
+}
+
+var webhookEventTypes = map[string]events.Type{
+	"jira:issue_created": events.IssueCreated,
+	"jira:issue_updated": events.IssueUpdated,
+	"jira:issue_deleted": events.IssueRemoved,
+	"worklog_created":    events.WorklogCreated,
+	"worklog_updated":    events.WorklogUpdated,
+	"worklog_deleted":    events.WorklogDeleted,
+}
+
+// ErrUnsupportedWebhook is returned for webhook events not handled by the service
+var ErrUnsupportedWebhook = errors.New("unsupported webhook event")
+
+// WebhookPayload - JIRA webhook request body
+type WebhookPayload struct {
+	Event   string          `json:"webhookEvent"`
+	Issue   *Issue          `json:"issue,omitempty"`
+	Worklog *WebhookWorklog `json:"worklog,omitempty"`
+}
+
+// WebhookWorklog - JIRA worklog structure sent with webhooks
+type WebhookWorklog struct {
+	Worklog
+	IssueID string `json:"issueId"`
+}
+
+func (worklog *WebhookWorklog) toReport() entities.Report {
+	issueID, _ := strconv.ParseUint(worklog.IssueID, 10, 64)
+	var started entities.Timestamp
+	if t, err := time.Parse(jiraTimestampLayout, worklog.Started); err == nil {
+		started = entities.Timestamp(t.Unix())
+	}
+	return entities.Report{
+		IssueID:  entities.IssueID(issueID),
+		Started:  started,
+		Duration: entities.Duration(worklog.Spent),
+		Comments: worklog.Comment,
+	}
+}
+
+// ParseWebhook normalizes JIRA webhook body into event of given tracker
+func ParseWebhook(trackerID entities.TrackerID, data []byte) (events.Event, error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return events.Event{}, err
+	}
+	eventType, ok := webhookEventTypes[payload.Event]
+	if !ok {
+		return events.Event{}, ErrUnsupportedWebhook
+	}
+	event := events.Event{Type: eventType, TrackerID: trackerID}
+	switch {
+	case payload.Worklog != nil:
+		report := payload.Worklog.toReport()
+		event.IssueID = report.IssueID
+		event.Report = &report
+	case payload.Issue != nil:
+		issue := payload.Issue.toIssue()
+		event.IssueID = issue.ID
+		event.ProjectID = payload.Issue.Fields.ProjectID.toProjectID()
+		if eventType != events.IssueRemoved {
+			event.Issue = &issue
+		}
+	default:
+		return events.Event{}, fmt.Errorf("webhook %s has no issue or worklog", payload.Event)
+	}
+	return event, nil
+}
+
+// Webhook - JIRA webhook registration structure
+type Webhook struct {
+	Self    string            `json:"self,omitempty"`
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Events  []string          `json:"events"`
+	Filters map[string]string `json:"filters,omitempty"`
+	Enabled bool              `json:"enabled"`
+}
+
+func (webhook *Webhook) toWebhook() entities.Webhook {
+	id, _ := strconv.ParseUint(path.Base(webhook.Self), 10, 64)
+	return entities.Webhook{
+		ID:      id,
+		Name:    webhook.Name,
+		URL:     webhook.URL,
+		Events:  webhook.Events,
+		JQL:     webhook.Filters[webhookJQLKey],
+		Enabled: webhook.Enabled,
+	}
+}
+
+// RegisterWebhook registers webhook in tracker, all handled events are used if none given
+func (client *Client) RegisterWebhook(ctx context.Context, tracker entities.TrackerConfig, webhook entities.Webhook, res *entities.Webhook) error {
+	if len(webhook.Events) == 0 {
+		webhook.Events = WebhookEvents
+	}
+	payload := Webhook{
+		Name:    webhook.Name,
+		URL:     webhook.URL,
+		Events:  webhook.Events,
+		Enabled: true,
+	}
+	if webhook.JQL != "" {
+		payload.Filters = map[string]string{webhookJQLKey: webhook.JQL}
+	}
+	payloadBytes, _ := json.Marshal(payload)
+	request, err := newRequest(ctx, "POST", tracker.URL+webhookPath+webhookResource, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	var created Webhook
+	if err := client.Jira.Request(tracker, request, &created); err != nil {
+		return err
+	}
+	*res = created.toWebhook()
+	return nil
+}
+
+// GetWebhooks returns webhooks registered in tracker
+func (client *Client) GetWebhooks(ctx context.Context, tracker entities.TrackerConfig, res *[]entities.Webhook) error {
+	request, err := newRequest(ctx, "GET", tracker.URL+webhookPath+webhookResource, nil)
+	if err != nil {
+		return err
+	}
+	var webhooks []Webhook
+	if err := client.Jira.Request(tracker, request, &webhooks); err != nil {
+		return err
+	}
+	*res = make([]entities.Webhook, len(webhooks))
+	for i, webhook := range webhooks {
+		(*res)[i] = webhook.toWebhook()
+	}
+	return nil
+}
+
+// DeleteWebhook removes webhook from tracker
+func (client *Client) DeleteWebhook(ctx context.Context, tracker entities.TrackerConfig, webhookID uint64) error {
+	request, err := newRequest(ctx, "DELETE", fmt.Sprintf("%s%s%s/%d", tracker.URL, webhookPath, webhookResource, webhookID), nil)
+	if err != nil {
+		return err
+	}
+	return client.Jira.Request(tracker, request, nil)
+}
@@ -0,0 +1,95 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWebhook(t *testing.T) {
+	a := assert.New(t)
+
+	event, err := ParseWebhook(3, []byte(`{
+		"webhookEvent": "jira:issue_updated",
+		"issue": {
+			"id": "10002",
+			"self": "https://tracker.com/rest/api/2/issue/10002",
+			"key": "TST-2",
+			"fields": {"summary": "Test", "issuetype": {"id": "1", "name": "Bug"}, "project": {"id": "10000"}}
+		}
+	}`))
+	a.NoError(err)
+	a.Equal(events.IssueUpdated, event.Type)
+	a.Equal(entities.TrackerID(3), event.TrackerID)
+	a.Equal(entities.ProjectID(10000), event.ProjectID)
+	a.Equal(entities.IssueID(10002), event.IssueID)
+	if a.NotNil(event.Issue) {
+		a.Equal("https://tracker.com/browse/TST-2", event.Issue.URL)
+		a.Equal("Test", event.Issue.Title)
+	}
+
+	event, err = ParseWebhook(3, []byte(`{
+		"webhookEvent": "worklog_created",
+		"worklog": {"issueId": "10002", "started": "2016-12-22T10:00:00.000+0000", "timeSpentSeconds": 3600, "comment": "work"}
+	}`))
+	a.NoError(err)
+	a.Equal(events.WorklogCreated, event.Type)
+	a.Equal(entities.IssueID(10002), event.IssueID)
+	a.Equal(&entities.Report{IssueID: 10002, Started: 1482400800, Duration: 3600, Comments: "work"}, event.Report)
+
+	_, err = ParseWebhook(3, []byte(`{"webhookEvent": "project_created"}`))
+	a.Equal(ErrUnsupportedWebhook, err)
+
+	_, err = ParseWebhook(3, []byte(`{"webhookEvent": "jira:issue_created"}`))
+	a.Error(err)
+}
+
+type webhookRequester struct {
+	TestJiraRequesterErr
+	method string
+	url    string
+	body   map[string]interface{}
+	res    string
+}
+
+func (r *webhookRequester) Request(tracker entities.TrackerConfig, request *http.Request, res interface{}) error {
+	r.method, r.url = request.Method, request.URL.String()
+	if request.Body != nil {
+		data, _ := io.ReadAll(request.Body)
+		_ = json.Unmarshal(data, &r.body)
+	}
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(r.res), res)
+}
+
+func TestWebhookRegistration(t *testing.T) {
+	a := assert.New(t)
+	requester := &webhookRequester{res: `{"self":"https://tracker.com/rest/webhooks/1.0/webhook/7","name":"jirams","url":"https://svc/webhook","events":["jira:issue_created"],"filters":{"issue-related-events-section":"project = TST"},"enabled":true}`}
+	client := Client{&MockStore{}, requester}
+	tracker := entities.TrackerConfig{URL: "https://tracker.com"}
+
+	var webhook entities.Webhook
+	err := client.RegisterWebhook(context.Background(), tracker, entities.Webhook{Name: "jirams", URL: "https://svc/webhook", JQL: "project = TST"}, &webhook)
+	a.NoError(err)
+	a.Equal("POST", requester.method)
+	a.Equal("https://tracker.com/rest/webhooks/1.0/webhook", requester.url)
+	a.Len(requester.body["events"], len(WebhookEvents))
+	a.Equal(entities.Webhook{ID: 7, Name: "jirams", URL: "https://svc/webhook", Events: []string{"jira:issue_created"}, JQL: "project = TST", Enabled: true}, webhook)
+
+	requester.res = "[" + requester.res + "]"
+	var webhooks []entities.Webhook
+	a.NoError(client.GetWebhooks(context.Background(), tracker, &webhooks))
+	a.Equal([]entities.Webhook{webhook}, webhooks)
+
+	a.NoError(client.DeleteWebhook(context.Background(), tracker, 7))
+	a.Equal("DELETE", requester.method)
+	a.Equal("https://tracker.com/rest/webhooks/1.0/webhook/7", requester.url)
+}
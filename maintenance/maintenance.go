@@ -0,0 +1,124 @@
+// Package maintenance keeps service maintenance state for all or specific trackers
+package maintenance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+var log = redact.NewLog("maintenance: ")
+
+// State - maintenance configuration
+type State struct {
+	// All enables maintenance for all trackers
+	All bool
+	// Trackers lists IDs of trackers under maintenance
+	Trackers []entities.TrackerID
+	// URLs lists base URLs of trackers under maintenance
+	URLs []string
+	// ETA is expected end of maintenance, optional
+	ETA entities.Timestamp
+}
+
+// Mode keeps current maintenance state
+type Mode struct {
+	mu    sync.RWMutex
+	state State
+}
+
+// Set replaces current maintenance state
+func (mode *Mode) Set(state State) {
+	mode.mu.Lock()
+	defer mode.mu.Unlock()
+	mode.state = state
+}
+
+// State returns current maintenance state
+func (mode *Mode) State() State {
+	mode.mu.RLock()
+	defer mode.mu.RUnlock()
+	return mode.state
+}
+
+// Check returns maintenance error if given tracker is under maintenance
+func (mode *Mode) Check(tracker entities.TrackerConfig) error {
+	mode.mu.RLock()
+	defer mode.mu.RUnlock()
+	if mode.state.All {
+		return entities.NewMaintenanceError(mode.state.ETA)
+	}
+	for _, id := range mode.state.Trackers {
+		if id == tracker.ID {
+			return entities.NewMaintenanceError(mode.state.ETA)
+		}
+	}
+	trackerURL := normalizeURL(tracker.URL)
+	for _, url := range mode.state.URLs {
+		if normalizeURL(url) == trackerURL {
+			return entities.NewMaintenanceError(mode.state.ETA)
+		}
+	}
+	return nil
+}
+
+// Watch reloads state using load every interval until stop is closed.
+// State is applied only when loaded data changes, so state set in between is kept.
+// Empty or missing data means no maintenance.
+func (mode *Mode) Watch(load func() ([]byte, error), interval time.Duration, stop <-chan struct{}) {
+	var (
+		last   []byte
+		loaded bool
+	)
+	reload := func() {
+		ctx := traceid.New(context.Background())
+		data, err := load()
+		if err != nil {
+			data = nil
+		}
+		data = bytes.TrimSpace(data)
+		if loaded && bytes.Equal(data, last) {
+			return
+		}
+		last, loaded = data, true
+		state, err := Parse(data)
+		if err != nil {
+			log.ERR("[%s] Failed to parse maintenance state: %v", traceid.FromContext(ctx), err)
+			return
+		}
+		log.NOTICE("[%s] Maintenance state changed: %+v", traceid.FromContext(ctx), state)
+		mode.Set(state)
+	}
+
+	reload()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reload()
+		}
+	}
+}
+
+// Parse decodes JSON encoded maintenance state, empty data means no maintenance
+func Parse(data []byte) (state State, err error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return
+	}
+	err = json.Unmarshal(data, &state)
+	return
+}
+
+func normalizeURL(url string) string {
+	return strings.ToLower(strings.TrimRight(url, "/"))
+}
@@ -0,0 +1,78 @@
+package maintenance
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+var testTracker = entities.TrackerConfig{ID: 1, URL: "https://Tracker.com/"}
+
+func TestCheck(t *testing.T) {
+	a := assert.New(t)
+	mode := &Mode{}
+	a.NoError(mode.Check(testTracker))
+
+	mode.Set(State{Trackers: []entities.TrackerID{2}})
+	a.NoError(mode.Check(testTracker))
+
+	mode.Set(State{Trackers: []entities.TrackerID{1}})
+	a.Equal(entities.ErrMaintenance, mode.Check(testTracker))
+
+	mode.Set(State{URLs: []string{"https://tracker.com"}, ETA: 1482624000})
+	err := mode.Check(testTracker)
+	if a.IsType(&jsonrpc2.Error{}, err) {
+		a.Equal(entities.ErrMaintenance.Code, err.(*jsonrpc2.Error).Code)
+		a.Equal(entities.MaintenanceInfo{ETA: 1482624000}, err.(*jsonrpc2.Error).Data)
+	}
+
+	mode.Set(State{All: true})
+	a.Equal(entities.ErrMaintenance, mode.Check(entities.TrackerConfig{ID: 5}))
+}
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	state, err := Parse([]byte(" \n"))
+	a.NoError(err)
+	a.Equal(State{}, state)
+
+	state, err = Parse([]byte(`{"Trackers":[1,2],"ETA":10}`))
+	a.NoError(err)
+	a.Equal(State{Trackers: []entities.TrackerID{1, 2}, ETA: 10}, state)
+
+	_, err = Parse([]byte(`{`))
+	a.Error(err)
+}
+
+func TestWatch(t *testing.T) {
+	a := assert.New(t)
+	var (
+		mu   sync.Mutex
+		data = []byte(`{"All":true}`)
+	)
+	load := func() ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return data, nil
+	}
+	mode := &Mode{}
+	stop := make(chan struct{})
+	defer close(stop)
+	go mode.Watch(load, time.Millisecond, stop)
+
+	a.Eventually(func() bool { return mode.State().All }, time.Second, time.Millisecond)
+
+	// state set in between is kept while config is not changed
+	mode.Set(State{})
+	time.Sleep(10 * time.Millisecond)
+	a.False(mode.State().All)
+
+	mu.Lock()
+	data = []byte(`{"Trackers":[3]}`)
+	mu.Unlock()
+	a.Eventually(func() bool { return len(mode.State().Trackers) == 1 }, time.Second, time.Millisecond)
+}
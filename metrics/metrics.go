@@ -0,0 +1,130 @@
+// Package metrics provides Prometheus telemetry for RPC calls, JIRA requests and storage operations
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "jirams"
+
+var (
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "requests_total",
+		Help:      "Amount of RPC calls by method and resulting error code (0 for success).",
+	}, []string{"method", "code"})
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "duration_seconds",
+		Help:      "RPC call latency by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+	jiraRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "jira",
+		Name:      "requests_total",
+		Help:      "Amount of JIRA requests by HTTP method, endpoint template and response status.",
+	}, []string{"method", "endpoint", "status"})
+	jiraDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "jira",
+		Name:      "request_duration_seconds",
+		Help:      "JIRA request latency by HTTP method and endpoint template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+	storeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "store",
+		Name:      "operation_duration_seconds",
+		Help:      "BoltDB store operation latency by operation.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(rpcRequests, rpcDuration, jiraRequests, jiraDuration, storeDuration)
+}
+
+// Handler returns HTTP handler exposing metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRPC records result and latency of RPC call
+func ObserveRPC(method string, started time.Time, err error) {
+	rpcRequests.WithLabelValues(method, ErrorCode(err)).Inc()
+	rpcDuration.WithLabelValues(method).Observe(time.Since(started).Seconds())
+}
+
+// ObserveJira records response status and latency of JIRA request, zero status means network error
+func ObserveJira(method, url string, status int, started time.Time) {
+	endpoint := Endpoint(url)
+	statusLabel := "error"
+	if status != 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+	jiraRequests.WithLabelValues(method, endpoint, statusLabel).Inc()
+	jiraDuration.WithLabelValues(method, endpoint).Observe(time.Since(started).Seconds())
+}
+
+// ObserveStore records latency of store operation
+func ObserveStore(operation string, started time.Time) {
+	storeDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+}
+
+// ErrorCode returns JSON RPC error code of err as label value
+func ErrorCode(err error) string {
+	if err == nil {
+		return "0"
+	}
+	if e, ok := err.(*jsonrpc2.Error); ok {
+		return strconv.Itoa(e.Code)
+	}
+	return "unknown"
+}
+
+var (
+	reIssueKey = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+	reNumber   = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// Endpoint converts JIRA resource path to template without IDs to keep labels cardinality low
+func Endpoint(url string) string {
+	path := url
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+		if i := strings.Index(path, "/"); i >= 0 {
+			path = path[i:]
+		} else {
+			path = "/"
+		}
+	}
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	if i := strings.Index(path, "/rest/"); i >= 0 {
+		path = path[i:]
+	}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		switch {
+		case i > 0 && parts[i-1] == "api":
+			// keep API version
+		case reNumber.MatchString(part):
+			parts[i] = "{id}"
+		case reIssueKey.MatchString(part):
+			parts[i] = "{key}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
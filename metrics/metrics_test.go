@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpoint(t *testing.T) {
+	a := assert.New(t)
+	tests := map[string]string{
+		"https://tracker.com/rest/api/2/issue/10000/worklog?startAt=0": "/rest/api/2/issue/{id}/worklog",
+		"https://tracker.com/jira/rest/api/2/issue/PRJ-12":             "/rest/api/2/issue/{key}",
+		"https://tracker.com/rest/api/2/search?jql=project%3D1":        "/rest/api/2/search",
+		"https://tracker.com/rest/api/2/myself":                        "/rest/api/2/myself",
+		"https://tracker.com":                                          "/",
+	}
+	for url, expected := range tests {
+		a.Equal(expected, Endpoint(url), url)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("0", ErrorCode(nil))
+	a.Equal("5", ErrorCode(entities.ErrServerUnavailable))
+	a.Equal("107", ErrorCode(entities.ErrIssueNotFound))
+	a.Equal("unknown", ErrorCode(errors.New("error")))
+}
@@ -0,0 +1,353 @@
+// Package outbox keeps reports which could not be delivered to unavailable trackers
+// and delivers them in background
+package outbox
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/qarea/ctxtg"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/store"
+	"github.com/qarea/jirams/tracing"
+)
+
+var log = redact.NewLog("outbox: ")
+
+const outboxBucket = store.OutboxBucket
+
+// Report delivery statuses
+const (
+	// StatusPending reports wait for the next delivery attempt
+	StatusPending = "pending"
+	// StatusDelivering reports are being sent to tracker right now
+	StatusDelivering = "delivering"
+	// StatusFailed reports were rejected by tracker and are retried only on request
+	StatusFailed = "failed"
+	// StatusUnknown reports were interrupted during delivery or failed after being sent
+	// and may be already created in tracker, they are retried only on request to avoid duplicates
+	StatusUnknown = "unknown"
+)
+
+// Errors returned for invalid operations
+var (
+	ErrDelivering = entities.NewServerError("Report delivery is in progress")
+)
+
+// Entry - queued report with data required to deliver it
+type Entry struct {
+	entities.PendingReport
+	UserID  ctxtg.UserID
+	Tracker entities.TrackerConfig
+	// Claimed is the time delivery has started
+	Claimed entities.Timestamp `json:",omitempty"`
+}
+
+// Queue keeps pending reports, implementations shared by several instances
+// must hand every due report to a single Claim call.
+// Claim skips reports of trackers for which ready returns false, nil ready accepts all trackers.
+type Queue interface {
+	Enqueue(userID ctxtg.UserID, tracker entities.TrackerConfig, report entities.Report, cause error) (entities.PendingReport, error)
+	List(userID ctxtg.UserID) ([]entities.PendingReport, error)
+	Retry(userID ctxtg.UserID, id uint64) error
+	Cancel(userID ctxtg.UserID, id uint64) error
+	Recover(ctx context.Context) error
+	Claim(ctx context.Context, ready func(entities.TrackerConfig) bool) ([]Entry, error)
+	Delivered(id uint64) error
+	Failed(id uint64, cause error, retryAfter time.Duration) error
+	Rejected(id uint64, cause error) error
+	Unknown(id uint64, cause error) error
+}
+
+// Outbox implements BoltDB backed queue of pending reports
+type Outbox struct {
+	DB *bolt.DB
+	// Keyring encrypts stored reports as they contain tracker credentials
+	Keyring *store.Keyring
+	now     func() time.Time
+}
+
+// New creates an instance of Outbox
+func New(db *bolt.DB) *Outbox {
+	res := &Outbox{DB: db, now: time.Now}
+	res.Init()
+	return res
+}
+
+// Init initializes BoltDB storage if needed
+func (outbox *Outbox) Init() {
+	_ = outbox.DB.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(outboxBucket)); err != nil {
+			log.Fatal("Failed to create outbox store")
+		}
+		return nil
+	})
+}
+
+// Recover marks reports left in delivery by previous run as unknown
+func (outbox *Outbox) Recover(ctx context.Context) error {
+	return outbox.update(func(entry *Entry) (bool, error) {
+		if entry.Status != StatusDelivering {
+			return false, nil
+		}
+		log.WARN("[%s] Report %d of user %d was interrupted during delivery", tracing.ID(ctx), entry.ID, entry.UserID)
+		entry.Status = StatusUnknown
+		return true, nil
+	})
+}
+
+// Enqueue stores report for delivery in background
+func (outbox *Outbox) Enqueue(userID ctxtg.UserID, tracker entities.TrackerConfig, report entities.Report, cause error) (res entities.PendingReport, err error) {
+	entry := newEntry(userID, tracker, report, cause, outbox.now())
+	err = outbox.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(outboxBucket))
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+		return outbox.put(bucket, &entry)
+	})
+	return entry.PendingReport, err
+}
+
+// List returns reports queued by the user
+func (outbox *Outbox) List(userID ctxtg.UserID) (res []entities.PendingReport, err error) {
+	res = make([]entities.PendingReport, 0)
+	err = outbox.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(outboxBucket)).ForEach(func(k, v []byte) error {
+			var entry Entry
+			if !outbox.decodeOrSkip(k, v, &entry) {
+				return nil
+			}
+			if entry.UserID == userID {
+				res = append(res, entry.PendingReport)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// Retry schedules immediate delivery of the user's report
+func (outbox *Outbox) Retry(userID ctxtg.UserID, id uint64) error {
+	return outbox.modify(userID, id, func(bucket *bolt.Bucket, entry *Entry) error {
+		entry.Status = StatusPending
+		entry.NextAttempt = entities.Timestamp(outbox.now().Unix())
+		return outbox.put(bucket, entry)
+	})
+}
+
+// Cancel removes the user's report from queue
+func (outbox *Outbox) Cancel(userID ctxtg.UserID, id uint64) error {
+	return outbox.modify(userID, id, func(bucket *bolt.Bucket, entry *Entry) error {
+		return bucket.Delete(itob(id))
+	})
+}
+
+// Claim returns pending reports due for delivery, marking them as being delivered
+func (outbox *Outbox) Claim(ctx context.Context, ready func(entities.TrackerConfig) bool) (res []Entry, err error) {
+	now := outbox.now()
+	err = outbox.update(func(entry *Entry) (bool, error) {
+		if (ready != nil && !ready(entry.Tracker)) || !entry.claim(now) {
+			return false, nil
+		}
+		res = append(res, *entry)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Delivered removes successfully delivered report
+func (outbox *Outbox) Delivered(id uint64) error {
+	return outbox.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(outboxBucket)).Delete(itob(id))
+	})
+}
+
+// Failed records delivery error, report is scheduled for another attempt after retryAfter
+func (outbox *Outbox) Failed(id uint64, cause error, retryAfter time.Duration) error {
+	return outbox.change(id, func(entry *Entry) {
+		entry.fail(cause, retryAfter, outbox.now())
+	})
+}
+
+// Rejected records delivery error, report is retried only on request
+func (outbox *Outbox) Rejected(id uint64, cause error) error {
+	return outbox.change(id, func(entry *Entry) {
+		entry.reject(cause)
+	})
+}
+
+// Unknown records delivery error after report was sent, it may be already created in tracker
+// so report is retried only on request
+func (outbox *Outbox) Unknown(id uint64, cause error) error {
+	return outbox.change(id, func(entry *Entry) {
+		entry.unknown(cause)
+	})
+}
+
+// change applies change to the report
+func (outbox *Outbox) change(id uint64, change func(*Entry)) error {
+	return outbox.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(outboxBucket))
+		entry, err := outbox.get(bucket, id)
+		if err != nil {
+			return err
+		}
+		change(entry)
+		return outbox.put(bucket, entry)
+	})
+}
+
+// modify applies change to the user's report unless it's being delivered right now
+func (outbox *Outbox) modify(userID ctxtg.UserID, id uint64, change func(*bolt.Bucket, *Entry) error) error {
+	return outbox.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(outboxBucket))
+		entry, err := outbox.get(bucket, id)
+		if err != nil {
+			return err
+		}
+		if entry.UserID != userID {
+			return entities.ErrNotFound
+		}
+		if entry.Status == StatusDelivering {
+			return ErrDelivering
+		}
+		return change(bucket, entry)
+	})
+}
+
+// update applies change to every entry, saving entries for which change returns true.
+// Entries which can't be decrypted are skipped.
+func (outbox *Outbox) update(change func(*Entry) (bool, error)) error {
+	return outbox.DB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(outboxBucket))
+		var changed []*Entry
+		err := bucket.ForEach(func(k, v []byte) error {
+			entry := &Entry{}
+			if !outbox.decodeOrSkip(k, v, entry) {
+				return nil
+			}
+			ok, err := change(entry)
+			if ok {
+				changed = append(changed, entry)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// bucket must not be modified during ForEach
+		for _, entry := range changed {
+			if err := outbox.put(bucket, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func newEntry(userID ctxtg.UserID, tracker entities.TrackerConfig, report entities.Report, cause error, now time.Time) Entry {
+	entry := Entry{
+		PendingReport: entities.PendingReport{
+			TrackerID:   tracker.ID,
+			Report:      report,
+			Status:      StatusPending,
+			NextAttempt: entities.Timestamp(now.Unix()),
+			Created:     entities.Timestamp(now.Unix()),
+		},
+		UserID:  userID,
+		Tracker: tracker,
+	}
+	if cause != nil {
+		entry.LastError = cause.Error()
+		entry.Attempts = 1
+	}
+	return entry
+}
+
+// claim marks pending report due for delivery as being delivered
+func (entry *Entry) claim(now time.Time) bool {
+	if entry.Status != StatusPending || entry.NextAttempt > entities.Timestamp(now.Unix()) {
+		return false
+	}
+	entry.Status = StatusDelivering
+	entry.Attempts++
+	entry.Claimed = entities.Timestamp(now.Unix())
+	return true
+}
+
+// fail records delivery error, rescheduling report after retryAfter
+func (entry *Entry) fail(cause error, retryAfter time.Duration, now time.Time) {
+	entry.LastError = cause.Error()
+	entry.Status = StatusPending
+	entry.NextAttempt = entities.Timestamp(now.Add(retryAfter).Unix())
+}
+
+// reject records delivery error, leaving report for manual retry
+func (entry *Entry) reject(cause error) {
+	entry.LastError = cause.Error()
+	entry.Status = StatusFailed
+}
+
+// unknown records delivery error, leaving report which may be already created for manual resolution
+func (entry *Entry) unknown(cause error) {
+	entry.LastError = cause.Error()
+	entry.Status = StatusUnknown
+}
+
+func (outbox *Outbox) get(bucket *bolt.Bucket, id uint64) (*Entry, error) {
+	data := bucket.Get(itob(id))
+	if data == nil {
+		return nil, entities.ErrNotFound
+	}
+	entry := &Entry{}
+	if err := outbox.decode(itob(id), data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (outbox *Outbox) put(bucket *bolt.Bucket, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data, err = outbox.Keyring.Seal(outboxBucket, itob(entry.ID), data)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(itob(entry.ID), data)
+}
+
+func (outbox *Outbox) decode(k, v []byte, entry *Entry) error {
+	data, err := outbox.Keyring.Open(outboxBucket, k, v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, entry)
+}
+
+// decodeOrSkip decodes entry, logging entries which can't be decoded so others are still served
+func (outbox *Outbox) decodeOrSkip(k, v []byte, entry *Entry) bool {
+	if err := outbox.decode(k, v, entry); err != nil {
+		log.ERR("Skipped report %x: %v", k, err)
+		return false
+	}
+	return true
+}
+
+// itob returns an 8-byte big endian representation of v.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,238 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/store"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testTracker = entities.TrackerConfig{ID: 1, URL: "https://tracker.com"}
+	testReport  = entities.Report{IssueID: 10, Started: 1482400800, Duration: 3600}
+)
+
+func newTestOutbox(t *testing.T) (*Outbox, *time.Time) {
+	dir, err := os.MkdirTemp("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "store.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+	now := time.Unix(1482400800, 0)
+	outbox := New(db)
+	outbox.now = func() time.Time { return now }
+	return outbox, &now
+}
+
+type testReporter struct {
+	err   error
+	calls int
+}
+
+func (r *testReporter) CreateReport(ctx context.Context, tracker entities.TrackerConfig, report entities.Report) error {
+	r.calls++
+	return r.err
+}
+
+func TestQueue(t *testing.T) {
+	a := assert.New(t)
+	outbox, _ := newTestOutbox(t)
+
+	pending, err := outbox.Enqueue(1, testTracker, testReport, entities.ErrServerUnavailable)
+	a.NoError(err)
+	a.Equal(uint64(1), pending.ID)
+	a.Equal(StatusPending, pending.Status)
+	_, err = outbox.Enqueue(2, testTracker, testReport, nil)
+	a.NoError(err)
+
+	reports, err := outbox.List(1)
+	a.NoError(err)
+	a.Equal([]entities.PendingReport{pending}, reports)
+
+	// reports of other users are not accessible
+	a.Equal(entities.ErrNotFound, outbox.Cancel(2, pending.ID))
+	a.Equal(entities.ErrNotFound, outbox.Retry(1, 100))
+
+	a.NoError(outbox.Cancel(1, pending.ID))
+	reports, err = outbox.List(1)
+	a.NoError(err)
+	a.Empty(reports)
+}
+
+func TestWorker(t *testing.T) {
+	a := assert.New(t)
+	outbox, now := newTestOutbox(t)
+	reporter := &testReporter{err: entities.ErrServerUnavailable}
+	worker := NewWorker(outbox, reporter, time.Second, time.Minute, 3*time.Minute)
+
+	pending, err := outbox.Enqueue(1, testTracker, testReport, entities.ErrServerUnavailable)
+	a.NoError(err)
+
+	worker.Deliver()
+	a.Equal(1, reporter.calls)
+	reports, _ := outbox.List(1)
+	a.Equal(StatusPending, reports[0].Status)
+	a.Equal(2, reports[0].Attempts)
+	a.Equal(entities.Timestamp(now.Add(2*time.Minute).Unix()), reports[0].NextAttempt)
+
+	// not due yet
+	worker.Deliver()
+	a.Equal(1, reporter.calls)
+
+	// rejected reports wait for manual retry
+	*now = now.Add(2 * time.Minute)
+	reporter.err = errors.New("invalid worklog")
+	worker.Deliver()
+	a.Equal(2, reporter.calls)
+	reports, _ = outbox.List(1)
+	a.Equal(StatusFailed, reports[0].Status)
+	a.Equal("invalid worklog", reports[0].LastError)
+	worker.Deliver()
+	a.Equal(2, reporter.calls)
+
+	reporter.err = nil
+	a.NoError(outbox.Retry(1, pending.ID))
+	worker.Deliver()
+	a.Equal(3, reporter.calls)
+	reports, _ = outbox.List(1)
+	a.Empty(reports)
+}
+
+type testMaintenance map[entities.TrackerID]bool
+
+func (m testMaintenance) Check(tracker entities.TrackerConfig) error {
+	if m[tracker.ID] {
+		return entities.NewMaintenanceError(0)
+	}
+	return nil
+}
+
+func TestWorkerUnknown(t *testing.T) {
+	a := assert.New(t)
+	outbox, _ := newTestOutbox(t)
+	reporter := &testReporter{err: entities.ErrServerFailed}
+	worker := NewWorker(outbox, reporter, time.Second, time.Minute, 3*time.Minute)
+	_, err := outbox.Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+
+	worker.Deliver()
+	a.Equal(1, reporter.calls)
+	reports, _ := outbox.List(1)
+	a.Equal(StatusUnknown, reports[0].Status, "report may be created, it must not be retried automatically")
+	worker.Deliver()
+	a.Equal(1, reporter.calls)
+}
+
+func TestWorkerMaintenance(t *testing.T) {
+	a := assert.New(t)
+	outbox, _ := newTestOutbox(t)
+	reporter := &testReporter{}
+	maintenance := testMaintenance{testTracker.ID: true}
+	worker := NewWorker(outbox, reporter, time.Second, time.Minute, 3*time.Minute)
+	worker.Maintenance = maintenance
+	_, err := outbox.Enqueue(1, testTracker, testReport, entities.ErrServerUnavailable)
+	a.NoError(err)
+
+	worker.Deliver()
+	a.Equal(0, reporter.calls)
+	reports, _ := outbox.List(1)
+	a.Equal(StatusPending, reports[0].Status)
+	a.Equal(1, reports[0].Attempts)
+
+	delete(maintenance, testTracker.ID)
+	worker.Deliver()
+	a.Equal(1, reporter.calls)
+	reports, _ = outbox.List(1)
+	a.Empty(reports)
+}
+
+func TestRecover(t *testing.T) {
+	a := assert.New(t)
+	outbox, _ := newTestOutbox(t)
+	pending, err := outbox.Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+
+	claimed, err := outbox.Claim(context.Background(), nil)
+	a.NoError(err)
+	a.Len(claimed, 1)
+	a.Equal(ErrDelivering, outbox.Cancel(1, pending.ID))
+
+	// interrupted delivery is not repeated automatically
+	a.NoError(outbox.Recover(context.Background()))
+	claimed, err = outbox.Claim(context.Background(), nil)
+	a.NoError(err)
+	a.Empty(claimed)
+	reports, _ := outbox.List(1)
+	a.Equal(StatusUnknown, reports[0].Status)
+}
+
+func TestBackoff(t *testing.T) {
+	worker := &Worker{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, worker.backoff(1))
+	assert.Equal(t, 4*time.Second, worker.backoff(3))
+	assert.Equal(t, 5*time.Second, worker.backoff(10))
+}
+
+func TestEncrypted(t *testing.T) {
+	a := assert.New(t)
+	outbox, _ := newTestOutbox(t)
+	tracker := testTracker
+	tracker.Credentials.Password = "secret"
+	plain, err := outbox.Enqueue(1, tracker, testReport, nil)
+	a.NoError(err)
+
+	keyring, err := store.ParseKeyring([]byte("k1 MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=\n"), "k1")
+	a.NoError(err)
+	outbox.Keyring = keyring
+	pending, err := outbox.Enqueue(1, tracker, testReport, nil)
+	a.NoError(err)
+	a.NoError(outbox.DB.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(outboxBucket)).Get(itob(pending.ID))
+		a.NotContains(string(data), "secret")
+		return nil
+	}))
+
+	// reports stored before encryption was enabled are still delivered
+	claimed, err := outbox.Claim(context.Background(), nil)
+	a.NoError(err)
+	a.Len(claimed, 2)
+	a.Equal(plain.ID, claimed[0].ID)
+	a.Equal("secret", claimed[0].Tracker.Credentials.Password)
+	a.Equal("secret", claimed[1].Tracker.Credentials.Password)
+}
+
+func TestUndecryptableSkipped(t *testing.T) {
+	a := assert.New(t)
+	outbox, _ := newTestOutbox(t)
+	keyring, err := store.ParseKeyring([]byte("k1 MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=\n"), "k1")
+	a.NoError(err)
+	outbox.Keyring = keyring
+	_, err = outbox.Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+
+	outbox.Keyring = nil
+	plain, err := outbox.Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+	reports, err := outbox.List(1)
+	a.NoError(err)
+	a.Equal([]entities.PendingReport{plain}, reports)
+	claimed, err := outbox.Claim(context.Background(), nil)
+	a.NoError(err)
+	if a.Len(claimed, 1) {
+		a.Equal(plain.ID, claimed[0].ID)
+	}
+}
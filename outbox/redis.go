@@ -0,0 +1,331 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/qarea/ctxtg"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/store"
+	"github.com/qarea/jirams/tracing"
+)
+
+const (
+	defaultLease = 10 * time.Minute
+	maxConflicts = 10
+)
+
+var (
+	errSkip      = errors.New("skip")
+	errConflicts = errors.New("too many concurrent changes")
+)
+
+// compareAndSet replaces field ARGV[1] of hash KEYS[1] with ARGV[3] or deletes it when ARGV[3] is empty,
+// only if its current value is ARGV[2]
+var compareAndSet = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+if ARGV[3] == '' then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+end
+return 1
+`)
+
+// Redis implements queue of pending reports shared by several adapter instances.
+// Reports are kept in a single hash and changed with compare-and-set,
+// so every due report is claimed by a single instance.
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+	// Lease defines how long claimed report may be delivered before it's considered interrupted
+	Lease time.Duration
+	// Keyring encrypts stored reports as they contain tracker credentials
+	Keyring *store.Keyring
+
+	now func() time.Time
+}
+
+// NewRedis creates an instance of Redis keeping reports under given key prefix
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{
+		Client: client,
+		Prefix: prefix + "outbox:",
+		Lease:  defaultLease,
+		now:    time.Now,
+	}
+}
+
+// Enqueue stores report for delivery in background
+func (queue *Redis) Enqueue(userID ctxtg.UserID, tracker entities.TrackerConfig, report entities.Report, cause error) (entities.PendingReport, error) {
+	entry := newEntry(userID, tracker, report, cause, queue.now())
+	id, err := queue.Client.Incr(queue.Prefix + "sequence").Result()
+	if err != nil {
+		return entry.PendingReport, err
+	}
+	entry.ID = uint64(id)
+	field := strconv.FormatUint(entry.ID, 10)
+	data, err := queue.encode(field, &entry)
+	if err != nil {
+		return entry.PendingReport, err
+	}
+	return entry.PendingReport, queue.Client.HSet(queue.reports(), field, data).Err()
+}
+
+// List returns reports queued by the user
+func (queue *Redis) List(userID ctxtg.UserID) ([]entities.PendingReport, error) {
+	entries, err := queue.all()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]entities.PendingReport, 0)
+	for _, entry := range entries {
+		if entry.UserID == userID {
+			res = append(res, entry.PendingReport)
+		}
+	}
+	return res, nil
+}
+
+// Retry schedules immediate delivery of the user's report
+func (queue *Redis) Retry(userID ctxtg.UserID, id uint64) error {
+	return queue.modify(userID, id, func(entry *Entry) *Entry {
+		entry.Status = StatusPending
+		entry.NextAttempt = entities.Timestamp(queue.now().Unix())
+		return entry
+	})
+}
+
+// Cancel removes the user's report from queue
+func (queue *Redis) Cancel(userID ctxtg.UserID, id uint64) error {
+	return queue.modify(userID, id, func(entry *Entry) *Entry {
+		return nil
+	})
+}
+
+// Recover marks reports claimed longer than Lease ago as unknown,
+// reports being delivered by other running instances are not affected
+func (queue *Redis) Recover(ctx context.Context) error {
+	entries, err := queue.all()
+	if err != nil {
+		return err
+	}
+	expired := entities.Timestamp(queue.now().Add(-queue.Lease).Unix())
+	for _, entry := range entries {
+		if entry.Status != StatusDelivering || entry.Claimed > expired {
+			continue
+		}
+		err := queue.update(entry.ID, func(entry *Entry) (*Entry, error) {
+			if entry.Status != StatusDelivering || entry.Claimed > expired {
+				return nil, errSkip
+			}
+			entry.Status = StatusUnknown
+			return entry, nil
+		})
+		switch err {
+		case nil:
+			log.WARN("[%s] Report %d of user %d was interrupted during delivery", tracing.ID(ctx), entry.ID, entry.UserID)
+		case errSkip, entities.ErrNotFound:
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Claim returns pending reports due for delivery, marking them as being delivered,
+// reports with expired lease are recovered first
+func (queue *Redis) Claim(ctx context.Context, ready func(entities.TrackerConfig) bool) (res []Entry, err error) {
+	if err := queue.Recover(ctx); err != nil {
+		return nil, err
+	}
+	entries, err := queue.all()
+	if err != nil {
+		return nil, err
+	}
+	now := queue.now()
+	for _, entry := range entries {
+		if entry.Status != StatusPending || (ready != nil && !ready(entry.Tracker)) {
+			continue
+		}
+		var claimed Entry
+		err := queue.update(entry.ID, func(entry *Entry) (*Entry, error) {
+			if !entry.claim(now) {
+				return nil, errSkip
+			}
+			claimed = *entry
+			return entry, nil
+		})
+		switch err {
+		case nil:
+			res = append(res, claimed)
+		case errSkip, entities.ErrNotFound:
+		default:
+			// already claimed reports must be delivered anyway
+			log.ERR("[%s] Failed to claim report %d: %v", tracing.ID(ctx), entry.ID, err)
+			return res, nil
+		}
+	}
+	return res, nil
+}
+
+// Delivered removes successfully delivered report
+func (queue *Redis) Delivered(id uint64) error {
+	return queue.Client.HDel(queue.reports(), strconv.FormatUint(id, 10)).Err()
+}
+
+// Failed records delivery error, report is scheduled for another attempt after retryAfter
+func (queue *Redis) Failed(id uint64, cause error, retryAfter time.Duration) error {
+	return queue.update(id, func(entry *Entry) (*Entry, error) {
+		entry.fail(cause, retryAfter, queue.now())
+		return entry, nil
+	})
+}
+
+// Rejected records delivery error, report is retried only on request
+func (queue *Redis) Rejected(id uint64, cause error) error {
+	return queue.update(id, func(entry *Entry) (*Entry, error) {
+		entry.reject(cause)
+		return entry, nil
+	})
+}
+
+// Unknown records delivery error after report was sent, it may be already created in tracker
+// so report is retried only on request
+func (queue *Redis) Unknown(id uint64, cause error) error {
+	return queue.update(id, func(entry *Entry) (*Entry, error) {
+		entry.unknown(cause)
+		return entry, nil
+	})
+}
+
+// modify applies change to the user's report unless it's being delivered right now,
+// nil returned by change removes the report
+func (queue *Redis) modify(userID ctxtg.UserID, id uint64, change func(*Entry) *Entry) error {
+	return queue.update(id, func(entry *Entry) (*Entry, error) {
+		if entry.UserID != userID {
+			return nil, entities.ErrNotFound
+		}
+		if entry.Status == StatusDelivering {
+			return nil, ErrDelivering
+		}
+		return change(entry), nil
+	})
+}
+
+// update applies change to the report, retrying when it was modified concurrently.
+// nil returned by change removes the report.
+func (queue *Redis) update(id uint64, change func(*Entry) (*Entry, error)) error {
+	field := strconv.FormatUint(id, 10)
+	for i := 0; i < maxConflicts; i++ {
+		old, err := queue.Client.HGet(queue.reports(), field).Result()
+		if err == redis.Nil {
+			return entities.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		entry := &Entry{}
+		if err := queue.decode(field, old, entry); err != nil {
+			return err
+		}
+		entry, err = change(entry)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if entry != nil {
+			if data, err = queue.encode(field, entry); err != nil {
+				return err
+			}
+		}
+		ok, err := compareAndSet.Run(queue.Client, []string{queue.reports()}, field, old, data).Int64()
+		if err != nil {
+			return err
+		}
+		if ok == 1 {
+			return nil
+		}
+	}
+	return errConflicts
+}
+
+// Rotate re-encrypts reports not encrypted with current key, without current key it decrypts them.
+// Reports are changed with compare-and-set, so it's safe to rotate while service is running.
+// Returns amount of changed reports.
+func (queue *Redis) Rotate() (count int, err error) {
+	values, err := queue.Client.HGetAll(queue.reports()).Result()
+	if err != nil {
+		return 0, err
+	}
+	current := ""
+	if queue.Keyring != nil {
+		current = queue.Keyring.Current
+	}
+	for field, data := range values {
+		if id, _ := store.KeyID([]byte(data)); id == current {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return count, fmt.Errorf("report %q: invalid ID", field)
+		}
+		// update stores report encrypted with current key
+		err = queue.update(id, func(entry *Entry) (*Entry, error) { return entry, nil })
+		switch err {
+		case nil:
+			count++
+		case entities.ErrNotFound:
+		default:
+			return count, fmt.Errorf("report %d: %v", id, err)
+		}
+	}
+	return count, nil
+}
+
+// all returns all reports ordered by ID, reports which can't be decrypted are skipped
+func (queue *Redis) all() ([]Entry, error) {
+	values, err := queue.Client.HGetAll(queue.reports()).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(values))
+	for field, data := range values {
+		var entry Entry
+		if err := queue.decode(field, data, &entry); err != nil {
+			log.ERR("Skipped report %s: %v", field, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+func (queue *Redis) encode(field string, entry *Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return queue.Keyring.Seal(store.OutboxBucket, []byte(field), data)
+}
+
+func (queue *Redis) decode(field, value string, entry *Entry) error {
+	data, err := queue.Keyring.Open(store.OutboxBucket, []byte(field), []byte(value))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, entry)
+}
+
+func (queue *Redis) reports() string {
+	return queue.Prefix + "reports"
+}
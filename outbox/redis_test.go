@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedis(t *testing.T, instances int) ([]*Redis, *time.Time) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	now := time.Unix(1482400800, 0)
+	var res []*Redis
+	for i := 0; i < instances; i++ {
+		queue := NewRedis(client, "jirams:")
+		queue.now = func() time.Time { return now }
+		res = append(res, queue)
+	}
+	return res, &now
+}
+
+func TestRedisQueue(t *testing.T) {
+	a := assert.New(t)
+	queues, _ := newTestRedis(t, 2)
+
+	pending, err := queues[0].Enqueue(1, testTracker, testReport, entities.ErrServerUnavailable)
+	a.NoError(err)
+	a.Equal(uint64(1), pending.ID)
+	a.Equal(StatusPending, pending.Status)
+	second, err := queues[1].Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+	a.Equal(uint64(2), second.ID)
+
+	reports, err := queues[1].List(1)
+	a.NoError(err)
+	a.Equal([]entities.PendingReport{pending, second}, reports)
+	reports, err = queues[1].List(2)
+	a.NoError(err)
+	a.Empty(reports)
+
+	a.Equal(entities.ErrNotFound, queues[0].Cancel(2, pending.ID))
+	a.Equal(entities.ErrNotFound, queues[0].Retry(1, 100))
+	a.NoError(queues[1].Cancel(1, second.ID))
+	reports, _ = queues[0].List(1)
+	a.Equal([]entities.PendingReport{pending}, reports)
+}
+
+func TestRedisWorkers(t *testing.T) {
+	a := assert.New(t)
+	queues, now := newTestRedis(t, 2)
+	reporter := &testReporter{err: entities.ErrServerUnavailable}
+	workers := []*Worker{
+		NewWorker(queues[0], reporter, time.Second, time.Minute, 3*time.Minute),
+		NewWorker(queues[1], reporter, time.Second, time.Minute, 3*time.Minute),
+	}
+	pending, err := queues[0].Enqueue(1, testTracker, testReport, entities.ErrServerUnavailable)
+	a.NoError(err)
+
+	// due report is delivered by a single instance
+	workers[0].Deliver()
+	workers[1].Deliver()
+	a.Equal(1, reporter.calls)
+	reports, _ := queues[1].List(1)
+	a.Equal(StatusPending, reports[0].Status)
+	a.Equal(2, reports[0].Attempts)
+	a.Equal(entities.Timestamp(now.Add(2*time.Minute).Unix()), reports[0].NextAttempt)
+
+	*now = now.Add(2 * time.Minute)
+	reporter.err = errors.New("invalid worklog")
+	workers[1].Deliver()
+	workers[0].Deliver()
+	a.Equal(2, reporter.calls)
+	reports, _ = queues[0].List(1)
+	a.Equal(StatusFailed, reports[0].Status)
+	a.Equal("invalid worklog", reports[0].LastError)
+
+	reporter.err = nil
+	a.NoError(queues[0].Retry(1, pending.ID))
+	workers[1].Deliver()
+	workers[0].Deliver()
+	a.Equal(3, reporter.calls)
+	reports, _ = queues[0].List(1)
+	a.Empty(reports)
+}
+
+func TestRedisRecover(t *testing.T) {
+	a := assert.New(t)
+	queues, now := newTestRedis(t, 2)
+	pending, err := queues[0].Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+
+	claimed, err := queues[0].Claim(context.Background(), nil)
+	a.NoError(err)
+	a.Len(claimed, 1)
+	a.Equal(ErrDelivering, queues[1].Cancel(1, pending.ID))
+
+	// delivery by running instance is not interrupted
+	a.NoError(queues[1].Recover(context.Background()))
+	reports, _ := queues[1].List(1)
+	a.Equal(StatusDelivering, reports[0].Status)
+
+	// delivery is considered interrupted after lease and is not repeated automatically
+	*now = now.Add(defaultLease)
+	claimed, err = queues[1].Claim(context.Background(), nil)
+	a.NoError(err)
+	a.Empty(claimed)
+	reports, _ = queues[1].List(1)
+	a.Equal(StatusUnknown, reports[0].Status)
+}
+
+func TestRedisRotate(t *testing.T) {
+	a := assert.New(t)
+	queues, _ := newTestRedis(t, 1)
+	queue := queues[0]
+	k1, k2 := "k1 MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE=\n", "k2 YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY=\n"
+	queue.Keyring, _ = store.ParseKeyring([]byte(k1), "k1")
+	first, err := queue.Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+
+	// report which can't be decrypted doesn't block others
+	queue.Keyring, _ = store.ParseKeyring([]byte(k2), "k2")
+	second, err := queue.Enqueue(1, testTracker, testReport, nil)
+	a.NoError(err)
+	reports, err := queue.List(1)
+	a.NoError(err)
+	a.Equal([]entities.PendingReport{second}, reports)
+	_, err = queue.Rotate()
+	a.Error(err, "report encrypted with unknown key")
+
+	queue.Keyring, _ = store.ParseKeyring([]byte(k1+k2), "k2")
+	count, err := queue.Rotate()
+	a.NoError(err)
+	a.Equal(1, count)
+	queue.Keyring, _ = store.ParseKeyring([]byte(k2), "k2")
+	reports, err = queue.List(1)
+	a.NoError(err)
+	a.Equal([]entities.PendingReport{first, second}, reports, "k1 may be retired after rotation")
+}
@@ -0,0 +1,115 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/tracing"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+// Reporter delivers reports to tracker
+type Reporter interface {
+	CreateReport(ctx context.Context, tracker entities.TrackerConfig, report entities.Report) error
+}
+
+// MaintenanceChecker reports whether tracker is under maintenance
+type MaintenanceChecker interface {
+	Check(tracker entities.TrackerConfig) error
+}
+
+// Worker delivers pending reports with exponential backoff between attempts.
+// Reports which may have reached tracker are left for manual resolution instead of being retried.
+type Worker struct {
+	Outbox   Queue
+	Client   Reporter
+	Interval time.Duration
+	// Maintenance holds reports of trackers under maintenance in queue when set
+	Maintenance MaintenanceChecker
+	// MinBackoff is delay after the first failed attempt, it doubles after each next one up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewWorker creates Worker checking outbox every interval
+func NewWorker(outbox Queue, client Reporter, interval, minBackoff, maxBackoff time.Duration) *Worker {
+	return &Worker{
+		Outbox:     outbox,
+		Client:     client,
+		Interval:   interval,
+		MinBackoff: minBackoff,
+		MaxBackoff: maxBackoff,
+	}
+}
+
+// Run delivers reports until stop is closed
+func (worker *Worker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(worker.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			worker.Deliver()
+		}
+	}
+}
+
+// Deliver makes single delivery attempt for every due report
+func (worker *Worker) Deliver() {
+	ctx := traceid.New(context.Background())
+	entries, err := worker.Outbox.Claim(ctx, worker.ready)
+	if err != nil {
+		log.ERR("[%s] Failed to read outbox: %v", tracing.ID(ctx), err)
+		return
+	}
+	for _, entry := range entries {
+		worker.deliver(traceid.New(context.Background()), entry)
+	}
+}
+
+func (worker *Worker) deliver(ctx context.Context, entry Entry) {
+	ctx, span := tracing.Start(ctx, "Outbox.CreateReport")
+	err := worker.Client.CreateReport(ctx, entry.Tracker, entry.Report)
+	tracing.End(span, err)
+	if err == nil {
+		log.INFO("[%s] Report %d of user %d delivered after %d attempts", tracing.ID(ctx), entry.ID, entry.UserID, entry.Attempts)
+		if err := worker.Outbox.Delivered(entry.ID); err != nil {
+			log.ERR("[%s] Failed to remove delivered report %d: %v", tracing.ID(ctx), entry.ID, err)
+		}
+		return
+	}
+	switch {
+	case entities.IsUnavailable(err):
+		retryAfter := worker.backoff(entry.Attempts)
+		log.WARN("[%s] Report %d of user %d not delivered, retry in %v: %v", tracing.ID(ctx), entry.ID, entry.UserID, retryAfter, err)
+		err = worker.Outbox.Failed(entry.ID, err, retryAfter)
+	case entities.IsFailure(err):
+		log.ERR("[%s] Report %d of user %d may be delivered, it's left for manual resolution: %v", tracing.ID(ctx), entry.ID, entry.UserID, err)
+		err = worker.Outbox.Unknown(entry.ID, err)
+	default:
+		log.ERR("[%s] Report %d of user %d rejected: %v", tracing.ID(ctx), entry.ID, entry.UserID, err)
+		err = worker.Outbox.Rejected(entry.ID, err)
+	}
+	if err != nil {
+		log.ERR("[%s] Failed to update report %d: %v", tracing.ID(ctx), entry.ID, err)
+	}
+}
+
+// ready reports whether reports of tracker may be delivered now
+func (worker *Worker) ready(tracker entities.TrackerConfig) bool {
+	return worker.Maintenance == nil || worker.Maintenance.Check(tracker) == nil
+}
+
+func (worker *Worker) backoff(attempts int) time.Duration {
+	delay := worker.MinBackoff
+	for i := 1; i < attempts && delay < worker.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > worker.MaxBackoff {
+		delay = worker.MaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,103 @@
+// Package ratelimit provides keyed token bucket rate limiters
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+// Limiter keeps separate token bucket for every key
+type Limiter struct {
+	// Rate is amount of requests allowed per second, zero disables limiting
+	Rate float64
+	// Burst is maximum amount of requests allowed at once
+	Burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates Limiter allowing perSecond requests with given burst for each key
+func New(perSecond float64, burst int) *Limiter {
+	return &Limiter{
+		Rate:    perSecond,
+		Burst:   burst,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket, returning false and time to wait when bucket is empty
+func (limiter *Limiter) Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration) {
+	if limiter.Rate <= 0 {
+		return true, 0
+	}
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	now := limiter.now()
+	limiter.sweep(now)
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limiter.Burst), ts: now}
+		limiter.buckets[key] = b
+	}
+	b.refill(now, limiter.Rate, limiter.Burst)
+	if b.tokens < 1 {
+		return false, time.Duration(math.Ceil((1 - b.tokens) * float64(time.Second) / limiter.Rate))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Refund puts back a token taken by allowed request of key,
+// it is used when the request was rejected by another limit and did not run
+func (limiter *Limiter) Refund(ctx context.Context, key string) {
+	if limiter.Rate <= 0 {
+		return
+	}
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if b, ok := limiter.buckets[key]; ok {
+		b.refill(limiter.now(), limiter.Rate, limiter.Burst)
+		b.tokens = math.Min(float64(limiter.Burst), b.tokens+1)
+	}
+}
+
+// Len returns amount of tracked keys
+func (limiter *Limiter) Len() int {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	return len(limiter.buckets)
+}
+
+// sweep forgets keys with full buckets as they behave the same as new ones
+func (limiter *Limiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+	for key, b := range limiter.buckets {
+		if b.refill(now, limiter.Rate, limiter.Burst); b.tokens >= float64(limiter.Burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// bucket holds tokens left at ts, it is refilled the same way as buckets stored in Redis
+type bucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+func (b *bucket) refill(now time.Time, rate float64, burst int) {
+	if now.After(b.ts) {
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.ts).Seconds()*rate)
+		b.ts = now
+	}
+}
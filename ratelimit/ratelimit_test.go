@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	limiter := New(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow(ctx, "user:1")
+		a.True(ok)
+	}
+	ok, retryAfter := limiter.Allow(ctx, "user:1")
+	a.False(ok)
+	a.Equal(500*time.Millisecond, retryAfter)
+
+	// other keys are not affected
+	ok, _ = limiter.Allow(ctx, "user:2")
+	a.True(ok)
+
+	// denied requests do not consume tokens
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow(ctx, "user:1")
+	a.True(ok)
+	ok, _ = limiter.Allow(ctx, "user:1")
+	a.False(ok)
+}
+
+func TestRefund(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	limiter := New(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Refund(ctx, "user:1")
+	for i := 0; i < 2; i++ {
+		ok, _ := limiter.Allow(ctx, "user:1")
+		a.True(ok)
+	}
+	limiter.Refund(ctx, "user:1")
+	ok, _ := limiter.Allow(ctx, "user:1")
+	a.True(ok, "refunded token should be available")
+	ok, _ = limiter.Allow(ctx, "user:1")
+	a.False(ok)
+
+	// burst is not exceeded
+	limiter.Refund(ctx, "user:2")
+	for i := 0; i < 2; i++ {
+		ok, _ = limiter.Allow(ctx, "user:2")
+		a.True(ok)
+	}
+	limiter.Refund(ctx, "user:2")
+	limiter.Refund(ctx, "user:2")
+	limiter.Refund(ctx, "user:2")
+	for i := 0; i < 2; i++ {
+		ok, _ = limiter.Allow(ctx, "user:2")
+		a.True(ok)
+	}
+	ok, _ = limiter.Allow(ctx, "user:2")
+	a.False(ok)
+}
+
+func TestAllowDisabled(t *testing.T) {
+	ctx := context.Background()
+	limiter := New(0, 0)
+	for i := 0; i < 100; i++ {
+		ok, _ := limiter.Allow(ctx, "tracker:1")
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 0, limiter.Len())
+}
+
+func TestSweep(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	limiter := New(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow(ctx, "user:1")
+	limiter.Allow(ctx, "user:2")
+	a.Equal(2, limiter.Len())
+
+	now = now.Add(sweepInterval)
+	limiter.Allow(ctx, "user:3")
+	a.Equal(1, limiter.Len())
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing"
+)
+
+var log = redact.NewLog("ratelimit: ")
+
+// takeToken refills bucket stored in hash KEYS[1] up to burst ARGV[2] at rate ARGV[1] per second
+// since its last update, takes a token if available and returns milliseconds to wait otherwise.
+// Time ARGV[3] in milliseconds comes from caller, instances are expected to have synchronized clocks.
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	ts = now
+end
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`)
+
+// returnToken puts a token back to bucket stored in hash KEYS[1] without exceeding burst ARGV[1]
+var returnToken = redis.NewScript(`
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+if tokens ~= nil then
+	redis.call('HSET', KEYS[1], 'tokens', tostring(math.min(tonumber(ARGV[1]), tokens + 1)))
+end
+return 0
+`)
+
+// Redis keeps token buckets in Redis so several adapter instances share limits
+type Redis struct {
+	Client *redis.Client
+	Prefix string
+	// Rate is amount of requests allowed per second, zero disables limiting
+	Rate float64
+	// Burst is maximum amount of requests allowed at once
+	Burst int
+
+	now func() time.Time
+}
+
+// NewRedis creates limiter allowing perSecond requests with given burst for each key,
+// buckets are stored in Redis under given key prefix
+func NewRedis(client *redis.Client, prefix string, perSecond float64, burst int) *Redis {
+	return &Redis{
+		Client: client,
+		Prefix: prefix + "ratelimit:",
+		Rate:   perSecond,
+		Burst:  burst,
+		now:    time.Now,
+	}
+}
+
+// Allow takes a token from key's bucket, returning false and time to wait when bucket is empty.
+// Requests are allowed while Redis is unavailable.
+func (limiter *Redis) Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration) {
+	if limiter.Rate <= 0 {
+		return true, 0
+	}
+	now := limiter.now().UnixNano() / int64(time.Millisecond)
+	wait, err := takeToken.Run(limiter.Client, []string{limiter.Prefix + key}, limiter.Rate, limiter.Burst, now).Int64()
+	if err != nil {
+		log.ERR("[%s] Failed to check limit of %s: %v", tracing.ID(ctx), key, err)
+		return true, 0
+	}
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Millisecond
+	}
+	return true, 0
+}
+
+// Refund puts back a token taken by allowed request of key,
+// it is used when the request was rejected by another limit and did not run
+func (limiter *Redis) Refund(ctx context.Context, key string) {
+	if limiter.Rate <= 0 {
+		return
+	}
+	if err := returnToken.Run(limiter.Client, []string{limiter.Prefix + key}, limiter.Burst).Err(); err != nil {
+		log.ERR("[%s] Failed to refund limit of %s: %v", tracing.ID(ctx), key, err)
+	}
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisAllow(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	now := time.Unix(1000, 0)
+	instances := []*Redis{NewRedis(client, "jirams:", 2, 3), NewRedis(client, "jirams:", 2, 3)}
+	for _, limiter := range instances {
+		limiter.now = func() time.Time { return now }
+	}
+
+	// instances share buckets
+	for i := 0; i < 3; i++ {
+		ok, _ := instances[i%2].Allow(ctx, "user:1")
+		a.True(ok)
+	}
+	ok, retryAfter := instances[1].Allow(ctx, "user:1")
+	a.False(ok)
+	a.Equal(500*time.Millisecond, retryAfter)
+
+	// other keys are not affected
+	ok, _ = instances[0].Allow(ctx, "user:2")
+	a.True(ok)
+
+	// denied requests do not consume tokens
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = instances[0].Allow(ctx, "user:1")
+	a.True(ok)
+	ok, _ = instances[1].Allow(ctx, "user:1")
+	a.False(ok)
+
+	// refunded token is available and burst is not exceeded
+	instances[0].Refund(ctx, "user:1")
+	ok, _ = instances[1].Allow(ctx, "user:1")
+	a.True(ok)
+	instances[0].Refund(ctx, "user:2")
+	instances[0].Refund(ctx, "user:2")
+	for i := 0; i < 3; i++ {
+		ok, _ = instances[i%2].Allow(ctx, "user:2")
+		a.True(ok)
+	}
+	ok, _ = instances[0].Allow(ctx, "user:2")
+	a.False(ok)
+
+	// requests are allowed while Redis is unavailable
+	server.Close()
+	ok, _ = instances[0].Allow(ctx, "user:1")
+	a.True(ok)
+}
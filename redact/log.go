@@ -0,0 +1,52 @@
+package redact
+
+import (
+	"fmt"
+
+	"github.com/powerman/narada-go/narada"
+)
+
+// Log wraps narada log redacting every message
+type Log struct {
+	log *narada.Log
+}
+
+// NewLog creates redacting log with given prefix
+func NewLog(prefix string) *Log {
+	return &Log{log: narada.NewLog(prefix)}
+}
+
+// ERR logs redacted message with ERR level
+func (l *Log) ERR(format string, v ...interface{}) {
+	l.log.ERR("%s", Sprintf(format, v...))
+}
+
+// WARN logs redacted message with WARN level
+func (l *Log) WARN(format string, v ...interface{}) {
+	l.log.WARN("%s", Sprintf(format, v...))
+}
+
+// NOTICE logs redacted message with NOTICE level
+func (l *Log) NOTICE(format string, v ...interface{}) {
+	l.log.NOTICE("%s", Sprintf(format, v...))
+}
+
+// INFO logs redacted message with INFO level
+func (l *Log) INFO(format string, v ...interface{}) {
+	l.log.INFO("%s", Sprintf(format, v...))
+}
+
+// DEBUG logs redacted message with DEBUG level
+func (l *Log) DEBUG(format string, v ...interface{}) {
+	l.log.DEBUG("%s", Sprintf(format, v...))
+}
+
+// Fatal logs redacted message and exits
+func (l *Log) Fatal(v ...interface{}) {
+	l.log.Fatal(String(fmt.Sprint(v...)))
+}
+
+// Fatalf logs redacted message and exits
+func (l *Log) Fatalf(format string, v ...interface{}) {
+	l.log.Fatal(Sprintf(format, v...))
+}
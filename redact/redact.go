@@ -0,0 +1,79 @@
+// Package redact scrubs credentials and personal data from log messages and debug dumps
+package redact
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+)
+
+// Placeholders replacing scrubbed data
+const (
+	Mask  = "[REDACTED]"
+	Email = "[EMAIL]"
+)
+
+// maxDumpSize limits size of request and response dumps
+const maxDumpSize = 4096
+
+// secretName matches names of fields and parameters holding secrets
+const secretName = `[\w-]*(?:password|passwd|pwd|secret|token|api[_-]?key|apikey|signature|session|jwt)[\w-]*`
+
+var rules = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// header lines of dumps
+	{regexp.MustCompile(`(?im)^((?:proxy-)?authorization|cookie|set-cookie):[^\r\n]*`), "$1: " + Mask},
+	// credentials in Authorization header values printed anywhere
+	{regexp.MustCompile(`(?i)\b(basic|bearer)(\s+)[\w+/=.~-]{6,}`), "$1$2" + Mask},
+	// user and password in URLs
+	{regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*://)[^/\s:@]+:[^/\s@]*@`), "$1" + Mask + "@"},
+	// JSON fields
+	{regexp.MustCompile(`(?i)("` + secretName + `"\s*:\s*)"(?:[^"\\]|\\.)*"`), `$1"` + Mask + `"`},
+	// query and form parameters, JQL may contain user names
+	{regexp.MustCompile(`(?i)\b(` + secretName + `|jql)=[^&\s"']+`), "$1=" + Mask},
+	// Go structs printed with %+v
+	{regexp.MustCompile(`(?i)\b(` + secretName + `):[^\s,}\]"]+`), "$1:" + Mask},
+	// emails, also URL encoded ones
+	{regexp.MustCompile(`[\w.+-]+(?:@|%40)[\w-]+(?:\.[\w-]+)*\.[a-zA-Z]{2,}`), Email},
+}
+
+// String returns s with credentials and emails replaced by placeholders
+func String(s string) string {
+	for _, rule := range rules {
+		s = rule.re.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// Sprintf formats message like fmt.Sprintf and redacts it
+func Sprintf(format string, v ...interface{}) string {
+	return String(fmt.Sprintf(format, v...))
+}
+
+// DumpRequest returns redacted and truncated dump of outgoing request, its body is kept readable
+func DumpRequest(request *http.Request) string {
+	dump, err := httputil.DumpRequestOut(request, true)
+	if err != nil {
+		return fmt.Sprintf("failed to dump request: %v", err)
+	}
+	return truncate(String(string(dump)))
+}
+
+// DumpResponse returns redacted and truncated dump of response, its body is kept readable
+func DumpResponse(response *http.Response) string {
+	dump, err := httputil.DumpResponse(response, true)
+	if err != nil {
+		return fmt.Sprintf("failed to dump response: %v", err)
+	}
+	return truncate(String(string(dump)))
+}
+
+func truncate(s string) string {
+	if len(s) <= maxDumpSize {
+		return s
+	}
+	return fmt.Sprintf("%s... (%d bytes truncated)", s[:maxDumpSize], len(s)-maxDumpSize)
+}
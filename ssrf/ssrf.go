@@ -0,0 +1,249 @@
+// Package ssrf restricts hosts the adapter connects to on behalf of RPC callers
+package ssrf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// internalNetworks are blocked unless allowlisted in addition to loopback, private, link-local,
+// multicast and unspecified addresses recognized by net.IP
+var internalNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved, includes broadcast
+	"64:ff9b::/96",   // NAT64 may reach internal IPv4
+	"64:ff9b:1::/48", // local-use NAT64
+	"2001:db8::/32",  // documentation
+	"100::/64",       // discard-only
+	"fec0::/10",      // deprecated site-local
+)
+
+// ForbiddenError is returned for hosts blocked by Policy
+type ForbiddenError struct {
+	Host   string
+	IP     net.IP
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	if e.IP == nil {
+		return fmt.Sprintf("host %s is forbidden: %s", e.Host, e.Reason)
+	}
+	return fmt.Sprintf("host %s (%s) is forbidden: %s", e.Host, e.IP, e.Reason)
+}
+
+// Policy allows public hosts and blocks internal ones.
+// Rules are IP addresses, CIDR networks, host names or *.domain patterns.
+// Deny rules always win, Allow rules permit internal hosts, with AllowOnly only allowlisted hosts are permitted.
+// Nil Policy permits any host.
+type Policy struct {
+	Allow     []Rule
+	Deny      []Rule
+	AllowOnly bool
+	// Resolver is used to lookup host addresses, net.DefaultResolver when nil
+	Resolver *net.Resolver
+}
+
+// Rule matches host by network of its address or by name
+type Rule struct {
+	Network *net.IPNet
+	// Host is lower case host name, *.domain matches all subdomains of domain
+	Host string
+}
+
+// NewPolicy creates Policy parsing allow and deny rules
+func NewPolicy(allow, deny []string, allowOnly bool) (*Policy, error) {
+	policy := &Policy{AllowOnly: allowOnly}
+	var err error
+	if policy.Allow, err = ParseRules(allow); err != nil {
+		return nil, err
+	}
+	if policy.Deny, err = ParseRules(deny); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// ParseRules parses IP addresses, CIDR networks, host names and *.domain patterns
+func ParseRules(rules []string) ([]Rule, error) {
+	res := make([]Rule, 0, len(rules))
+	for _, s := range rules {
+		if strings.Contains(s, "/") {
+			_, network, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, Rule{Network: network})
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			res = append(res, Rule{Network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}})
+			continue
+		}
+		host := strings.ToLower(s)
+		if name := strings.TrimPrefix(host, "*."); name == "" || strings.ContainsAny(name, "*:@ ") {
+			return nil, fmt.Errorf("invalid host rule %q", s)
+		}
+		res = append(res, Rule{Host: host})
+	}
+	return res, nil
+}
+
+// CheckURL verifies scheme of tracker URL and resolves its host to check every address
+func (policy *Policy) CheckURL(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &ForbiddenError{Host: u.Host, Reason: "scheme must be http or https"}
+	}
+	if policy == nil {
+		return nil
+	}
+	_, err := policy.resolve(ctx, u.Hostname())
+	return err
+}
+
+// DialContext wraps dial function to check resolved addresses right before connecting,
+// so DNS answer changed after CheckURL can't point connection to internal host
+func (policy *Policy) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if policy == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := policy.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			var conn net.Conn
+			if conn, err = dial(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// CheckProxied verifies host of request sent through proxy. Proxy resolves host names itself,
+// so its answer can't be checked when connecting: only permitted IP addresses
+// and host names matching Allow rules may be proxied.
+func (policy *Policy) CheckProxied(ctx context.Context, host string) error {
+	if policy == nil {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if net.ParseIP(host) != nil {
+		_, err := policy.resolve(ctx, host)
+		return err
+	}
+	switch {
+	case match(policy.Deny, host, nil):
+		return &ForbiddenError{Host: host, Reason: "denylisted"}
+	case !match(policy.Allow, host, nil):
+		return &ForbiddenError{Host: host, Reason: "proxied host is not allowlisted"}
+	}
+	return nil
+}
+
+// resolve returns addresses of host if all of them are permitted
+func (policy *Policy) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return nil, &ForbiddenError{Reason: "host is empty"}
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		resolver := policy.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		addrs, err := resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+		if len(ips) == 0 {
+			return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+	}
+	for _, ip := range ips {
+		if err := policy.check(host, ip); err != nil {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+func (policy *Policy) check(host string, ip net.IP) error {
+	switch {
+	case match(policy.Deny, host, ip):
+		return &ForbiddenError{Host: host, IP: ip, Reason: "denylisted"}
+	case match(policy.Allow, host, ip):
+		return nil
+	case policy.AllowOnly:
+		return &ForbiddenError{Host: host, IP: ip, Reason: "not allowlisted"}
+	case Internal(ip):
+		return &ForbiddenError{Host: host, IP: ip, Reason: "internal address"}
+	}
+	return nil
+}
+
+// Internal reports whether ip belongs to loopback, private, link-local or other non-public range
+func Internal(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func match(rules []Rule, host string, ip net.IP) bool {
+	for _, rule := range rules {
+		switch {
+		case rule.Network != nil:
+			if rule.Network.Contains(ip) {
+				return true
+			}
+		case strings.HasPrefix(rule.Host, "*."):
+			if strings.HasSuffix(host, rule.Host[1:]) {
+				return true
+			}
+		case rule.Host == host:
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	res := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		res[i] = network
+	}
+	return res
+}
@@ -0,0 +1,129 @@
+package ssrf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	a := assert.New(t)
+	rules, err := ParseRules([]string{"10.1.0.0/16", "192.168.1.10", "::1", "Jira.Local", "*.corp.example.com"})
+	a.NoError(err)
+	a.Len(rules, 5)
+	a.Equal("10.1.0.0/16", rules[0].Network.String())
+	a.Equal("192.168.1.10/32", rules[1].Network.String())
+	a.Equal("::1/128", rules[2].Network.String())
+	a.Equal("jira.local", rules[3].Host)
+	a.Equal("*.corp.example.com", rules[4].Host)
+
+	for _, rule := range []string{"10.0.0.0/33", "*.", "*", "host:8080", "user@host"} {
+		_, err = ParseRules([]string{rule})
+		a.Error(err, rule)
+	}
+}
+
+func TestInternal(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1":       true,
+		"10.0.0.1":        true,
+		"172.16.5.4":      true,
+		"192.168.0.1":     true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"::ffff:10.0.0.1": true,
+		"64:ff9b::a00:1":  true,
+		"8.8.8.8":         false,
+		"2606:4700::1111": false,
+	}
+	for ip, internal := range cases {
+		assert.Equal(t, internal, Internal(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+	check := func(policy *Policy, rawURL string) error {
+		u, err := url.Parse(rawURL)
+		assert.NoError(t, err)
+		return policy.CheckURL(ctx, u)
+	}
+	forbidden := func(err error) bool {
+		var e *ForbiddenError
+		return errors.As(err, &e)
+	}
+	a := assert.New(t)
+
+	var none *Policy
+	a.NoError(check(none, "http://127.0.0.1/"))
+	a.True(forbidden(check(none, "file:///etc/passwd")))
+
+	policy, err := NewPolicy([]string{"10.1.0.0/16"}, []string{"8.8.4.4"}, false)
+	a.NoError(err)
+	a.NoError(check(policy, "https://8.8.8.8/"))
+	a.NoError(check(policy, "https://10.1.2.3:8443/jira"))
+	a.True(forbidden(check(policy, "https://10.2.0.1/")))
+	a.True(forbidden(check(policy, "http://169.254.169.254/latest/meta-data/")))
+	a.True(forbidden(check(policy, "http://[::1]:8080/")))
+	a.True(forbidden(check(policy, "https://8.8.4.4/")))
+	a.True(forbidden(check(policy, "gopher://8.8.8.8/")))
+	a.True(forbidden(check(policy, "https:///rest")))
+
+	policy.AllowOnly = true
+	a.NoError(check(policy, "https://10.1.2.3/"))
+	a.True(forbidden(check(policy, "https://8.8.8.8/")))
+
+	policy, err = NewPolicy([]string{"localhost"}, nil, false)
+	a.NoError(err)
+	a.NoError(check(policy, "http://localhost/"))
+}
+
+func TestDialContext(t *testing.T) {
+	a := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	get := func(policy *Policy) error {
+		transport := &http.Transport{DialContext: policy.DialContext((&net.Dialer{}).DialContext)}
+		defer transport.CloseIdleConnections()
+		response, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		return err
+	}
+
+	var e *ForbiddenError
+	err := get(&Policy{})
+	a.True(errors.As(err, &e), "%v", err)
+	a.Equal("internal address", e.Reason)
+
+	policy, err := NewPolicy([]string{"127.0.0.0/8"}, nil, false)
+	a.NoError(err)
+	a.NoError(get(policy))
+	a.NoError(get(nil))
+}
+
+func TestCheckProxied(t *testing.T) {
+	a := assert.New(t)
+	policy, err := NewPolicy([]string{"jira.local", "*.corp"}, []string{"secret.corp"}, false)
+	a.NoError(err)
+	ctx := context.Background()
+	a.NoError(policy.CheckProxied(ctx, "Jira.Local."))
+	a.NoError(policy.CheckProxied(ctx, "jira.corp"))
+	a.NoError(policy.CheckProxied(ctx, "203.0.113.10"))
+	a.Error(policy.CheckProxied(ctx, "jira.example.com"), "proxy may resolve host to internal address")
+	a.Error(policy.CheckProxied(ctx, "secret.corp"))
+	a.Error(policy.CheckProxied(ctx, "127.0.0.1"))
+	a.NoError((*Policy)(nil).CheckProxied(ctx, "jira.example.com"))
+}
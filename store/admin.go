@@ -0,0 +1,391 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+	"github.com/qarea/jirams/entities"
+)
+
+// Admin errors
+var (
+	ErrMappingNotFound = errors.New("user mapping not found")
+	ErrIDTaken         = errors.New("user ID is mapped to another key")
+	ErrMergeSameID     = errors.New("cannot merge user ID into itself")
+)
+
+// Problem types reported by Verify
+const (
+	// ProblemMalformed - entry of unexpected size
+	ProblemMalformed = "malformed"
+	// ProblemMissingReverse - Users entry without UserKeys entry for its key
+	ProblemMissingReverse = "missing_reverse"
+	// ProblemReverseMismatch - UserKeys entry points to another ID than Users entry
+	ProblemReverseMismatch = "reverse_mismatch"
+	// ProblemOrphanReverse - UserKeys entry with neither key nor ID present in Users
+	ProblemOrphanReverse = "orphan_reverse"
+	// ProblemDuplicateKey - same key is mapped to several IDs of one tracker
+	ProblemDuplicateKey = "duplicate_key"
+	// ProblemSequence - ID above Users sequence, GetID will issue it again
+	ProblemSequence = "sequence"
+)
+
+// Mapping is an entry of Users bucket
+type Mapping struct {
+	TrackerID entities.TrackerID
+	UserID    entities.UserID
+	Key       string
+}
+
+// KeyMapping is an entry of UserKeys bucket
+type KeyMapping struct {
+	Key    string
+	UserID entities.UserID
+}
+
+// Dump contains all data of the store
+type Dump struct {
+	Sequence uint64
+	Users    []Mapping
+	UserKeys []KeyMapping
+}
+
+// Problem is an inconsistency found by Verify
+type Problem struct {
+	Type      string
+	TrackerID entities.TrackerID `json:",omitempty"`
+	UserID    entities.UserID    `json:",omitempty"`
+	Key       string             `json:",omitempty"`
+	Detail    string
+}
+
+// List returns mappings of tracker ordered by ID, all mappings when trackerID is 0
+func (store *Store) List(trackerID entities.TrackerID) (res []Mapping, err error) {
+	err = store.DB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(userBucket)).Cursor()
+		var prefix []byte
+		if trackerID != 0 {
+			prefix = itob(uint64(trackerID))
+		}
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if len(k) != 16 {
+				continue
+			}
+			res = append(res, toMapping(k, v))
+		}
+		return nil
+	})
+	return
+}
+
+// LookupID returns ID mapped to key without creating new one.
+// UserKeys bucket is not separated by tracker, so result is the same for all trackers.
+func (store *Store) LookupID(key entities.UserKey) (res entities.UserID, err error) {
+	err = store.DB.View(func(tx *bolt.Tx) error {
+		found := tx.Bucket([]byte(userKeyBucket)).Get([]byte(key))
+		if len(found) != 8 {
+			return ErrMappingNotFound
+		}
+		res = entities.UserID(btoi(found))
+		return nil
+	})
+	return
+}
+
+// Reassign maps key to userID in tracker, replacing its current ID
+func (store *Store) Reassign(trackerID entities.TrackerID, key entities.UserKey, userID entities.UserID) error {
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket([]byte(userBucket))
+		storeKey := makeKey(trackerID, userID)
+		if found := users.Get(storeKey); found != nil && string(found) != string(key) {
+			return ErrIDTaken
+		}
+		var stale [][]byte
+		forEachMapping(users, itob(uint64(trackerID)), func(k []byte, m Mapping) {
+			if m.Key == string(key) && m.UserID != userID {
+				stale = append(stale, k)
+			}
+		})
+		if err := deleteKeys(users, stale); err != nil {
+			return err
+		}
+		if err := users.Put(storeKey, []byte(key)); err != nil {
+			return err
+		}
+		if uint64(userID) > users.Sequence() {
+			if err := users.SetSequence(uint64(userID)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket([]byte(userKeyBucket)).Put([]byte(key), itob(uint64(userID)))
+	})
+}
+
+// Merge removes fromID of tracker, its key is mapped to toID afterwards
+func (store *Store) Merge(trackerID entities.TrackerID, fromID, toID entities.UserID) error {
+	if fromID == toID {
+		return ErrMergeSameID
+	}
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket([]byte(userBucket))
+		fromKey := users.Get(makeKey(trackerID, fromID))
+		if fromKey == nil || users.Get(makeKey(trackerID, toID)) == nil {
+			return ErrMappingNotFound
+		}
+		key := append([]byte(nil), fromKey...)
+		if err := users.Delete(makeKey(trackerID, fromID)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(userKeyBucket)).Put(key, itob(uint64(toID)))
+	})
+}
+
+// DeleteTracker removes all mappings of tracker and UserKeys entries not used by other trackers,
+// returns amount of removed mappings
+func (store *Store) DeleteTracker(trackerID entities.TrackerID) (count int, err error) {
+	err = store.DB.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket([]byte(userBucket))
+		userKeys := tx.Bucket([]byte(userKeyBucket))
+		var deleted [][]byte
+		var mappings []Mapping
+		forEachMapping(users, itob(uint64(trackerID)), func(k []byte, m Mapping) {
+			deleted = append(deleted, k)
+			mappings = append(mappings, m)
+		})
+		if err := deleteKeys(users, deleted); err != nil {
+			return err
+		}
+		used := make(map[Mapping]bool)
+		forEachMapping(users, nil, func(_ []byte, m Mapping) {
+			used[Mapping{UserID: m.UserID, Key: m.Key}] = true
+		})
+		for _, m := range mappings {
+			found := userKeys.Get([]byte(m.Key))
+			if len(found) == 8 && entities.UserID(btoi(found)) == m.UserID && !used[Mapping{UserID: m.UserID, Key: m.Key}] {
+				if err := userKeys.Delete([]byte(m.Key)); err != nil {
+					return err
+				}
+			}
+		}
+		count = len(deleted)
+		return nil
+	})
+	return
+}
+
+// Export returns all data of the store, malformed entries reported by Verify are skipped
+func (store *Store) Export() (res Dump, err error) {
+	err = store.DB.View(func(tx *bolt.Tx) error {
+		users := tx.Bucket([]byte(userBucket))
+		res.Sequence = users.Sequence()
+		err := users.ForEach(func(k, v []byte) error {
+			if len(k) == 16 {
+				res.Users = append(res.Users, toMapping(k, v))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(userKeyBucket)).ForEach(func(k, v []byte) error {
+			if len(v) == 8 {
+				res.UserKeys = append(res.UserKeys, KeyMapping{Key: string(k), UserID: entities.UserID(btoi(v))})
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// Import replaces all data of the store with dump
+func (store *Store) Import(dump Dump) error {
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{userBucket, userKeyBucket} {
+			if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		users, err := tx.CreateBucket([]byte(userBucket))
+		if err != nil {
+			return err
+		}
+		userKeys, err := tx.CreateBucket([]byte(userKeyBucket))
+		if err != nil {
+			return err
+		}
+		for _, m := range dump.Users {
+			if err := users.Put(makeKey(m.TrackerID, m.UserID), []byte(m.Key)); err != nil {
+				return err
+			}
+		}
+		for _, m := range dump.UserKeys {
+			if err := userKeys.Put([]byte(m.Key), itob(uint64(m.UserID))); err != nil {
+				return err
+			}
+		}
+		return users.SetSequence(dump.Sequence)
+	})
+}
+
+// Verify checks that Users and UserKeys buckets agree
+func (store *Store) Verify() (res []Problem, err error) {
+	err = store.DB.View(func(tx *bolt.Tx) error {
+		res = verify(tx)
+		return nil
+	})
+	return
+}
+
+// Repair fixes problems which do not need a decision: adds missing UserKeys entries,
+// removes orphan ones and raises sequence. Returns fixed problems.
+// Mismatches and duplicates are left to Reassign and Merge, malformed entries to Import.
+func (store *Store) Repair() (res []Problem, err error) {
+	err = store.DB.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket([]byte(userBucket))
+		userKeys := tx.Bucket([]byte(userKeyBucket))
+		for _, p := range verify(tx) {
+			var err error
+			switch p.Type {
+			case ProblemMissingReverse:
+				// the key may be mapped in several trackers, first one wins
+				if userKeys.Get([]byte(p.Key)) != nil {
+					continue
+				}
+				err = userKeys.Put([]byte(p.Key), itob(uint64(p.UserID)))
+			case ProblemOrphanReverse:
+				err = userKeys.Delete([]byte(p.Key))
+			case ProblemSequence:
+				if uint64(p.UserID) > users.Sequence() {
+					err = users.SetSequence(uint64(p.UserID))
+				}
+			default:
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			res = append(res, p)
+		}
+		return nil
+	})
+	return
+}
+
+func verify(tx *bolt.Tx) (res []Problem) {
+	users := tx.Bucket([]byte(userBucket))
+	dump := Dump{Sequence: users.Sequence()}
+	_ = users.ForEach(func(k, v []byte) error {
+		if len(k) != 16 {
+			res = append(res, Problem{Type: ProblemMalformed, Key: string(v), Detail: fmt.Sprintf("Users key %x", k)})
+			return nil
+		}
+		dump.Users = append(dump.Users, toMapping(k, v))
+		return nil
+	})
+	malformed := make(map[string]bool)
+	_ = tx.Bucket([]byte(userKeyBucket)).ForEach(func(k, v []byte) error {
+		if len(v) != 8 {
+			res = append(res, Problem{Type: ProblemMalformed, Key: string(k), Detail: fmt.Sprintf("UserKeys value %x", v)})
+			malformed[string(k)] = true
+			return nil
+		}
+		dump.UserKeys = append(dump.UserKeys, KeyMapping{Key: string(k), UserID: entities.UserID(btoi(v))})
+		return nil
+	})
+	return append(res, dump.verify(malformed)...)
+}
+
+// verify checks that Users and UserKeys agree, keys of malformed UserKeys entries are not reported as missing
+func (dump Dump) verify(malformed map[string]bool) (res []Problem) {
+	reverse := make(map[string]entities.UserID, len(dump.UserKeys))
+	for _, m := range dump.UserKeys {
+		reverse[m.Key] = m.UserID
+	}
+	var maxID entities.UserID
+	ids := make(map[string][]entities.UserID)
+	usedIDs := make(map[entities.UserID]bool)
+	byTracker := make(map[entities.TrackerID]map[string][]entities.UserID)
+
+	for _, m := range dump.Users {
+		ids[m.Key] = append(ids[m.Key], m.UserID)
+		usedIDs[m.UserID] = true
+		if byTracker[m.TrackerID] == nil {
+			byTracker[m.TrackerID] = make(map[string][]entities.UserID)
+		}
+		byTracker[m.TrackerID][m.Key] = append(byTracker[m.TrackerID][m.Key], m.UserID)
+		if m.UserID > maxID {
+			maxID = m.UserID
+		}
+		found, ok := reverse[m.Key]
+		switch {
+		case !ok && !malformed[m.Key]:
+			res = append(res, Problem{Type: ProblemMissingReverse, TrackerID: m.TrackerID, UserID: m.UserID, Key: m.Key,
+				Detail: "UserKeys entry is missing"})
+		case ok && found != m.UserID:
+			res = append(res, Problem{Type: ProblemReverseMismatch, TrackerID: m.TrackerID, UserID: m.UserID, Key: m.Key,
+				Detail: fmt.Sprintf("UserKeys maps key to %d", found)})
+		}
+	}
+	for _, m := range dump.UserKeys {
+		if m.UserID > maxID {
+			maxID = m.UserID
+		}
+		// mismatches are reported for Users entries, keys merged into another ID are aliases
+		if len(ids[m.Key]) > 0 || usedIDs[m.UserID] {
+			continue
+		}
+		res = append(res, Problem{Type: ProblemOrphanReverse, UserID: m.UserID, Key: m.Key, Detail: "Users entry is missing"})
+	}
+
+	trackers := make([]entities.TrackerID, 0, len(byTracker))
+	for trackerID := range byTracker {
+		trackers = append(trackers, trackerID)
+	}
+	sort.Slice(trackers, func(i, j int) bool { return trackers[i] < trackers[j] })
+	for _, trackerID := range trackers {
+		keys := make([]string, 0, len(byTracker[trackerID]))
+		for key := range byTracker[trackerID] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if found := byTracker[trackerID][key]; len(found) > 1 {
+				res = append(res, Problem{Type: ProblemDuplicateKey, TrackerID: trackerID, Key: key,
+					Detail: fmt.Sprintf("key is mapped to IDs %v", found)})
+			}
+		}
+	}
+	if uint64(maxID) > dump.Sequence {
+		res = append(res, Problem{Type: ProblemSequence, UserID: maxID, Detail: fmt.Sprintf("sequence is %d", dump.Sequence)})
+	}
+	return
+}
+
+func forEachMapping(users *bolt.Bucket, prefix []byte, fn func(k []byte, m Mapping)) {
+	c := users.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if len(k) == 16 {
+			fn(append([]byte(nil), k...), toMapping(k, v))
+		}
+	}
+}
+
+func deleteKeys(bucket *bolt.Bucket, keys [][]byte) error {
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toMapping(k, v []byte) Mapping {
+	return Mapping{
+		TrackerID: entities.TrackerID(btoi(k[:8])),
+		UserID:    entities.UserID(btoi(k[8:])),
+		Key:       string(v),
+	}
+}
@@ -0,0 +1,148 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) *Store {
+	dir, err := os.MkdirTemp("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "store.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	})
+	return New(db)
+}
+
+func TestAdminListAndLookup(t *testing.T) {
+	a := assert.New(t)
+	store := newTestStore(t)
+	for _, key := range []entities.UserKey{"alice", "bob"} {
+		_, err := store.GetID(1, key)
+		a.NoError(err)
+	}
+	_, err := store.GetID(2, "carol")
+	a.NoError(err)
+
+	mappings, err := store.List(1)
+	a.NoError(err)
+	a.Equal([]Mapping{{1, 1, "alice"}, {1, 2, "bob"}}, mappings)
+	mappings, err = store.List(0)
+	a.NoError(err)
+	a.Len(mappings, 3)
+
+	id, err := store.LookupID("carol")
+	a.NoError(err)
+	a.Equal(entities.UserID(3), id)
+	_, err = store.LookupID("dave")
+	a.Equal(ErrMappingNotFound, err)
+	mappings, _ = store.List(0)
+	a.Len(mappings, 3, "lookup should not create mapping")
+}
+
+func TestAdminReassignAndMerge(t *testing.T) {
+	a := assert.New(t)
+	store := newTestStore(t)
+	_, _ = store.GetID(1, "alice")
+	_, _ = store.GetID(1, "bob")
+
+	a.Equal(ErrIDTaken, store.Reassign(1, "alice", 2))
+	a.NoError(store.Reassign(1, "alice", 10))
+	mappings, _ := store.List(1)
+	a.Equal([]Mapping{{1, 2, "bob"}, {1, 10, "alice"}}, mappings)
+	id, _ := store.GetID(1, "alice")
+	a.Equal(entities.UserID(10), id)
+	id, _ = store.GetID(1, "carol")
+	a.Equal(entities.UserID(11), id, "reassigned ID should not be issued again")
+
+	a.Equal(ErrMergeSameID, store.Merge(1, 2, 2))
+	a.Equal(ErrMappingNotFound, store.Merge(1, 2, 5))
+	a.NoError(store.Merge(1, 2, 10))
+	id, _ = store.GetID(1, "bob")
+	a.Equal(entities.UserID(10), id)
+	key, _ := store.GetKey(1, 10)
+	a.Equal("alice", key)
+	key, _ = store.GetKey(1, 2)
+	a.Equal("", key)
+
+	problems, err := store.Verify()
+	a.NoError(err)
+	a.Empty(problems)
+}
+
+func TestAdminDeleteTracker(t *testing.T) {
+	a := assert.New(t)
+	store := newTestStore(t)
+	_, _ = store.GetID(1, "alice")
+	_, _ = store.GetID(2, "bob")
+	_, _ = store.GetID(1, "bob") // shared key keeps ID 2 without Users entry in tracker 1
+
+	count, err := store.DeleteTracker(1)
+	a.NoError(err)
+	a.Equal(1, count)
+	_, err = store.LookupID("alice")
+	a.Equal(ErrMappingNotFound, err)
+	id, err := store.LookupID("bob")
+	a.NoError(err)
+	a.Equal(entities.UserID(2), id)
+	mappings, _ := store.List(0)
+	a.Equal([]Mapping{{2, 2, "bob"}}, mappings)
+}
+
+func TestAdminVerifyRepairExportImport(t *testing.T) {
+	a := assert.New(t)
+	store := newTestStore(t)
+	_, _ = store.GetID(1, "alice")
+	_, _ = store.GetID(1, "bob")
+	dump, err := store.Export()
+	a.NoError(err)
+	a.Equal(Dump{
+		Sequence: 2,
+		Users:    []Mapping{{1, 1, "alice"}, {1, 2, "bob"}},
+		UserKeys: []KeyMapping{{"alice", 1}, {"bob", 2}},
+	}, dump)
+
+	corrupted := Dump{
+		Sequence: 1,
+		Users:    []Mapping{{1, 1, "alice"}, {1, 2, "bob"}, {1, 3, "bob"}},
+		UserKeys: []KeyMapping{{"alice", 5}, {"carol", 4}},
+	}
+	a.NoError(store.Import(corrupted))
+	problems, err := store.Verify()
+	a.NoError(err)
+	a.Equal([]Problem{
+		{Type: ProblemReverseMismatch, TrackerID: 1, UserID: 1, Key: "alice", Detail: "UserKeys maps key to 5"},
+		{Type: ProblemMissingReverse, TrackerID: 1, UserID: 2, Key: "bob", Detail: "UserKeys entry is missing"},
+		{Type: ProblemMissingReverse, TrackerID: 1, UserID: 3, Key: "bob", Detail: "UserKeys entry is missing"},
+		{Type: ProblemOrphanReverse, UserID: 4, Key: "carol", Detail: "Users entry is missing"},
+		{Type: ProblemDuplicateKey, TrackerID: 1, Key: "bob", Detail: "key is mapped to IDs [2 3]"},
+		{Type: ProblemSequence, UserID: 5, Detail: "sequence is 1"},
+	}, problems)
+
+	fixed, err := store.Repair()
+	a.NoError(err)
+	a.Len(fixed, 3)
+	problems, _ = store.Verify()
+	a.Equal([]Problem{
+		{Type: ProblemReverseMismatch, TrackerID: 1, UserID: 1, Key: "alice", Detail: "UserKeys maps key to 5"},
+		{Type: ProblemReverseMismatch, TrackerID: 1, UserID: 3, Key: "bob", Detail: "UserKeys maps key to 2"},
+		{Type: ProblemDuplicateKey, TrackerID: 1, Key: "bob", Detail: "key is mapped to IDs [2 3]"},
+	}, problems)
+
+	a.NoError(store.Reassign(1, "alice", 1))
+	a.NoError(store.Merge(1, 3, 2))
+	problems, _ = store.Verify()
+	a.Empty(problems)
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// OutboxBucket keeps queued reports with tracker credentials
+const OutboxBucket = "Outbox"
+
+// SensitiveBuckets hold secrets, their values are encrypted when Keyring has current key
+var SensitiveBuckets = []string{OutboxBucket}
+
+const (
+	// sealedMagic starts every encrypted value, JSON and user keys never start with NUL
+	sealedMagic = "\x00enc1"
+	keySize     = 32
+)
+
+// Errors returned by Keyring
+var (
+	ErrUnknownKey = errors.New("value is encrypted with unknown key")
+	ErrNoKeyring  = errors.New("value is encrypted but no keys are configured")
+)
+
+// Keyring implements envelope encryption: every value is encrypted with its own random
+// AES-256-GCM data key, which is encrypted with master key and stored with the value along with master key ID.
+// Values without encryption header are returned as is, so plain data written before keys were configured keeps working.
+type Keyring struct {
+	// Current is ID of the master key used to encrypt new values, empty disables encryption
+	Current string
+	Keys    map[string][]byte
+}
+
+// ParseKeyring creates Keyring from lines "ID BASE64KEY" of 32 byte keys, empty lines and lines starting with # are ignored
+func ParseKeyring(data []byte, current string) (*Keyring, error) {
+	keyring := &Keyring{Current: current, Keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) > 255 {
+			return nil, fmt.Errorf("line %d: expected key ID and base64 encoded key", n)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("line %d: key must be %d bytes encoded in base64", n, keySize)
+		}
+		if _, ok := keyring.Keys[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key ID %q", n, fields[0])
+		}
+		keyring.Keys[fields[0]] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := keyring.Keys[current]; current != "" && !ok {
+		return nil, fmt.Errorf("current key %q is not found", current)
+	}
+	return keyring, nil
+}
+
+// GenerateKey returns new random key encoded for ParseKeyring
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Seal encrypts value stored under key of bucket with current master key,
+// value is returned as is when there is no current key.
+// Bucket and key are authenticated, so encrypted value can't be moved to another place.
+func (keyring *Keyring) Seal(bucket string, key, value []byte) ([]byte, error) {
+	if keyring == nil || keyring.Current == "" {
+		return value, nil
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	res := append([]byte(sealedMagic), byte(len(keyring.Current)))
+	res = append(res, keyring.Current...)
+	res, err := seal(res, keyring.Keys[keyring.Current], dataKey, []byte(keyring.Current))
+	if err != nil {
+		return nil, err
+	}
+	return seal(res, dataKey, value, aad(bucket, key))
+}
+
+// Open decrypts value stored under key of bucket, plain values are returned as is
+func (keyring *Keyring) Open(bucket string, key, value []byte) ([]byte, error) {
+	id, ok := KeyID(value)
+	if !ok {
+		return value, nil
+	}
+	if keyring == nil {
+		return nil, ErrNoKeyring
+	}
+	masterKey, ok := keyring.Keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	rest := value[len(sealedMagic)+1+len(id):]
+	dataKey, rest, err := open(masterKey, rest, keySize+gcmOverhead, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	res, _, err := open(dataKey, rest, len(rest)-gcmNonceSize, aad(bucket, key))
+	return res, err
+}
+
+// KeyID returns ID of master key value is encrypted with, false for plain values
+func KeyID(value []byte) (string, bool) {
+	if !bytes.HasPrefix(value, []byte(sealedMagic)) || len(value) < len(sealedMagic)+1 {
+		return "", false
+	}
+	size := int(value[len(sealedMagic)])
+	if len(value) < len(sealedMagic)+1+size {
+		return "", false
+	}
+	return string(value[len(sealedMagic)+1 : len(sealedMagic)+1+size]), true
+}
+
+// Rotate re-encrypts values of bucket not encrypted with current key,
+// without current key it decrypts all values. Returns amount of changed values.
+func (keyring *Keyring) Rotate(db *bolt.DB, bucket string) (count int, err error) {
+	current := ""
+	if keyring != nil {
+		current = keyring.Current
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		type change struct{ key, value []byte }
+		var changes []change
+		err := b.ForEach(func(k, v []byte) error {
+			if id, _ := KeyID(v); id == current {
+				return nil
+			}
+			plain, err := keyring.Open(bucket, k, v)
+			if err != nil {
+				return fmt.Errorf("%s %x: %v", bucket, k, err)
+			}
+			sealed, err := keyring.Seal(bucket, k, plain)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change{append([]byte(nil), k...), sealed})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// bucket must not be modified during ForEach
+		for _, c := range changes {
+			if err := b.Put(c.key, c.value); err != nil {
+				return err
+			}
+		}
+		count = len(changes)
+		return nil
+	})
+	return
+}
+
+const (
+	gcmNonceSize = 12
+	gcmOverhead  = 16
+)
+
+// seal appends nonce and encrypted plain to dst
+func seal(dst, key, plain, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plain, additional), nil
+}
+
+// open decrypts nonce and ciphertext of given size from the beginning of data, returning the rest of data
+func open(key, data []byte, size int, additional []byte) (plain, rest []byte, err error) {
+	if size < gcmOverhead || len(data) < gcmNonceSize+size {
+		return nil, nil, errors.New("encrypted value is truncated")
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err = aead.Open(nil, data[:gcmNonceSize], data[gcmNonceSize:gcmNonceSize+size], additional)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plain, data[gcmNonceSize+size:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func aad(bucket string, key []byte) []byte {
+	return append([]byte(bucket+"\x00"), key...)
+}
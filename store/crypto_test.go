@@ -0,0 +1,117 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeyring(t *testing.T, current string, ids ...string) *Keyring {
+	var keys string
+	for _, id := range ids {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys += fmt.Sprintf("%s %s\n", id, key)
+	}
+	keyring, err := ParseKeyring([]byte("# test keys\n\n"+keys), current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func TestParseKeyring(t *testing.T) {
+	a := assert.New(t)
+	_, err := ParseKeyring([]byte("k1 c2hvcnQ=\n"), "")
+	a.EqualError(err, "line 1: key must be 32 bytes encoded in base64")
+	_, err = ParseKeyring([]byte("k1\n"), "")
+	a.EqualError(err, "line 1: expected key ID and base64 encoded key")
+	_, err = ParseKeyring(nil, "k1")
+	a.EqualError(err, `current key "k1" is not found`)
+	keyring, err := ParseKeyring(nil, "")
+	a.NoError(err)
+	a.Empty(keyring.Keys)
+}
+
+func TestKeyringSealOpen(t *testing.T) {
+	a := assert.New(t)
+	keyring := newTestKeyring(t, "k1", "k1", "k2")
+	value := []byte(`{"Login":"tester","Password":"secret"}`)
+
+	sealed, err := keyring.Seal("Outbox", []byte("1"), value)
+	a.NoError(err)
+	a.NotContains(string(sealed), "secret")
+	id, ok := KeyID(sealed)
+	a.True(ok)
+	a.Equal("k1", id)
+	opened, err := keyring.Open("Outbox", []byte("1"), sealed)
+	a.NoError(err)
+	a.Equal(value, opened)
+
+	// value is bound to its place
+	_, err = keyring.Open("Outbox", []byte("2"), sealed)
+	a.Error(err)
+	sealed[len(sealed)-1] ^= 1
+	_, err = keyring.Open("Outbox", []byte("1"), sealed)
+	a.Error(err)
+
+	// plain values are returned as is
+	opened, err = keyring.Open("Outbox", []byte("1"), value)
+	a.NoError(err)
+	a.Equal(value, opened)
+	var none *Keyring
+	plain, err := none.Seal("Outbox", []byte("1"), value)
+	a.NoError(err)
+	a.Equal(value, plain)
+
+	sealed, _ = keyring.Seal("Outbox", []byte("1"), value)
+	_, err = none.Open("Outbox", []byte("1"), sealed)
+	a.Equal(ErrNoKeyring, err)
+	_, err = newTestKeyring(t, "k3", "k3").Open("Outbox", []byte("1"), sealed)
+	a.Equal(ErrUnknownKey, err)
+}
+
+func TestKeyringRotate(t *testing.T) {
+	a := assert.New(t)
+	store := newTestStore(t)
+	old := newTestKeyring(t, "k1", "k1")
+	sealed, _ := old.Seal(OutboxBucket, []byte("1"), []byte("one"))
+	a.NoError(store.DB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(OutboxBucket))
+		if err != nil {
+			return err
+		}
+		_ = b.Put([]byte("1"), sealed)
+		return b.Put([]byte("2"), []byte("two"))
+	}))
+	values := func(keyring *Keyring) (res []string) {
+		_ = store.DB.View(func(tx *bolt.Tx) error {
+			return tx.Bucket([]byte(OutboxBucket)).ForEach(func(k, v []byte) error {
+				id, _ := KeyID(v)
+				plain, err := keyring.Open(OutboxBucket, k, v)
+				a.NoError(err)
+				res = append(res, id+":"+string(plain))
+				return nil
+			})
+		})
+		return
+	}
+
+	keyring := &Keyring{Current: "k2", Keys: map[string][]byte{"k1": old.Keys["k1"], "k2": newTestKeyring(t, "", "k2").Keys["k2"]}}
+	count, err := keyring.Rotate(store.DB, OutboxBucket)
+	a.NoError(err)
+	a.Equal(2, count)
+	a.Equal([]string{"k2:one", "k2:two"}, values(keyring))
+	count, _ = keyring.Rotate(store.DB, OutboxBucket)
+	a.Equal(0, count)
+
+	keyring.Current = ""
+	count, err = keyring.Rotate(store.DB, OutboxBucket)
+	a.NoError(err)
+	a.Equal(2, count)
+	a.Equal([]string{":one", ":two"}, values(nil))
+}
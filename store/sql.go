@@ -0,0 +1,501 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/metrics"
+)
+
+// Supported SQL dialects, named as database/sql drivers
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite3"
+)
+
+// Backend is UserKeyMapper able to report its health
+type Backend interface {
+	UserKeyMapper
+	Ping() error
+}
+
+// migration is a schema change, statements are the same for all dialects unless overridden
+type migration struct {
+	version    int
+	statements []string
+	dialects   map[string][]string
+}
+
+// migrations are applied in order, never change already released ones
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE jirams_users (
+				tracker_id BIGINT NOT NULL,
+				user_id    BIGINT NOT NULL,
+				user_key   VARCHAR(255) NOT NULL,
+				PRIMARY KEY (tracker_id, user_id)
+			)`,
+			`CREATE TABLE jirams_user_keys (
+				user_key VARCHAR(255) NOT NULL PRIMARY KEY,
+				user_id  BIGINT NOT NULL
+			)`,
+			`CREATE TABLE jirams_user_sequence (id BIGINT NOT NULL)`,
+			`INSERT INTO jirams_user_sequence (id) VALUES (0)`,
+		},
+		dialects: map[string][]string{
+			MySQL: {
+				`CREATE TABLE jirams_users (
+					tracker_id BIGINT UNSIGNED NOT NULL,
+					user_id    BIGINT UNSIGNED NOT NULL,
+					user_key   VARCHAR(255) NOT NULL,
+					PRIMARY KEY (tracker_id, user_id)
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+				`CREATE TABLE jirams_user_keys (
+					user_key VARCHAR(255) NOT NULL PRIMARY KEY,
+					user_id  BIGINT UNSIGNED NOT NULL
+				) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+				`CREATE TABLE jirams_user_sequence (id BIGINT UNSIGNED NOT NULL) ENGINE=InnoDB`,
+				`INSERT INTO jirams_user_sequence (id) VALUES (0)`,
+			},
+		},
+	},
+}
+
+// SQLStore implements UserKeyMapper backed by MySQL, PostgreSQL or SQLite.
+// IDs are assigned like in Store: known key gets its ID regardless of tracker,
+// new key gets next value of single sequence, so several instances may share the database.
+type SQLStore struct {
+	DB      *sql.DB
+	Dialect string
+}
+
+// NewSQL creates an instance of SQLStore applying migrations
+func NewSQL(db *sql.DB, dialect string) *SQLStore {
+	res := &SQLStore{DB: db, Dialect: dialect}
+	res.Init()
+	return res
+}
+
+// Init applies migrations if needed
+func (store *SQLStore) Init() {
+	if err := store.Migrate(); err != nil {
+		log.Fatal("Failed to migrate Jira Users store: ", err)
+	}
+}
+
+// migrationLock names advisory lock which serializes migrations of instances sharing the database
+const migrationLock = "jirams_schema_migrations"
+
+// Migrate applies all migrations newer than the current schema version
+func (store *SQLStore) Migrate() error {
+	unlock, err := store.lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock migrations: %v", err)
+	}
+	defer unlock()
+	if _, err := store.DB.Exec(`CREATE TABLE IF NOT EXISTS jirams_schema_migrations (version INT NOT NULL PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var current int
+	err = store.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM jirams_schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		statements := m.statements
+		if s, ok := m.dialects[store.Dialect]; ok {
+			statements = s
+		}
+		// MySQL commits DDL implicitly, so migrations are not atomic there
+		err := store.tx(func(tx *sql.Tx) error {
+			for _, statement := range statements {
+				if _, err := tx.Exec(statement); err != nil {
+					return fmt.Errorf("migration %d: %v", m.version, err)
+				}
+			}
+			_, err := tx.Exec(store.rebind(`INSERT INTO jirams_schema_migrations (version) VALUES (?)`), m.version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		log.NOTICE("Applied migration %d", m.version)
+	}
+	return nil
+}
+
+// lock takes advisory lock for migrations, SQLite database is not shared between hosts and isn't locked.
+// Advisory locks belong to session, so the lock is held by dedicated connection until unlock is called.
+func (store *SQLStore) lock() (unlock func(), err error) {
+	var lockQuery, unlockQuery string
+	switch store.Dialect {
+	case MySQL:
+		lockQuery, unlockQuery = `SELECT GET_LOCK(?, -1)`, `SELECT RELEASE_LOCK(?)`
+	case Postgres:
+		lockQuery, unlockQuery = `SELECT 1 FROM pg_advisory_lock(hashtext($1))`, `SELECT pg_advisory_unlock(hashtext($1))`
+	default:
+		return func() {}, nil
+	}
+	ctx := context.Background()
+	conn, err := store.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, lockQuery, migrationLock).Scan(&locked); err != nil || locked.Int64 != 1 {
+		_ = conn.Close()
+		if err == nil {
+			err = errors.New("lock is not acquired")
+		}
+		return nil, err
+	}
+	return func() {
+		if _, err := conn.ExecContext(ctx, unlockQuery, migrationLock); err != nil {
+			log.ERR("Failed to unlock migrations: %v", err)
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+// Ping verifies that database answers and is migrated
+func (store *SQLStore) Ping() error {
+	var version int
+	err := store.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM jirams_schema_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version < migrations[len(migrations)-1].version {
+		return errors.New("user store is not migrated")
+	}
+	return nil
+}
+
+// GetID looks for provided user key in the mapping, stores it if it is not present and returns associated numeric user id
+func (store *SQLStore) GetID(trackerID entities.TrackerID, key entities.UserKey) (res entities.UserID, err error) {
+	defer metrics.ObserveStore("GetID", time.Now())
+
+	if res, err = store.lookupID(key); err != sql.ErrNoRows {
+		return
+	}
+	err = store.tx(func(tx *sql.Tx) error {
+		// row lock on sequence serializes key creation between instances
+		if _, err := tx.Exec(`UPDATE jirams_user_sequence SET id = id + 1`); err != nil {
+			return err
+		}
+		var id uint64
+		if err := tx.QueryRow(`SELECT id FROM jirams_user_sequence`).Scan(&id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(store.rebind(`INSERT INTO jirams_user_keys (user_key, user_id) VALUES (?, ?)`), string(key), id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(store.rebind(`INSERT INTO jirams_users (tracker_id, user_id, user_key) VALUES (?, ?, ?)`), uint64(trackerID), id, string(key)); err != nil {
+			return err
+		}
+		res = entities.UserID(id)
+		return nil
+	})
+	if err != nil {
+		// another instance may have stored the key concurrently
+		if found, errLookup := store.lookupID(key); errLookup == nil {
+			return found, nil
+		}
+	}
+	return
+}
+
+// GetKey looks for provided user ID in the mapping and returns original user key
+func (store *SQLStore) GetKey(trackerID entities.TrackerID, userID entities.UserID) (res string, err error) {
+	defer metrics.ObserveStore("GetKey", time.Now())
+	err = store.DB.QueryRow(store.rebind(`SELECT user_key FROM jirams_users WHERE tracker_id = ? AND user_id = ?`),
+		uint64(trackerID), uint64(userID)).Scan(&res)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// Export returns all data of the store
+func (store *SQLStore) Export() (res Dump, err error) {
+	err = store.tx(func(tx *sql.Tx) (err error) {
+		res, err = store.export(tx)
+		return
+	})
+	return
+}
+
+// Import replaces all data of the store with dump
+func (store *SQLStore) Import(dump Dump) error {
+	return store.tx(func(tx *sql.Tx) error {
+		for _, table := range []string{"jirams_users", "jirams_user_keys"} {
+			if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+				return err
+			}
+		}
+		for _, m := range dump.Users {
+			_, err := tx.Exec(store.rebind(`INSERT INTO jirams_users (tracker_id, user_id, user_key) VALUES (?, ?, ?)`),
+				uint64(m.TrackerID), uint64(m.UserID), m.Key)
+			if err != nil {
+				return err
+			}
+		}
+		for _, m := range dump.UserKeys {
+			_, err := tx.Exec(store.rebind(`INSERT INTO jirams_user_keys (user_key, user_id) VALUES (?, ?)`), m.Key, uint64(m.UserID))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(store.rebind(`UPDATE jirams_user_sequence SET id = ?`), dump.Sequence)
+		return err
+	})
+}
+
+// List returns mappings of tracker ordered by ID, all mappings when trackerID is 0
+func (store *SQLStore) List(trackerID entities.TrackerID) (res []Mapping, err error) {
+	err = store.tx(func(tx *sql.Tx) (err error) {
+		res, err = store.listMappings(tx, trackerID)
+		return
+	})
+	return
+}
+
+// LookupID returns ID mapped to key without creating new one
+func (store *SQLStore) LookupID(key entities.UserKey) (entities.UserID, error) {
+	res, err := store.lookupID(key)
+	if err == sql.ErrNoRows {
+		err = ErrMappingNotFound
+	}
+	return res, err
+}
+
+// Reassign maps key to userID in tracker, replacing its current ID
+func (store *SQLStore) Reassign(trackerID entities.TrackerID, key entities.UserKey, userID entities.UserID) error {
+	return store.tx(func(tx *sql.Tx) error {
+		found, err := store.userKey(tx, trackerID, userID)
+		switch {
+		case err == sql.ErrNoRows:
+			_, err = tx.Exec(store.rebind(`INSERT INTO jirams_users (tracker_id, user_id, user_key) VALUES (?, ?, ?)`),
+				uint64(trackerID), uint64(userID), string(key))
+		case err == nil && found != string(key):
+			return ErrIDTaken
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(store.rebind(`DELETE FROM jirams_users WHERE tracker_id = ? AND user_key = ? AND user_id <> ?`),
+			uint64(trackerID), string(key), uint64(userID))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(store.rebind(`UPDATE jirams_user_sequence SET id = ? WHERE id < ?`), uint64(userID), uint64(userID)); err != nil {
+			return err
+		}
+		return store.putUserKey(tx, string(key), userID)
+	})
+}
+
+// Merge removes fromID of tracker, its key is mapped to toID afterwards
+func (store *SQLStore) Merge(trackerID entities.TrackerID, fromID, toID entities.UserID) error {
+	if fromID == toID {
+		return ErrMergeSameID
+	}
+	return store.tx(func(tx *sql.Tx) error {
+		fromKey, err := store.userKey(tx, trackerID, fromID)
+		if err == nil {
+			_, err = store.userKey(tx, trackerID, toID)
+		}
+		if err == sql.ErrNoRows {
+			return ErrMappingNotFound
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.Exec(store.rebind(`DELETE FROM jirams_users WHERE tracker_id = ? AND user_id = ?`), uint64(trackerID), uint64(fromID))
+		if err != nil {
+			return err
+		}
+		return store.putUserKey(tx, fromKey, toID)
+	})
+}
+
+// DeleteTracker removes all mappings of tracker and UserKeys entries not used by other trackers,
+// returns amount of removed mappings
+func (store *SQLStore) DeleteTracker(trackerID entities.TrackerID) (count int, err error) {
+	err = store.tx(func(tx *sql.Tx) error {
+		mappings, err := store.listMappings(tx, trackerID)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(store.rebind(`DELETE FROM jirams_users WHERE tracker_id = ?`), uint64(trackerID)); err != nil {
+			return err
+		}
+		for _, m := range mappings {
+			_, err := tx.Exec(store.rebind(`DELETE FROM jirams_user_keys WHERE user_key = ? AND user_id = ?
+				AND NOT EXISTS (SELECT 1 FROM jirams_users WHERE user_key = ? AND user_id = ?)`),
+				m.Key, uint64(m.UserID), m.Key, uint64(m.UserID))
+			if err != nil {
+				return err
+			}
+		}
+		count = len(mappings)
+		return nil
+	})
+	return
+}
+
+// Verify checks that jirams_users and jirams_user_keys tables agree
+func (store *SQLStore) Verify() (res []Problem, err error) {
+	err = store.tx(func(tx *sql.Tx) error {
+		dump, err := store.export(tx)
+		if err != nil {
+			return err
+		}
+		res = dump.verify(nil)
+		return nil
+	})
+	return
+}
+
+// Repair fixes problems which do not need a decision like Store.Repair does
+func (store *SQLStore) Repair() (res []Problem, err error) {
+	err = store.tx(func(tx *sql.Tx) error {
+		dump, err := store.export(tx)
+		if err != nil {
+			return err
+		}
+		for _, p := range dump.verify(nil) {
+			var err error
+			switch p.Type {
+			case ProblemMissingReverse:
+				// the key may be mapped in several trackers, first one wins
+				var id uint64
+				err = tx.QueryRow(store.rebind(`SELECT user_id FROM jirams_user_keys WHERE user_key = ?`), p.Key).Scan(&id)
+				if err == nil {
+					continue
+				} else if err == sql.ErrNoRows {
+					_, err = tx.Exec(store.rebind(`INSERT INTO jirams_user_keys (user_key, user_id) VALUES (?, ?)`), p.Key, uint64(p.UserID))
+				}
+			case ProblemOrphanReverse:
+				_, err = tx.Exec(store.rebind(`DELETE FROM jirams_user_keys WHERE user_key = ?`), p.Key)
+			case ProblemSequence:
+				_, err = tx.Exec(store.rebind(`UPDATE jirams_user_sequence SET id = ? WHERE id < ?`), uint64(p.UserID), uint64(p.UserID))
+			default:
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			res = append(res, p)
+		}
+		return nil
+	})
+	return
+}
+
+// userKey returns key mapped to userID in tracker
+func (store *SQLStore) userKey(tx *sql.Tx, trackerID entities.TrackerID, userID entities.UserID) (res string, err error) {
+	err = tx.QueryRow(store.rebind(`SELECT user_key FROM jirams_users WHERE tracker_id = ? AND user_id = ?`),
+		uint64(trackerID), uint64(userID)).Scan(&res)
+	return
+}
+
+// putUserKey maps key to userID in jirams_user_keys
+func (store *SQLStore) putUserKey(tx *sql.Tx, key string, userID entities.UserID) error {
+	if _, err := tx.Exec(store.rebind(`DELETE FROM jirams_user_keys WHERE user_key = ?`), key); err != nil {
+		return err
+	}
+	_, err := tx.Exec(store.rebind(`INSERT INTO jirams_user_keys (user_key, user_id) VALUES (?, ?)`), key, uint64(userID))
+	return err
+}
+
+func (store *SQLStore) lookupID(key entities.UserKey) (entities.UserID, error) {
+	var id uint64
+	err := store.DB.QueryRow(store.rebind(`SELECT user_id FROM jirams_user_keys WHERE user_key = ?`), string(key)).Scan(&id)
+	return entities.UserID(id), err
+}
+
+func (store *SQLStore) export(tx *sql.Tx) (res Dump, err error) {
+	if err = tx.QueryRow(`SELECT id FROM jirams_user_sequence`).Scan(&res.Sequence); err != nil {
+		return
+	}
+	if res.Users, err = store.listMappings(tx, 0); err != nil {
+		return
+	}
+	rows, err := tx.Query(`SELECT user_key, user_id FROM jirams_user_keys ORDER BY user_key`)
+	if err != nil {
+		return
+	}
+	defer rows.Close() // nolint: errcheck
+	for rows.Next() {
+		var m KeyMapping
+		if err = rows.Scan(&m.Key, &m.UserID); err != nil {
+			return
+		}
+		res.UserKeys = append(res.UserKeys, m)
+	}
+	err = rows.Err()
+	return
+}
+
+// listMappings returns mappings of tracker ordered by ID, all mappings when trackerID is 0
+func (store *SQLStore) listMappings(tx *sql.Tx, trackerID entities.TrackerID) (res []Mapping, err error) {
+	query, args := `SELECT tracker_id, user_id, user_key FROM jirams_users ORDER BY tracker_id, user_id`, []interface{}(nil)
+	if trackerID != 0 {
+		query = store.rebind(`SELECT tracker_id, user_id, user_key FROM jirams_users WHERE tracker_id = ? ORDER BY user_id`)
+		args = []interface{}{uint64(trackerID)}
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close() // nolint: errcheck
+	for rows.Next() {
+		var m Mapping
+		if err = rows.Scan(&m.TrackerID, &m.UserID, &m.Key); err != nil {
+			return
+		}
+		res = append(res, m)
+	}
+	err = rows.Err()
+	return
+}
+
+func (store *SQLStore) tx(fn func(tx *sql.Tx) error) error {
+	tx, err := store.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rebind replaces ? placeholders with $N for PostgreSQL
+func (store *SQLStore) rebind(query string) string {
+	if store.Dialect != Postgres {
+		return query
+	}
+	var buf strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&buf, "$%d", n)
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
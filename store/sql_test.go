@@ -0,0 +1,159 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/qarea/jirams/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	db, err := sql.Open(SQLite, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection gets its own in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return NewSQL(db, SQLite)
+}
+
+func TestSQLStore(t *testing.T) {
+	a := assert.New(t)
+	store := newTestSQLStore(t)
+	a.NoError(store.Ping())
+
+	key, err := store.GetKey(1, 1)
+	a.NoError(err)
+	a.Equal("", key)
+
+	id, err := store.GetID(1, "TEST")
+	a.NoError(err)
+	a.Equal(entities.UserID(1), id)
+	id, err = store.GetID(1, "TEST")
+	a.NoError(err)
+	a.Equal(entities.UserID(1), id)
+	id, err = store.GetID(1, "TEST2")
+	a.NoError(err)
+	a.Equal(entities.UserID(2), id)
+	// known key gets the same ID in other tracker, like in BoltDB store
+	id, err = store.GetID(2, "TEST")
+	a.NoError(err)
+	a.Equal(entities.UserID(1), id)
+
+	key, err = store.GetKey(1, 2)
+	a.NoError(err)
+	a.Equal("TEST2", key)
+	key, err = store.GetKey(2, 1)
+	a.NoError(err)
+	a.Equal("", key)
+
+	// migrations are applied once
+	a.NoError(store.Migrate())
+	id, err = store.GetID(1, "TEST3")
+	a.NoError(err)
+	a.Equal(entities.UserID(3), id)
+}
+
+func TestSQLStoreImport(t *testing.T) {
+	a := assert.New(t)
+	bolt := newTestStore(t)
+	_, _ = bolt.GetID(1, "alice")
+	_, _ = bolt.GetID(2, "bob")
+	dump, err := bolt.Export()
+	a.NoError(err)
+
+	store := newTestSQLStore(t)
+	_, _ = store.GetID(3, "stale")
+	a.NoError(store.Import(dump))
+	exported, err := store.Export()
+	a.NoError(err)
+	a.Equal(dump, exported)
+
+	id, err := store.GetID(2, "bob")
+	a.NoError(err)
+	a.Equal(entities.UserID(2), id)
+	id, err = store.GetID(1, "carol")
+	a.NoError(err)
+	a.Equal(entities.UserID(3), id, "sequence should be copied")
+}
+
+func TestSQLStoreAdmin(t *testing.T) {
+	a := assert.New(t)
+	store := newTestSQLStore(t)
+	_, _ = store.GetID(1, "alice")
+	_, _ = store.GetID(1, "bob")
+	_, _ = store.GetID(2, "carol")
+
+	mappings, err := store.List(1)
+	a.NoError(err)
+	a.Equal([]Mapping{{1, 1, "alice"}, {1, 2, "bob"}}, mappings)
+	mappings, _ = store.List(0)
+	a.Len(mappings, 3)
+	id, err := store.LookupID("carol")
+	a.NoError(err)
+	a.Equal(entities.UserID(3), id)
+	_, err = store.LookupID("dave")
+	a.Equal(ErrMappingNotFound, err)
+
+	a.Equal(ErrIDTaken, store.Reassign(1, "alice", 2))
+	a.NoError(store.Reassign(1, "alice", 10))
+	mappings, _ = store.List(1)
+	a.Equal([]Mapping{{1, 2, "bob"}, {1, 10, "alice"}}, mappings)
+	id, _ = store.GetID(1, "dave")
+	a.Equal(entities.UserID(11), id, "reassigned ID should not be issued again")
+
+	a.Equal(ErrMergeSameID, store.Merge(1, 2, 2))
+	a.Equal(ErrMappingNotFound, store.Merge(1, 2, 5))
+	a.NoError(store.Merge(1, 2, 10))
+	id, _ = store.GetID(1, "bob")
+	a.Equal(entities.UserID(10), id)
+	problems, err := store.Verify()
+	a.NoError(err)
+	a.Empty(problems)
+
+	count, err := store.DeleteTracker(1)
+	a.NoError(err)
+	a.Equal(2, count)
+	_, err = store.LookupID("alice")
+	a.Equal(ErrMappingNotFound, err)
+	mappings, _ = store.List(0)
+	a.Equal([]Mapping{{2, 3, "carol"}}, mappings)
+}
+
+func TestSQLStoreVerifyRepair(t *testing.T) {
+	a := assert.New(t)
+	store := newTestSQLStore(t)
+	a.NoError(store.Import(Dump{
+		Sequence: 1,
+		Users:    []Mapping{{1, 1, "alice"}, {1, 2, "bob"}, {1, 3, "bob"}},
+		UserKeys: []KeyMapping{{"alice", 5}, {"carol", 4}},
+	}))
+	problems, err := store.Verify()
+	a.NoError(err)
+	a.Len(problems, 6)
+
+	fixed, err := store.Repair()
+	a.NoError(err)
+	a.Len(fixed, 3)
+	problems, _ = store.Verify()
+	a.Equal([]Problem{
+		{Type: ProblemReverseMismatch, TrackerID: 1, UserID: 1, Key: "alice", Detail: "UserKeys maps key to 5"},
+		{Type: ProblemReverseMismatch, TrackerID: 1, UserID: 3, Key: "bob", Detail: "UserKeys maps key to 2"},
+		{Type: ProblemDuplicateKey, TrackerID: 1, Key: "bob", Detail: "key is mapped to IDs [2 3]"},
+	}, problems)
+
+	a.NoError(store.Reassign(1, "alice", 1))
+	a.NoError(store.Merge(1, 3, 2))
+	problems, _ = store.Verify()
+	a.Empty(problems)
+}
+
+func TestRebind(t *testing.T) {
+	a := assert.New(t)
+	query := `SELECT a FROM t WHERE b = ? AND c = ?`
+	a.Equal(query, (&SQLStore{Dialect: MySQL}).rebind(query))
+	a.Equal(`SELECT a FROM t WHERE b = $1 AND c = $2`, (&SQLStore{Dialect: Postgres}).rebind(query))
+}
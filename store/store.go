@@ -2,10 +2,13 @@ package store
 
 import (
 	"encoding/binary"
+	"errors"
+	"time"
 
 	"github.com/boltdb/bolt"
-	"github.com/powerman/narada-go/narada"
 	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/metrics"
+	"github.com/qarea/jirams/redact"
 )
 
 const (
@@ -32,7 +35,7 @@ func New(db *bolt.DB) *Store {
 	return &res
 }
 
-var log = narada.NewLog("user store: ")
+var log = redact.NewLog("user store: ")
 
 // Init initializes BoltDB storage if needed
 func (store *Store) Init() {
@@ -49,8 +52,19 @@ func (store *Store) Init() {
 	})
 }
 
+// Ping verifies that storage answers read transactions and is initialized
+func (store *Store) Ping() error {
+	return store.DB.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(userBucket)) == nil || tx.Bucket([]byte(userKeyBucket)) == nil {
+			return errors.New("user store is not initialized")
+		}
+		return nil
+	})
+}
+
 // GetID looks for provided user key in the mapping, stores it if it is not present and returns associated numeric user id
 func (store *Store) GetID(trackerID entities.TrackerID, key entities.UserKey) (res entities.UserID, err error) {
+	defer metrics.ObserveStore("GetID", time.Now())
 
 	err = store.DB.Update(func(tx *bolt.Tx) error {
 		userKeys := tx.Bucket([]byte(userKeyBucket))
@@ -82,6 +96,7 @@ func (store *Store) GetID(trackerID entities.TrackerID, key entities.UserKey) (r
 
 // GetKey looks for provided user ID in the mapping and returns original user key
 func (store *Store) GetKey(trackerID entities.TrackerID, userID entities.UserID) (res string, err error) {
+	defer metrics.ObserveStore("GetKey", time.Now())
 	err = store.DB.View(func(tx *bolt.Tx) error {
 		users := tx.Bucket([]byte(userBucket))
 		storeKey := makeKey(trackerID, userID)
@@ -0,0 +1,30 @@
+// Package traceid extracts TG tracing ID from the context without pulling tracing dependencies
+package traceid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// ContextKey is a key used by ctxtg to store tracing ID in the context
+const ContextKey = "TracingID"
+
+// FromContext returns TG tracing ID stored in the context
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id := ctx.Value(ContextKey); id != nil {
+		return fmt.Sprint(id)
+	}
+	return ""
+}
+
+// New returns context with random tracing ID for background jobs not caused by RPC calls
+func New(ctx context.Context) context.Context {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return context.WithValue(ctx, ContextKey, "jirams-"+hex.EncodeToString(id[:]))
+}
@@ -0,0 +1,16 @@
+package traceid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("", FromContext(context.Background()))
+	id := FromContext(New(context.Background()))
+	a.Regexp(`^jirams-[0-9a-f]{16}$`, id)
+	a.NotEqual(id, FromContext(New(context.Background())))
+}
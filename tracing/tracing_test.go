@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestID(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("", ID(context.Background()))
+	a.Equal("abc", ID(context.WithValue(context.Background(), contextKey, "abc")))
+}
+
+func TestInject(t *testing.T) {
+	a := assert.New(t)
+	header := http.Header{}
+	Inject(context.Background(), header)
+	a.Equal("", header.Get(Header))
+
+	Inject(context.WithValue(context.Background(), contextKey, "abc"), header)
+	a.Equal("abc", header.Get(Header))
+}
+
+func TestSetup(t *testing.T) {
+	a := assert.New(t)
+	shutdown, err := Setup(ExporterNone, "", "test")
+	a.NoError(err)
+	a.NoError(shutdown(context.Background()))
+
+	_, err = Setup("unknown", "", "test")
+	a.Error(err)
+
+	shutdown, err = Setup(ExporterStdout, "", "test")
+	a.NoError(err)
+	_, span := Start(context.Background(), "test")
+	End(span, errors.New("error"))
+	a.NoError(shutdown(context.Background()))
+}
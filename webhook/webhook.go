@@ -0,0 +1,232 @@
+// Package webhook receives JIRA webhooks, invalidates caches and publishes change events
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/events"
+	"github.com/qarea/jirams/jira"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+var log = redact.NewLog("webhook: ")
+
+const (
+	// maxBodySize limits accepted webhook body
+	maxBodySize = 1 << 20
+
+	signatureHeader = "X-Hub-Signature"
+	signaturePrefix = "sha256="
+	jwtPrefix       = "JWT "
+)
+
+// Invalidator drops cached tracker data affected by changes
+type Invalidator interface {
+	InvalidateProject(trackerID entities.TrackerID, projectID entities.ProjectID)
+	InvalidateProjectIssues(trackerID entities.TrackerID)
+}
+
+// Publisher delivers events received by webhook to subscribers which have access to them
+type Publisher interface {
+	Publish(ctx context.Context, event events.Event)
+}
+
+// Handler verifies JIRA webhook requests and processes their events.
+// Requests are accepted when signed with tracker secret derived from Secret (X-Hub-Signature header
+// or secret query parameter) or carry JWT as sent by Connect apps. JWT must be signed with tracker secret
+// derived from JWTSecret, expire and be issued by the tracker (iss is tracker ID).
+type Handler struct {
+	Secret    string
+	JWTSecret string
+	// BasePath is stripped from request path to calculate JWT query string hash
+	BasePath string
+	Cache    Invalidator
+	Events   Publisher
+}
+
+// NewHandler creates webhook Handler
+func NewHandler(secret, jwtSecret, basePath string, cache Invalidator, events Publisher) *Handler {
+	return &Handler{
+		Secret:    secret,
+		JWTSecret: jwtSecret,
+		BasePath:  basePath,
+		Cache:     cache,
+		Events:    events,
+	}
+}
+
+// URL returns webhook endpoint address to register in tracker, it contains secret of this tracker only
+func URL(publicURL string, trackerID entities.TrackerID, secret string) string {
+	query := url.Values{"tracker": {strconv.FormatUint(uint64(trackerID), 10)}}
+	if secret != "" {
+		query.Set("secret", TrackerSecret(secret, trackerID))
+	}
+	return publicURL + "?" + query.Encode()
+}
+
+// TrackerSecret derives webhook secret of the tracker, so tracker admins can't forge webhooks of other trackers
+func TrackerSecret(secret string, trackerID entities.TrackerID) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(strconv.FormatUint(uint64(trackerID), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP handles single webhook
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := traceid.New(r.Context())
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	trackerID, err := strconv.ParseUint(r.URL.Query().Get("tracker"), 10, 64)
+	if err != nil {
+		http.Error(w, "tracker parameter is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.verify(r, entities.TrackerID(trackerID), body); err != nil {
+		log.WARN("[%s] Rejected webhook for tracker %d from %s: %v", tracing.ID(ctx), trackerID, r.RemoteAddr, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	event, err := jira.ParseWebhook(entities.TrackerID(trackerID), body)
+	if err == jira.ErrUnsupportedWebhook {
+		log.DEBUG("[%s] Ignored unsupported webhook for tracker %d", tracing.ID(ctx), trackerID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		log.WARN("[%s] Failed to parse webhook for tracker %d: %v", tracing.ID(ctx), trackerID, err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	h.handle(ctx, event)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handle(ctx context.Context, event events.Event) {
+	log.DEBUG("[%s] Tracker %d: %s for issue %d", tracing.ID(ctx), event.TrackerID, event.Type, event.IssueID)
+	if h.Cache != nil {
+		if event.ProjectID != 0 {
+			h.Cache.InvalidateProject(event.TrackerID, event.ProjectID)
+		} else {
+			// worklog webhooks do not include project, spent time may be cached in any project
+			h.Cache.InvalidateProjectIssues(event.TrackerID)
+		}
+	}
+	if h.Events != nil {
+		h.Events.Publish(ctx, event)
+	}
+}
+
+func (h *Handler) verify(r *http.Request, trackerID entities.TrackerID, body []byte) error {
+	if token := jwtToken(r); token != "" {
+		return h.verifyJWT(r, trackerID, token)
+	}
+	if h.Secret == "" {
+		return errors.New("no secret configured")
+	}
+	secret := TrackerSecret(h.Secret, trackerID)
+	if signature := r.Header.Get(signatureHeader); signature != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write(body)
+		expected := signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("secret")), []byte(secret)) != 1 {
+		return errors.New("invalid secret")
+	}
+	return nil
+}
+
+func jwtToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, jwtPrefix) {
+		return strings.TrimPrefix(auth, jwtPrefix)
+	}
+	return r.URL.Query().Get("jwt")
+}
+
+func (h *Handler) verifyJWT(r *http.Request, trackerID entities.TrackerID, token string) error {
+	if h.JWTSecret == "" {
+		return errors.New("no JWT secret configured")
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(TrackerSecret(h.JWTSecret, trackerID)), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return errors.New("token has no expiration or expired")
+	}
+	if !claims.VerifyIssuer(strconv.FormatUint(uint64(trackerID), 10), true) {
+		return errors.New("token is issued for other tracker")
+	}
+	if qsh, _ := claims["qsh"].(string); qsh != QueryStringHash(r, h.BasePath) {
+		return errors.New("invalid query string hash")
+	}
+	return nil
+}
+
+// QueryStringHash calculates Atlassian Connect qsh claim for the request
+func QueryStringHash(r *http.Request, basePath string) string {
+	path := strings.TrimPrefix(r.URL.Path, basePath)
+	if path == "" {
+		path = "/"
+	}
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if key != "jwt" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for j := range values {
+			values[j] = escape(values[j])
+		}
+		params[i] = escape(key) + "=" + strings.Join(values, ",")
+	}
+	canonical := strings.ToUpper(r.Method) + "&" + path + "&" + strings.Join(params, "&")
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/qarea/jirams/entities"
+	"github.com/qarea/jirams/events"
+	"github.com/stretchr/testify/assert"
+)
+
+const issueBody = `{"webhookEvent":"jira:issue_created","issue":{"id":"10002","key":"TST-2","fields":{"project":{"id":"10000"}}}}`
+
+type testCache struct {
+	projects []entities.ProjectID
+	trackers []entities.TrackerID
+}
+
+func (c *testCache) InvalidateProject(trackerID entities.TrackerID, projectID entities.ProjectID) {
+	c.projects = append(c.projects, projectID)
+}
+
+func (c *testCache) InvalidateProjectIssues(trackerID entities.TrackerID) {
+	c.trackers = append(c.trackers, trackerID)
+}
+
+type testPublisher []events.Event
+
+func (p *testPublisher) Publish(_ context.Context, event events.Event) { *p = append(*p, event) }
+
+func serve(h *Handler, r *http.Request) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestSecret(t *testing.T) {
+	a := assert.New(t)
+	cache := &testCache{}
+	published := &testPublisher{}
+	h := NewHandler("s3cret", "", "/base", cache, published)
+
+	r := httptest.NewRequest("POST", "/base/webhook?tracker=1&secret=wrong", strings.NewReader(issueBody))
+	a.Equal(http.StatusForbidden, serve(h, r))
+
+	r = httptest.NewRequest("POST", URL("/base/webhook", 1, "s3cret"), strings.NewReader(issueBody))
+	a.Equal(http.StatusNoContent, serve(h, r))
+	a.Equal([]entities.ProjectID{10000}, cache.projects)
+	if a.Len(*published, 1) {
+		a.Equal(events.IssueCreated, (*published)[0].Type)
+		a.Equal(entities.TrackerID(1), (*published)[0].TrackerID)
+	}
+
+	r = httptest.NewRequest("POST", "/base/webhook?tracker=1", strings.NewReader(`{"webhookEvent":"worklog_deleted","worklog":{"issueId":"10002"}}`))
+	mac := hmac.New(sha256.New, []byte(TrackerSecret("s3cret", 1)))
+	mac.Write([]byte(`{"webhookEvent":"worklog_deleted","worklog":{"issueId":"10002"}}`))
+	r.Header.Set(signatureHeader, signaturePrefix+hex.EncodeToString(mac.Sum(nil)))
+	a.Equal(http.StatusNoContent, serve(h, r))
+	a.Equal([]entities.TrackerID{1}, cache.trackers)
+
+	r = httptest.NewRequest("POST", "/base/webhook?tracker=1", strings.NewReader(issueBody))
+	r.Header.Set(signatureHeader, signaturePrefix+"00")
+	a.Equal(http.StatusForbidden, serve(h, r))
+
+	r = httptest.NewRequest("POST", "/base/webhook?tracker=2&secret="+TrackerSecret("s3cret", 1), strings.NewReader(issueBody))
+	a.Equal(http.StatusForbidden, serve(h, r), "secret of other tracker")
+
+	r = httptest.NewRequest("POST", "/base/webhook?tracker=1&secret=s3cret", strings.NewReader(issueBody))
+	a.Equal(http.StatusForbidden, serve(h, r), "global secret")
+
+	r = httptest.NewRequest("POST", URL("/base/webhook", 1, "s3cret"), strings.NewReader(`{"webhookEvent":"board_created"}`))
+	a.Equal(http.StatusNoContent, serve(h, r))
+	a.Len(*published, 2)
+}
+
+func TestJWT(t *testing.T) {
+	a := assert.New(t)
+	published := &testPublisher{}
+	h := NewHandler("", "connect", "/base", nil, published)
+
+	r := httptest.NewRequest("POST", "/base/webhook?tracker=2", strings.NewReader(issueBody))
+	sign := func(secret string, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		a.NoError(err)
+		return token
+	}
+	valid := func(r *http.Request) jwt.MapClaims {
+		return jwt.MapClaims{"iss": "2", "exp": time.Now().Add(time.Minute).Unix(), "qsh": QueryStringHash(r, "/base")}
+	}
+	r.Header.Set("Authorization", "JWT "+sign(TrackerSecret("connect", 2), valid(r)))
+	a.Equal(http.StatusNoContent, serve(h, r))
+	a.Len(*published, 1)
+
+	reject := func(secret string, change func(claims jwt.MapClaims), msg string) {
+		r := httptest.NewRequest("POST", "/base/webhook?tracker=2", strings.NewReader(issueBody))
+		claims := valid(r)
+		change(claims)
+		r.Header.Set("Authorization", "JWT "+sign(secret, claims))
+		a.Equal(http.StatusForbidden, serve(h, r), msg)
+	}
+	reject("wrong", func(jwt.MapClaims) {}, "wrong secret")
+	reject("connect", func(jwt.MapClaims) {}, "global secret can't sign webhooks")
+	reject(TrackerSecret("connect", 1), func(claims jwt.MapClaims) { claims["iss"] = "1" }, "secret of other tracker")
+	reject(TrackerSecret("connect", 2), func(claims jwt.MapClaims) { claims["iss"] = "1" }, "other issuer")
+	reject(TrackerSecret("connect", 2), func(claims jwt.MapClaims) { delete(claims, "iss") }, "no issuer")
+	reject(TrackerSecret("connect", 2), func(claims jwt.MapClaims) { delete(claims, "exp") }, "no expiration")
+	reject(TrackerSecret("connect", 2), func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }, "expired")
+	reject(TrackerSecret("connect", 2), func(claims jwt.MapClaims) { claims["qsh"] = "other" }, "other query")
+	a.Len(*published, 1)
+}
+
+func TestQueryStringHash(t *testing.T) {
+	r := httptest.NewRequest("POST", "/base/webhook/?tracker=2&b=x%20y&a=2&a=1&jwt=token", nil)
+	sum := sha256.Sum256([]byte("POST&/webhook&a=1,2&b=x%20y&tracker=2"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), QueryStringHash(r, "/base"))
+}
@@ -0,0 +1,238 @@
+// Package ws serves JSON-RPC API over WebSocket and pushes subscribed events to clients
+package ws
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/rpc"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/powerman/rpc-codec/jsonrpc2"
+	"github.com/qarea/jirams/api"
+	"github.com/qarea/jirams/events"
+	"github.com/qarea/jirams/redact"
+	"github.com/qarea/jirams/tracing"
+	"github.com/qarea/jirams/tracing/traceid"
+)
+
+var log = redact.NewLog("ws: ")
+
+const (
+	// NotifyMethod is JSON-RPC notification method used to push events
+	NotifyMethod = "Events.Notify"
+
+	writeTimeout = 10 * time.Second
+	pongTimeout  = 60 * time.Second
+	pingPeriod   = pongTimeout * 9 / 10
+)
+
+// Handler upgrades HTTP connections to WebSocket and serves JSON-RPC on them
+type Handler struct {
+	API *api.API
+	Hub *events.Hub
+	// Buffer is amount of events queued for a slow client before they're dropped
+	Buffer int
+	// AllowedOrigins lists origins (scheme://host[:port]) of pages on other hosts allowed to connect,
+	// requests without Origin header are made by non-browser clients and are always allowed
+	AllowedOrigins []string
+
+	upgrader websocket.Upgrader
+	mu       sync.Mutex
+	conns    map[*conn]struct{}
+	closed   bool
+}
+
+// NewHandler creates Handler serving given API and events of given hub
+func NewHandler(rpcAPI *api.API, hub *events.Hub, buffer int, allowedOrigins []string) *Handler {
+	h := &Handler{
+		API:            rpcAPI,
+		Hub:            hub,
+		Buffer:         buffer,
+		AllowedOrigins: allowedOrigins,
+		conns:          make(map[*conn]struct{}),
+	}
+	h.upgrader.CheckOrigin = h.checkOrigin
+	return h
+}
+
+// checkOrigin allows same origin and allowlisted cross-origin pages to prevent cross-site WebSocket hijacking
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range h.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP serves single WebSocket connection until it's closed
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := traceid.New(r.Context())
+	wsConn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.DEBUG("[%s] Failed to upgrade connection: %v", tracing.ID(ctx), err)
+		return
+	}
+	conn := newConn(wsConn)
+	if !h.track(conn) {
+		_ = conn.closeGoingAway()
+		return
+	}
+	defer h.untrack(conn)
+	subscriber := h.Hub.NewSubscriber(h.Buffer)
+	defer subscriber.Close()
+
+	srv := rpc.NewServer()
+	if err := srv.Register(h.API); err != nil {
+		log.ERR("[%s] Failed to register API: %v", tracing.ID(ctx), err)
+		conn.Close()
+		return
+	}
+	if err := srv.Register(api.NewEventsAPI(h.API, subscriber)); err != nil {
+		log.ERR("[%s] Failed to register events API: %v", tracing.ID(ctx), err)
+		conn.Close()
+		return
+	}
+
+	done := make(chan struct{})
+	go conn.push(ctx, subscriber.C, done)
+	srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv))
+	close(done)
+}
+
+// Close tells clients the server is going away and closes all connections,
+// new connections are closed right after upgrade
+func (h *Handler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.conns {
+		_ = c.closeGoingAway()
+	}
+}
+
+func (h *Handler) track(c *conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.conns[c] = struct{}{}
+	return true
+}
+
+func (h *Handler) untrack(c *conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c)
+}
+
+// notification - JSON-RPC 2.0 request without ID
+type notification struct {
+	Version string       `json:"jsonrpc"`
+	Method  string       `json:"method"`
+	Params  events.Event `json:"params"`
+}
+
+// conn adapts WebSocket to io.ReadWriteCloser used by JSON-RPC codec,
+// every write is sent as a separate text message
+type conn struct {
+	ws      *websocket.Conn
+	reader  io.Reader
+	writeMu sync.Mutex
+}
+
+func newConn(ws *websocket.Conn) *conn {
+	_ = ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+	return &conn{ws: ws}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := c.ws.WriteMessage(websocket.TextMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *conn) Close() error {
+	return c.ws.Close()
+}
+
+// closeGoingAway sends close message and closes connection
+func (c *conn) closeGoingAway() error {
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+	_ = c.ws.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+	return c.ws.Close()
+}
+
+// push sends events and keepalive pings until done is closed
+func (c *conn) push(ctx context.Context, queue <-chan events.Event, done <-chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case event := <-queue:
+			c.writeMu.Lock()
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err := c.ws.WriteJSON(notification{Version: "2.0", Method: NotifyMethod, Params: event})
+			c.writeMu.Unlock()
+			if err != nil {
+				log.DEBUG("[%s] Failed to push event: %v", tracing.ID(ctx), err)
+				c.Close()
+				return
+			}
+		case <-ticker.C:
+			err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+			if err != nil {
+				log.DEBUG("[%s] Failed to ping: %v", tracing.ID(ctx), err)
+				c.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/qarea/jirams/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn(t *testing.T) {
+	a := assert.New(t)
+	queue := make(chan events.Event, 1)
+	done := make(chan struct{})
+	defer close(done)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := newConn(wsConn)
+		go c.push(r.Context(), queue, done)
+		dec := json.NewDecoder(c)
+		var v map[string]int
+		for dec.Decode(&v) == nil {
+			v["n"]++
+			if _, err := c.Write([]byte(mustJSON(v))); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if !a.NoError(err) {
+		return
+	}
+	defer client.Close()
+
+	// request may be split into several messages
+	a.NoError(client.WriteMessage(websocket.TextMessage, []byte(`{"n":`)))
+	a.NoError(client.WriteMessage(websocket.TextMessage, []byte(`1}`)))
+	_, msg, err := client.ReadMessage()
+	a.NoError(err)
+	a.JSONEq(`{"n":2}`, string(msg))
+
+	queue <- events.Event{Type: events.IssueUpdated, TrackerID: 1, ProjectID: 2, IssueID: 3}
+	_, msg, err = client.ReadMessage()
+	a.NoError(err)
+	a.JSONEq(`{"jsonrpc":"2.0","method":"Events.Notify","params":{"Type":"issue_updated","TrackerID":1,"ProjectID":2,"IssueID":3}}`, string(msg))
+}
+
+func TestClose(t *testing.T) {
+	a := assert.New(t)
+	h := &Handler{conns: make(map[*conn]struct{})}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wsConn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c := newConn(wsConn)
+		if !h.track(c) {
+			_ = c.closeGoingAway()
+			return
+		}
+		_, _ = c.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !a.NoError(err) {
+		return
+	}
+	defer client.Close()
+	_, _, err = client.ReadMessage()
+	a.NoError(err)
+
+	h.Close()
+	_, _, err = client.ReadMessage()
+	a.True(websocket.IsCloseError(err, websocket.CloseGoingAway), "%v", err)
+
+	client, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if !a.NoError(err) {
+		return
+	}
+	defer client.Close()
+	_, _, err = client.ReadMessage()
+	a.True(websocket.IsCloseError(err, websocket.CloseGoingAway), "%v", err)
+}
+
+func TestCheckOrigin(t *testing.T) {
+	a := assert.New(t)
+	h := NewHandler(nil, events.NewHub(), 1, []string{"https://tg.example.com"})
+	check := func(origin string) bool {
+		r := httptest.NewRequest("GET", "http://jirams.example.com/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return h.checkOrigin(r)
+	}
+	a.True(check(""))
+	a.True(check("http://jirams.example.com"))
+	a.True(check("https://TG.example.com"))
+	a.False(check("https://evil.example.com"))
+	a.False(check("https://tg.example.com.evil.com"))
+}
+
+func mustJSON(v interface{}) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(buf)
+}